@@ -1,10 +1,11 @@
 package clpaparallel
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"math/rand"
-	"sync"
+	"time"
 
 	"example.com/shardinglpa/shared"
 )
@@ -30,19 +31,39 @@ the vertices with no transcations in this epoch
 func ShardAllocation(datasetDir string, numberOfShards int, epochNumber int,
 	graph *shared.Graph, alpha float64, beta float64, tau int, rho int, seeds []int64) ([]*shared.EpochResult, map[string]*shared.Vertex) {
 
-	// Create a WaitGroup to wait for all goroutines to finish
-	var wg sync.WaitGroup
+	// Run every seed at the same time, without any limit
+	return ShardAllocationWithConfig(context.Background(), datasetDir, numberOfShards, epochNumber, graph, alpha, beta, tau, rho, seeds,
+		shared.AllocationConfig{})
+}
 
-	// Buffered channel to collect results from each seed's run
-	results := make(chan *shared.EpochResult, len(seeds))
+/*
+Function to perform shard allocation, with the optional settings in config
 
-	// Create a new graph if it was not passed in to function
-	if graph == nil {
-		graph = &shared.Graph{
-			Vertices:       make(map[string]*shared.Vertex),
-			NumberOfShards: numberOfShards,
-		}
-	}
+The config sets the maximum number of seeds run at the same time, separately from the number of seeds.
+It can also set a memory budget, which throttles the number of per-seed label states that exist at once.
+When a memory budget is set, only the label state of the best result is kept, and the label states of the
+other results are discarded.
+
+All seeds share the topology of the graph (its vertices and edges), and each seed only keeps its own labels.
+The labels of the best seed are written back into the graph by shared.GetBestGraph.
+
+If the context is cancelled or its deadline is exceeded, every seed stops its iterations early and keeps the
+best labelling it found so far, and the seeds that have not started yet are skipped. The results of the seeds
+that were cut short have their Interrupted flag set.
+
+If a seed race is set in the config, the seeds report their fitness to it every few iterations, and seeds that
+fall behind the leader are abandoned. The results of abandoned seeds have their Pruned flag set and no labels.
+The outcome of the race can be read from the race once this function returns.
+
+If a cost model is set in the config, it is kept in the graph and decides how transactions add to the workloads
+of shards. Otherwise the cost model of the graph is used, which is the one of the paper for a new graph.
+
+If stopping rules are set in the config, the iteration in which the first of them fires is recorded in the results,
+together with the rule, instead of only the iteration in which no label changed. The iterations still carry on.
+*/
+func ShardAllocationWithConfig(ctx context.Context, datasetDir string, numberOfShards int, epochNumber int, graph *shared.Graph,
+	alpha float64, beta float64, tau int, rho int, seeds []int64,
+	config shared.AllocationConfig) ([]*shared.EpochResult, map[string]*shared.Vertex) {
 
 	// Generate the filename dynamically based on the epoch value
 	filename := fmt.Sprintf("%sepoch_%d.csv", datasetDir, epochNumber)
@@ -54,10 +75,46 @@ func ShardAllocation(datasetDir string, numberOfShards int, epochNumber int,
 		return nil, nil
 	}
 
+	return ShardAllocationFromRows(ctx, rows, numberOfShards, graph, alpha, beta, tau, rho, seeds, config)
+}
+
+/*
+Function to perform shard allocation on the transactions in rows, instead of on the transactions of an epoch file
+
+The first row is the header, which must have a "from" and a "to" column. Otherwise, this works in the same way
+as ShardAllocationWithConfig.
+*/
+func ShardAllocationFromRows(ctx context.Context, rows [][]string, numberOfShards int, graph *shared.Graph,
+	alpha float64, beta float64, tau int, rho int, seeds []int64,
+	config shared.AllocationConfig) ([]*shared.EpochResult, map[string]*shared.Vertex) {
+
+	// Create a new graph if it was not passed in to function
+	if graph == nil {
+		graph = &shared.Graph{
+			Vertices:       make(map[string]*shared.Vertex),
+			NumberOfShards: numberOfShards,
+		}
+	}
+
+	// Select the cost model of the graph, if one is set in the config
+	if config.CostModel != nil {
+		graph.CostModel = config.CostModel
+	}
+
+	// Keep the edges of the last epochs in the graph, if a sliding window is set in the config
+	if config.EdgeWindow > 0 {
+		graph.SetEdgeWindow(config.EdgeWindow)
+	}
+
+	// Select the placement policy of new vertices, if one is set in the config
+	if config.Placement != nil {
+		graph.Placement = config.Placement
+	}
+
 	// Update the graph based on the rows of the current epoch
 	graph = updateGraphFromRows(rows, graph)
 
-	//The following process can be done on the graph before a copy is provided to each go routine:
+	//The following process can be done on the graph before the topology is shared with each go routine:
 	/* inactiveVertices refers to vertices which have no edges in this particular epoch.
 	These will be dealt with by being removed since CLPA should ignore them, and then
 	after CLPA is run, added back to graph. */
@@ -71,94 +128,207 @@ func ShardAllocation(datasetDir string, numberOfShards int, epochNumber int,
 		}
 	}
 
-	// Iterate through each seed
-	for _, seed := range seeds {
+	// Clear the state of the seed race from any previous epoch
+	if config.Race != nil {
+		config.Race.Start()
+	}
 
-		// Increment the WaitGroup counter by 1 to track a new goroutine
-		wg.Add(1)
+	// Build the topology of the graph once, to be shared by all seeds
+	topology := shared.NewTopology(graph)
 
-		// Launch a new goroutine to run the CLPA for a specific seed
-		go func(seed int64) {
+	// Work out how many seeds can run at the same time
+	numberOfWorkers := shared.ConcurrentSeedLimit(topology.EstimateStateSize(false), len(seeds), config)
 
-			// Decrease the WaitGroup counter when the goroutine finishes
-			defer wg.Done()
+	// Run the CLPA for each seed using a pool of goroutines
+	// If a memory budget is set, only the best label state found so far is kept, unless the consensus needs them all
+	keepOnlyBest := config.MemoryBudget > 0 && config.Consensus == nil
+	seedsResultsForEpoch := shared.RunSeeds(ctx, seeds, numberOfWorkers, keepOnlyBest,
+		func(seed int64) *shared.EpochResult {
 
 			// Use unique random generator for each parallel run
 			randomGen := rand.New(rand.NewSource(seed))
 
-			// Deep copy the graph for this goroutine
-			localGraph := shared.DeepCopyGraph(graph)
+			// Create the labels of this goroutine, starting from the labels of the graph
+			state := topology.NewLabelState()
 
-			// Initialise the graph with random shard labels for new vertices
-			localGraph = initialiseNewVertices(localGraph, randomGen)
+			// Initialise the labels with random shard labels for new vertices
+			initialiseNewVertices(topology, state, randomGen)
 
 			// Work out workloads for the first time this epoch
-			localGraph.ShardWorkloads = calculateShardWorkloads(localGraph)
+			state.ShardWorkloads = topology.CalculateShardWorkloads(state)
 
 			// Now that preparation is ready, the actual CLPA can run and the results recorded
-			epochResult := runClpa(alpha, beta, tau, rho, localGraph, randomGen, seed)
-
-			epochResult.Graph = localGraph
+			epochResult := runClpa(ctx, alpha, beta, tau, rho, topology, state, randomGen, seed, config)
 
-			// Send the epoch results for this seed to the results channel
-			results <- epochResult
-		}(seed)
-	}
+			// The labels of an abandoned seed are not needed, so they are discarded straight away
+			if !epochResult.Pruned {
+				epochResult.State = state
+				epochResult.Topology = topology
+			}
 
-	// Wait for all Goroutines to finish and close the results channel
-	wg.Wait()
+			return epochResult
+		})
 
-	close(results)
+	// Work out the outcome of the seed race
+	if config.Race != nil {
+		config.Race.Finish(seedsResultsForEpoch)
+	}
 
-	// Collect all the seeds results for the epoch into a slice
-	var seedsResultsForEpoch []*shared.EpochResult
-	for result := range results {
-		seedsResultsForEpoch = append(seedsResultsForEpoch, result)
+	// In ensemble mode, add the consensus of the seeds, which is picked by GetBestGraph instead of the best seed
+	if config.Consensus != nil {
+		if consensusResult := runConsensus(ctx, seedsResultsForEpoch, alpha, beta, tau, rho,
+			config); consensusResult != nil {
+			seedsResultsForEpoch = append(seedsResultsForEpoch, consensusResult)
+		}
 	}
 
 	// Return the collected results of all the seeds for the epoch
 	return seedsResultsForEpoch, inactiveVertices
 }
 
+/*
+Function to build the consensus of the seeds, in which the vertices that almost always share a shard are merged,
+and to run a final CLPA pass on it, starting from the labels of the best seed
+
+It returns the result of the consensus, labelled on the topology of the seeds, or nil if no seed holds its labels.
+*/
+func runConsensus(ctx context.Context, seedsResults []*shared.EpochResult, alpha float64, beta float64, tau int,
+	rho int, config shared.AllocationConfig) *shared.EpochResult {
+
+	consensus := shared.NewConsensus(seedsResults, config.Consensus.Agreement)
+	if consensus == nil {
+		return nil
+	}
+
+	// Run the CLPA on the merged graph, with the random generator of the best seed
+	mergedTopology := shared.NewTopology(consensus.Graph)
+	mergedState := mergedTopology.NewLabelState()
+	mergedState.ShardWorkloads = mergedTopology.CalculateShardWorkloads(mergedState)
+
+	randomGen := rand.New(rand.NewSource(consensus.BestSeed))
+	result := runClpa(ctx, alpha, beta, tau, rho, mergedTopology, mergedState, randomGen, consensus.BestSeed,
+		shared.AllocationConfig{Stopping: config.Stopping, NoNeighbourWeightCache: config.NoNeighbourWeightCache})
+
+	// Give the labels of the merged vertices to the vertices they were merged from
+	state := consensus.Expand(mergedState)
+	state.ShardWorkloads = consensus.Topology.CalculateShardWorkloads(state)
+
+	// The fitness is the same on both graphs, but it is worked out again on the graph the seeds were run on
+	result.WorkloadImbalance, result.CrossShardWorkload, result.Fitness = consensus.Topology.CalculateFitness(state,
+		alpha)
+	result.Metrics = consensus.Topology.CalculateMetrics(state, alpha)
+	result.Seed = -1
+	result.Consensus = true
+	result.State = state
+	result.Topology = consensus.Topology
+
+	return result
+}
+
 // The CLPA function
-func runClpa(alpha float64, beta float64, tau int, rho int, graph *shared.Graph,
-	randomGen *rand.Rand, seed int64) *shared.EpochResult {
+func runClpa(ctx context.Context, alpha float64, beta float64, tau int, rho int, topology *shared.Topology,
+	state *shared.LabelState, randomGen *rand.Rand, seed int64, config shared.AllocationConfig) *shared.EpochResult {
+
+	// The seed race and stopping rules are taken from the config
+	race := config.Race
+	rules := shared.DefaultStoppingRules()
+	if config.Stopping != nil {
+		rules = *config.Stopping
+	}
+
+	// Cache the weight of the edges of each vertex to each shard, which the moves keep up to date, to score faster
+	if !config.NoNeighbourWeightCache {
+		state.NeighbourWeights = topology.CalculateNeighbourWeights(state)
+	}
+
+	// In debug mode, check the bookkeeping of the CLPA as it runs, starting with the edges and the initial workloads
+	state.Checker = shared.NewInvariantChecker(config.InvariantChecks)
+	state.Checker.CheckTopologyEdges(topology)
+	if state.Checker.EveryIteration() {
+		checkInvariants(topology, state, -1)
+	}
 
 	convergenceIter := -1 // Default value if no convergence within iterations
+	stopReason := ""
+
+	// Keep track of the labels of the iterations, to find when a stopping rule fires
+	monitor := rules.NewMonitor(state.Labels)
+
+	// Keep track of the best labelling, in case the iterations are cut short
+	tracker := shared.NewStateAnytimeTracker(ctx, topology, state, alpha)
+	interrupted := false
+
+	// Keep track of the fitness before the first iteration and after it, to measure the effect of the initial placement
+	_, _, initialFitness := topology.CalculateFitness(state, alpha)
+	firstIterFitness := initialFitness
+
+	// Keep track of whether the seed was abandoned during seed racing, and of the time it ran for
+	pruned := false
+	start := time.Now()
 
 	// Carry out CLPA iterations
 	for iter := 0; iter < tau; iter++ {
 
-		// create a map with all old labels - meaning labels of vertices before current CLPA iteration
-		oldLabels := make(map[string]int)
-		for id, vertex := range graph.Vertices {
-			oldLabels[id] = vertex.Label
+		// Stop the iterations if the context was cancelled or its deadline was exceeded
+		if shared.Cancelled(ctx) {
+			interrupted = true
+			break
 		}
+		state.Checker.StartIteration(iter)
 
 		// Perform an iteration of CLPA
-		clpaIteration(graph, beta, randomGen, rho)
+		clpaIteration(ctx, topology, state, beta, randomGen, rho)
+
+		// If the iteration was cut short, it is not taken into account for convergence
+		if shared.Cancelled(ctx) {
+			interrupted = true
+			break
+		}
+		if state.Checker.EveryIteration() {
+			checkInvariants(topology, state, -1)
+		}
+		tracker.RecordState(topology, state)
+		if iter == 0 {
+			_, _, firstIterFitness = topology.CalculateFitness(state, alpha)
+		}
 
 		// If convergenceIter is not -1, then it was already found that the algorithm converged
 		// CLPA iterations should still continue, as stipulated in the paper
 		if convergenceIter == -1 {
-			converged := true
-			for id, vertex := range graph.Vertices {
-				if oldLabels[id] != vertex.Label {
-					converged = false
-					break
-				}
+			iterationFitness := 0.0
+			if monitor.NeedsFitness() {
+				_, _, iterationFitness = topology.CalculateFitness(state, alpha)
 			}
-			if converged {
+			if reason := monitor.Observe(state.Labels, iterationFitness); reason != "" {
 
-				// Record the iteration number when convergence occurred (1-based)
+				// Record the iteration number when a stopping rule fired (1-based), and the rule
 				convergenceIter = iter + 1
+				stopReason = reason
 			}
 		}
 
+		// Report the fitness to the seed race every few iterations, and stop if the seed fell behind
+		if race != nil && race.IsCheckpoint(iter+1) {
+			_, _, iterationFitness := topology.CalculateFitness(state, alpha)
+			if !race.Checkpoint(seed, iter+1, iterationFitness, time.Since(start), tau-iter-1) {
+				pruned = true
+				break
+			}
+		}
+
+	}
+
+	// The cache is only kept up to date by the CLPA, so it is dropped once the iterations are over, as are the checks
+	state.NeighbourWeights = nil
+	state.Checker = nil
+
+	// If the iterations were cut short, go back to the best labelling found so far
+	if interrupted && tracker.RestoreState(topology, state) {
+		state.ShardWorkloads = topology.CalculateShardWorkloads(state)
 	}
 
 	// Calculate the workload imbalance, number of cross shard transactions and fitness of the partitioning
-	workloadImbalance, crossShardWorkload, fitness := shared.CalculateFitness(graph, alpha)
+	workloadImbalance, crossShardWorkload, fitness := topology.CalculateFitness(state, alpha)
 
 	// Return the results of the epoch
 	return &shared.EpochResult{
@@ -167,27 +337,40 @@ func runClpa(alpha float64, beta float64, tau int, rho int, graph *shared.Graph,
 		WorkloadImbalance:  workloadImbalance,
 		CrossShardWorkload: crossShardWorkload,
 		ConvergenceIter:    convergenceIter,
+		StopReason:         stopReason,
+		InitialFitness:     initialFitness,
+		FirstIterFitness:   firstIterFitness,
+		Metrics:            topology.CalculateMetrics(state, alpha),
+		Interrupted:        interrupted,
+		Pruned:             pruned,
 	}
 
 }
 
 // The function that performs an iteration through all vertices and assigns shards
-func clpaIteration(graph *shared.Graph, beta float64, randomGen *rand.Rand, rho int) {
+func clpaIteration(ctx context.Context, topology *shared.Topology, state *shared.LabelState, beta float64,
+	randomGen *rand.Rand, rho int) {
 
 	// Get a random order to use for this CLPA iteration
-	sortedVertices := setVerticesOrder(graph, randomGen)
+	sortedVertices := setVerticesOrder(topology, randomGen)
 
 	// Iterate through each vertex in some order
-	for _, vertex := range sortedVertices {
+	for i, vertex := range sortedVertices {
+
+		// Every so often, stop the iteration if the context was cancelled
+		// Each move keeps the graph valid, so the iteration can stop after any vertex
+		if i%shared.ContextCheckInterval == 0 && shared.Cancelled(ctx) {
+			return
+		}
 
 		// Calculate the score of shards with respect to current vertex
-		scores := calculateScores(graph, vertex, beta)
+		scores := calculateScores(topology, state, vertex, beta)
 
 		// Get the ID of the best shard with respect to current vertex
 		bestShard := getBestShard(scores, randomGen)
 
 		// Move current vertex to new best shard
-		moveVertex(graph, vertex, bestShard, rho)
+		moveVertex(topology, state, vertex, bestShard, rho)
 
 	}
 }
@@ -0,0 +1,24 @@
+package clpaparallel
+
+import (
+	"context"
+	"testing"
+
+	"example.com/shardinglpa/internal/testutil"
+	"example.com/shardinglpa/shared"
+)
+
+// Replays CLPA in parallel over the fixture epochs with fixed seeds, and pins the fitness of every seed, and the workloads
+// and labels of the best graph of every epoch
+func TestShardAllocationGolden(t *testing.T) {
+
+	seeds := []int64{11, 22, 33}
+
+	out := testutil.ReplaySeeds(t, func(epoch int, graph *shared.Graph) ([]*shared.EpochResult,
+		map[string]*shared.Vertex) {
+		return ShardAllocationWithConfig(context.Background(), testutil.FixtureDir, 4, epoch, graph, 0.5, 0.5, 20,
+			50, seeds, shared.AllocationConfig{})
+	})
+
+	testutil.CheckGolden(t, "shard_allocation", out)
+}
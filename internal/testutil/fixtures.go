@@ -0,0 +1,57 @@
+package testutil
+
+import (
+	"fmt"
+	"math/rand"
+	"path/filepath"
+	"runtime"
+
+	"example.com/shardinglpa/shared"
+)
+
+/*
+Helpers shared by the tests of the variants of the CLPA: the fixture epochs, random transactions and topologies, the
+cost models the properties are checked under, the golden files, and the property checks of the moves and scores.
+
+Each variant builds its own graphs and label states from the transactions, with its own functions passed in to the
+helpers, and only keeps in its own tests the assertions that are specific to it.
+*/
+
+// Number of fixture epochs, read from epoch_1.csv to epoch_<FixtureEpochs>.csv in FixtureDir
+const FixtureEpochs = 3
+
+// Directory of the small fixture epochs shared by the tests of all variants, with a trailing slash
+var FixtureDir = fixtureDir()
+
+// Function to find the fixture directory from the location of this file, so it does not depend on the package tested
+func fixtureDir() string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..", "testdata", "epochs") + string(filepath.Separator)
+}
+
+// The cost models the properties are checked under, where no cost model is the cost model of the paper, which
+// skips looking up the direction of the transactions in paperclpa
+var CostModels = []struct {
+	Name  string
+	Model shared.CostModel
+}{
+	{"none", nil},
+	{"paper", shared.PaperCostModel},
+	{"sender-only", shared.SenderOnlyCostModel},
+	{"split-relay", shared.SplitRelayCostModel},
+	{"cross-shard-x3", shared.CrossShardMultiplierCostModel(3)},
+}
+
+// Function to generate the rows of random transactions between a number of vertices, including self-loops and
+// repeated transactions, with a header row
+func RandomRows(randomGen *rand.Rand, numberOfVertices int, numberOfTransactions int) [][]string {
+
+	rows := [][]string{{"from", "to"}}
+	for i := 0; i < numberOfTransactions; i++ {
+		from := fmt.Sprintf("v%02d", randomGen.Intn(numberOfVertices))
+		to := fmt.Sprintf("v%02d", randomGen.Intn(numberOfVertices))
+		rows = append(rows, []string{from, to})
+	}
+
+	return rows
+}
@@ -0,0 +1,142 @@
+package testutil
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"testing"
+
+	"example.com/shardinglpa/shared"
+)
+
+// Flag to rewrite the golden files with the output of the current code, instead of comparing against it
+// Run "go test ./<package> -update" after a change to the algorithm that is meant to change its results
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// Type of a function that allocates a fixture epoch with several seeds, given the graph of the previous epoch (nil
+// for the first one), and returns the results of the seeds and the inactive vertices
+type SeedsAllocation func(epoch int, graph *shared.Graph) ([]*shared.EpochResult, map[string]*shared.Vertex)
+
+/*
+Function to replay an allocation with several seeds over the fixture epochs, and describe the results of every epoch
+
+The best graph of each epoch, with the inactive vertices added back to it, is carried over to the next epoch. The test
+fails if an epoch has no results, or if the workloads of its best graph do not match the workloads worked out from
+scratch.
+*/
+func ReplaySeeds(t *testing.T, allocate SeedsAllocation) string {
+	t.Helper()
+
+	var graph *shared.Graph
+	var out strings.Builder
+
+	for epoch := 1; epoch <= FixtureEpochs; epoch++ {
+
+		seedsResults, inactiveVertices := allocate(epoch, graph)
+		if seedsResults == nil {
+			t.Fatalf("No results for epoch %d", epoch)
+		}
+
+		// Get the best graph, and add inactive vertices back to it for the next epoch
+		graph = shared.GetBestGraph(seedsResults)
+		for id, vertex := range inactiveVertices {
+			graph.Vertices[id] = vertex
+		}
+
+		// The workloads kept by the CLPA must match the workloads worked out from scratch
+		topology := shared.NewTopology(graph)
+		if workloads := topology.CalculateShardWorkloads(topology.NewLabelState()); !slices.Equal(workloads,
+			graph.ShardWorkloads) {
+			t.Errorf("Epoch %d: workloads are %v, but %v from scratch", epoch, graph.ShardWorkloads, workloads)
+		}
+
+		out.WriteString(DescribeSeeds(epoch, seedsResults, graph))
+	}
+
+	return out.String()
+}
+
+// Function to describe the results of the seeds of an epoch and the graph picked, one fact per line
+func DescribeSeeds(epoch int, seedsResults []*shared.EpochResult, graph *shared.Graph) string {
+
+	var out strings.Builder
+
+	fmt.Fprintf(&out, "epoch %d\n", epoch)
+	for _, result := range seedsResults {
+		fmt.Fprintf(&out, "seed %d fitness %v imbalance %v cross %d convergence %d\n", result.Seed, result.Fitness,
+			result.WorkloadImbalance, result.CrossShardWorkload, result.ConvergenceIter)
+	}
+	describeGraph(&out, graph)
+
+	return out.String()
+}
+
+// Function to describe the result of an epoch run with a single seed and its graph, one fact per line
+func DescribeResult(epoch int, result *shared.EpochResult) string {
+
+	var out strings.Builder
+
+	fmt.Fprintf(&out, "epoch %d\n", epoch)
+	fmt.Fprintf(&out, "fitness %v imbalance %v cross %d convergence %d\n", result.Fitness, result.WorkloadImbalance,
+		result.CrossShardWorkload, result.ConvergenceIter)
+	describeGraph(&out, result.Graph)
+
+	return out.String()
+}
+
+// Function to describe the workloads of a graph and the label of every vertex, in order of ID
+func describeGraph(out *strings.Builder, graph *shared.Graph) {
+
+	fmt.Fprintf(out, "workloads %v\n", graph.ShardWorkloads)
+
+	ids := make([]string, 0, len(graph.Vertices))
+	for id := range graph.Vertices {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		fmt.Fprintf(out, "label %s %d\n", id, graph.Vertices[id].Label)
+	}
+}
+
+// Function to compare the output with the golden file of the test, in the testdata directory of the package tested,
+// or to rewrite the golden file with -update
+func CheckGolden(t *testing.T, name string, got string) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name+".golden")
+
+	if *update {
+		if err := os.MkdirAll("testdata", 0755); err != nil {
+			t.Fatalf("Failed to create testdata directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatalf("Failed to write golden file %s: %v", path, err)
+		}
+		return
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read golden file %s (run with -update to create it): %v", path, err)
+	}
+
+	// Report the first line that differs, since the whole output is long
+	wantLines, gotLines := strings.Split(string(want), "\n"), strings.Split(got, "\n")
+	for i := 0; i < max(len(wantLines), len(gotLines)); i++ {
+		var wantLine, gotLine string
+		if i < len(wantLines) {
+			wantLine = wantLines[i]
+		}
+		if i < len(gotLines) {
+			gotLine = gotLines[i]
+		}
+		if wantLine != gotLine {
+			t.Fatalf("Output differs from %s at line %d:\n  want: %s\n  got:  %s", path, i+1, wantLine, gotLine)
+		}
+	}
+}
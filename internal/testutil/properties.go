@@ -0,0 +1,284 @@
+package testutil
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"sort"
+	"testing"
+
+	"example.com/shardinglpa/shared"
+)
+
+// Interface to the labelling of a random graph kept by a variant of the CLPA, which the properties of the moves are
+// checked on, where the vertices are numbered from 0 in order of ID
+type Labelling interface {
+	NumberOfVertices() int
+	NumberOfShards() int
+	Label(v int) int
+	Counter(v int) int                 // Number of times the vertex updated its label
+	Workloads() []int                  // Workloads kept incrementally by the moves
+	Move(v int, newShard int, rho int) // Move the vertex with the moveVertex function of the variant
+}
+
+// Struct to check the moves of a variant that keeps a label state on a shared topology
+type stateLabelling struct {
+	topology *shared.Topology
+	state    *shared.LabelState
+	move     func(topology *shared.Topology, state *shared.LabelState, v int, newShard int, rho int)
+}
+
+// Function to wrap the label state of a variant on a shared topology, and its function to move a vertex
+// The invariant checks are started after every move, and the edges are checked right away
+func NewStateLabelling(topology *shared.Topology, state *shared.LabelState,
+	move func(topology *shared.Topology, state *shared.LabelState, v int, newShard int, rho int)) Labelling {
+
+	state.Checker = shared.NewInvariantChecker(shared.CheckEveryMove)
+	state.Checker.CheckTopologyEdges(topology)
+
+	return &stateLabelling{topology: topology, state: state, move: move}
+}
+
+func (l *stateLabelling) NumberOfVertices() int { return len(l.topology.Vertices) }
+func (l *stateLabelling) NumberOfShards() int   { return l.topology.NumberOfShards }
+func (l *stateLabelling) Label(v int) int       { return l.state.Labels[v] }
+func (l *stateLabelling) Counter(v int) int     { return l.state.LabelUpdateCounter[v] }
+func (l *stateLabelling) Workloads() []int      { return l.state.ShardWorkloads }
+func (l *stateLabelling) Move(v int, newShard int, rho int) {
+	l.move(l.topology, l.state, v, newShard, rho)
+}
+
+// Struct to check the moves of a variant that labels the vertices of a graph
+type graphLabelling struct {
+	graph    *shared.Graph
+	vertices []*shared.Vertex
+	move     func(graph *shared.Graph, vertex *shared.Vertex, newShard int, rho int)
+}
+
+// Function to wrap a graph labelled by a variant, and its function to move a vertex
+// The invariant checks are started after every move, and the edges are checked right away
+func NewGraphLabelling(graph *shared.Graph,
+	move func(graph *shared.Graph, vertex *shared.Vertex, newShard int, rho int)) Labelling {
+
+	graph.Checker = shared.NewInvariantChecker(shared.CheckEveryMove)
+	graph.Checker.CheckGraphEdges(graph)
+
+	ids := make([]string, 0, len(graph.Vertices))
+	for id := range graph.Vertices {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	vertices := make([]*shared.Vertex, len(ids))
+	for i, id := range ids {
+		vertices[i] = graph.Vertices[id]
+	}
+
+	return &graphLabelling{graph: graph, vertices: vertices, move: move}
+}
+
+func (l *graphLabelling) NumberOfVertices() int { return len(l.vertices) }
+func (l *graphLabelling) NumberOfShards() int   { return l.graph.NumberOfShards }
+func (l *graphLabelling) Label(v int) int       { return l.vertices[v].Label }
+func (l *graphLabelling) Counter(v int) int     { return l.vertices[v].LabelUpdateCounter }
+func (l *graphLabelling) Workloads() []int      { return l.graph.ShardWorkloads }
+func (l *graphLabelling) Move(v int, newShard int, rho int) {
+	l.move(l.graph, l.vertices[v], newShard, rho)
+}
+
+// Function to run a step and return the invariant it violated, or an empty string if it violated none
+func violation(step func()) (message string) {
+	defer func() {
+		if r := recover(); r != nil {
+			message = fmt.Sprint(r)
+		}
+	}()
+	step()
+	return ""
+}
+
+/*
+Function to check that moving random vertices of random graphs one after the other keeps the bookkeeping of a
+variant right, under every cost model
+
+The labellings are built by newLabelling with NewStateLabelling or NewGraphLabelling, which run the invariant checks
+after every move, so every move compares the workloads kept incrementally, and the cached neighbour weights if any,
+with the ones worked out from scratch.
+*/
+func CheckMovesKeepBookkeeping(t *testing.T,
+	newLabelling func(randomGen *rand.Rand, model shared.CostModel) Labelling) {
+	t.Helper()
+
+	for _, costModel := range CostModels {
+		randomGen := rand.New(rand.NewSource(1))
+
+		for trial := 0; trial < 20; trial++ {
+			var labelling Labelling
+			build := func() { labelling = newLabelling(randomGen, costModel.Model) }
+			if message := violation(build); message != "" {
+				t.Fatalf("%s, trial %d: %s", costModel.Name, trial, message)
+			}
+
+			for move := 0; move < 100; move++ {
+				v := randomGen.Intn(labelling.NumberOfVertices())
+				newShard := randomGen.Intn(labelling.NumberOfShards())
+				if message := violation(func() { labelling.Move(v, newShard, 1000) }); message != "" {
+					t.Fatalf("%s, trial %d, move %d: %s", costModel.Name, trial, move, message)
+				}
+			}
+		}
+	}
+}
+
+// Function to check that a vertex only moves to another shard, and only until it has updated its label rho times
+// The labelling is built by newLabelling with NewStateLabelling or NewGraphLabelling, which run the invariant checks
+// after every move
+func CheckMoveRespectsRho(t *testing.T, newLabelling func() Labelling) {
+	t.Helper()
+
+	labelling := newLabelling()
+
+	v := 0
+	rho := 2
+	workloads := slices.Clone(labelling.Workloads())
+
+	// Moving to the current shard changes nothing
+	labelling.Move(v, labelling.Label(v), rho)
+	if labelling.Counter(v) != 0 || !slices.Equal(workloads, labelling.Workloads()) {
+		t.Fatalf("Moving vertex to its own shard changed its counter to %d or the workloads to %v",
+			labelling.Counter(v), labelling.Workloads())
+	}
+
+	// Each move to another shard counts towards rho
+	for i := 1; i <= rho; i++ {
+		newShard := (labelling.Label(v) + 1) % labelling.NumberOfShards()
+		labelling.Move(v, newShard, rho)
+		if labelling.Label(v) != newShard || labelling.Counter(v) != i {
+			t.Fatalf("Move %d: label is %d and counter is %d, expected %d and %d", i, labelling.Label(v),
+				labelling.Counter(v), newShard, i)
+		}
+	}
+
+	// Once the vertex has updated its label rho times, it stays where it is
+	label := labelling.Label(v)
+	workloads = slices.Clone(labelling.Workloads())
+	labelling.Move(v, (label+1)%labelling.NumberOfShards(), rho)
+	if labelling.Label(v) != label || labelling.Counter(v) != rho || !slices.Equal(workloads,
+		labelling.Workloads()) {
+		t.Fatalf("Vertex moved after reaching rho: label %d, counter %d, workloads %v", labelling.Label(v),
+			labelling.Counter(v), labelling.Workloads())
+	}
+}
+
+/*
+Function to check the scores of a variant that can cache the weight of the edges of each vertex to each shard, on
+random topologies built by newTopology
+
+The scores looked up in the cache must be the same as the scores worked out by scanning the edges, and a shard must
+only have a score if the vertex has an edge to it. The scores without a penalty (beta 0) are then passed with the
+weights of the edges of the vertex to each shard to unpenalised, which returns an error if they are wrong for the
+variant.
+*/
+func CheckCachedScores(t *testing.T, newTopology func(randomGen *rand.Rand) (*shared.Topology, *shared.LabelState),
+	calculateScores func(topology *shared.Topology, state *shared.LabelState, v int, beta float64) []*float64,
+	unpenalised func(scores []*float64, weights []int) error) {
+	t.Helper()
+
+	randomGen := rand.New(rand.NewSource(4))
+
+	for trial := 0; trial < 20; trial++ {
+		topology, state := newTopology(randomGen)
+		neighbourWeights := topology.CalculateNeighbourWeights(state)
+
+		for v := range topology.Vertices {
+			for _, beta := range []float64{0, 0.5, 1} {
+
+				state.NeighbourWeights = nil
+				scanned := calculateScores(topology, state, v, beta)
+				state.NeighbourWeights = neighbourWeights
+				cached := calculateScores(topology, state, v, beta)
+
+				for shard := range scanned {
+					if (scanned[shard] == nil) != (neighbourWeights[v][shard] == 0) {
+						t.Fatalf("Trial %d, vertex %d, shard %d: score is %v, but the weight to the shard is %d",
+							trial, v, shard, scanned[shard], neighbourWeights[v][shard])
+					}
+					if (scanned[shard] == nil) != (cached[shard] == nil) ||
+						scanned[shard] != nil && *scanned[shard] != *cached[shard] {
+						t.Fatalf("Trial %d, vertex %d, shard %d, beta %v: scanned score differs from cached score",
+							trial, v, shard, beta)
+					}
+				}
+
+				if beta == 0 {
+					if err := unpenalised(scanned, neighbourWeights[v]); err != nil {
+						t.Fatalf("Trial %d, vertex %d: %v", trial, v, err)
+					}
+				}
+			}
+		}
+	}
+}
+
+/*
+Function to check the workloads of random graphs labelled by a variant, under every cost model: the workloads of the
+graph and of its shared topology are the same, the total workload is the cost of every edge counted once, and renaming
+the shards renames their workloads
+*/
+func CheckWorkloadProperties(t *testing.T, newGraph func(randomGen *rand.Rand, model shared.CostModel) *shared.Graph) {
+	t.Helper()
+
+	for _, costModel := range CostModels {
+		randomGen := rand.New(rand.NewSource(3))
+
+		for trial := 0; trial < 20; trial++ {
+			graph := newGraph(randomGen, costModel.Model)
+			model := graph.WorkloadCostModel().(shared.LinearCostModel)
+			workloads := shared.CalculateShardWorkloads(graph)
+
+			topology := shared.NewTopology(graph)
+			if topologyWorkloads := topology.CalculateShardWorkloads(topology.NewLabelState()); !slices.Equal(
+				topologyWorkloads, workloads) {
+				t.Fatalf("%s, trial %d: workloads of the topology are %v, but %v for the graph", costModel.Name,
+					trial, topologyWorkloads, workloads)
+			}
+
+			// Work out the total cost of the edges, each counted once
+			expectedTotal := 0
+			for id, vertex := range graph.Vertices {
+				for neighbourID, weight := range vertex.Edges {
+					if neighbourID < id {
+						continue
+					}
+					if vertex.Label == graph.Vertices[neighbourID].Label {
+						expectedTotal += model.IntraShard * weight
+					} else {
+						expectedTotal += (model.Sender + model.Receiver) * weight
+					}
+				}
+			}
+			total := 0
+			for _, workload := range workloads {
+				total += workload
+			}
+			if total != expectedTotal {
+				t.Fatalf("%s, trial %d: total workload is %d, expected %d", costModel.Name, trial, total,
+					expectedTotal)
+			}
+
+			// Rename the shards by a random permutation
+			permutation := randomGen.Perm(graph.NumberOfShards)
+			for _, vertex := range graph.Vertices {
+				vertex.Label = permutation[vertex.Label]
+			}
+			renamedWorkloads := shared.CalculateShardWorkloads(graph)
+			for shard, workload := range workloads {
+				if renamedWorkloads[permutation[shard]] != workload {
+					t.Fatalf("%s, trial %d: workload of shard %d is %d, but %d once renamed to shard %d",
+						costModel.Name, trial, shard, workload, renamedWorkloads[permutation[shard]],
+						permutation[shard])
+				}
+			}
+		}
+	}
+}
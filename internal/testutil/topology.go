@@ -0,0 +1,33 @@
+package testutil
+
+import (
+	"math/rand"
+
+	"example.com/shardinglpa/shared"
+)
+
+/*
+Function to build a random graph with random labels, including self-loops and repeated transactions, and return its
+topology and a label state with the workloads worked out from scratch
+
+The graph is built by updateGraph and the new vertices are labelled by initialise, which are the functions of the
+variant tested that keeps a label state on a shared topology.
+*/
+func RandomTopology(randomGen *rand.Rand, numberOfVertices int, numberOfTransactions int, numberOfShards int,
+	model shared.CostModel, updateGraph func(rows [][]string, graph *shared.Graph) *shared.Graph,
+	initialise func(topology *shared.Topology, state *shared.LabelState, randomGen *rand.Rand)) (*shared.Topology,
+	*shared.LabelState) {
+
+	graph := updateGraph(RandomRows(randomGen, numberOfVertices, numberOfTransactions), &shared.Graph{
+		Vertices:       make(map[string]*shared.Vertex),
+		NumberOfShards: numberOfShards,
+		CostModel:      model,
+	})
+
+	topology := shared.NewTopology(graph)
+	state := topology.NewLabelState()
+	initialise(topology, state, randomGen)
+	state.ShardWorkloads = topology.CalculateShardWorkloads(state)
+
+	return topology, state
+}
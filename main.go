@@ -7,11 +7,14 @@ import (
 	"log"
 	"math/rand"
 	"os"
+	"path/filepath"
 	"strconv"
 	"time"
 
+	"example.com/shardinglpa/mylpa"
 	"example.com/shardinglpa/paperclpa"
 	"example.com/shardinglpa/shared"
+	"example.com/shardinglpa/simulator"
 )
 
 func main() {
@@ -25,6 +28,10 @@ func main() {
 	multi := io.MultiWriter(os.Stdout, logFile)
 	log.SetOutput(multi)
 
+	// To check the workloads kept incrementally by a variant of the CLPA against the workloads worked out from scratch
+	// after every move, for debugging, set InvariantChecks to shared.CheckEveryMove (or shared.CheckEveryIteration) in
+	// the shared.AllocationConfig of the allocation, which paperclpa takes through paperclpa.NewGraph
+
 	// Run this commented out function call to extract the epochs from the original dataset
 	//shared.ExtractEpochs()
 
@@ -32,6 +39,25 @@ func main() {
 	//writeEpochStatistics(30, "shared/epochs/low_arrival_rate/", "datastats/low_arrival_rate_statistics.csv")
 	//writeEpochStatistics(12, "shared/epochs/high_arrival_rate/", "datastats/high_arrival_rate_statistics.csv")
 
+	// Run this commented out function call to export the account-to-shard allocation of each epoch (as found by
+	// My LPA), and the commented out call after it to list the accounts that moved shard between two epochs
+	//exportEpochAllocations(30, 8, "shared/epochs/low_arrival_rate/", "allocations/low_arrival_rate", "csv")
+	//diffAllocations("allocations/low_arrival_rate/epoch_1.csv", "allocations/low_arrival_rate/epoch_2.csv",
+	//	"allocations/low_arrival_rate/diff_1_2.csv")
+
+	// Run this commented out function call to replay the transactions of an epoch against an exported allocation,
+	// to get the throughput, queue lengths and confirmation latencies of each shard
+	//simulateEpoch("shared/epochs/low_arrival_rate/epoch_2.csv", "allocations/low_arrival_rate/epoch_1.csv", 8,
+	//	"simulation/low_arrival_rate_epoch_2.csv")
+
+	// Run this commented out function call to start the shard allocation server, which answers shard lookups
+	// and runs re-allocations over HTTP (see the server package for the API)
+	//log.Fatal(server.ListenAndServe("localhost:8080", 8))
+
+	// Run this commented out function call to run the online mode, which places new accounts as their transactions
+	// are read (here from stdin), and runs My LPA at the end of each epoch
+	//online.RunFile(context.Background(), "-", "online/online_results.csv", online.DefaultConfig())
+
 	// TESTING - cpu profiling
 	/*
 		go func() {
@@ -67,6 +93,51 @@ func main() {
 	// This tests CLPA as in paper vs Parallel CLPA vs My LPA for 30 times each test
 	//threepart.RunTestSuite(30)
 
+	// Run the Test Suite 'My LPA vs My LPA with Vote Memory'
+	// This tests whether carrying the votes of My LPA over between epochs makes the allocation more stable
+	// for 30 times each test
+	//votememory.RunTestSuite(30)
+
+	// Run the Test Suite 'Predictive Evaluation of My LPA'
+	// This tests how the allocation of each epoch performs on the transactions of the next epoch, compared to the
+	// transactions it was found for, for 30 times each test
+	//predictive.RunTestSuite(30)
+
+	// Run the Test Suite 'Initial Placement of New Accounts'
+	// This tests how the shard new accounts are first placed in affects the fitness and the speed of convergence
+	// of CLPA and My LPA, for 30 times each test
+	//placement.RunTestSuite(30)
+
+	// Run the Test Suite 'My LPA vs My LPA with Consensus of Seeds'
+	// This tests whether picking the consensus of all the seeds rather than the best seed makes the allocation
+	// more stable, for 30 times each test
+	//consensus.RunTestSuite(30)
+
+	// Run the Test Suite 'Memetic Optimiser seeded by My LPA'
+	// This tests how much better the allocation can get beyond the best seed of My LPA, by running a memetic
+	// optimiser on the labellings of all the seeds, for 30 times each test
+	//memetic.RunTestSuite(30)
+
+	// Run the Test Suite 'Greedy vs Simulated Annealing Label Selection'
+	// This tests whether sampling the shard of each vertex by simulated annealing, instead of always picking the shard
+	// with the highest score, helps CLPA and My LPA escape early local optima, for 30 times each test
+	//annealing.RunTestSuite(30)
+
+	// Run the Test Suite 'Vote Policies of My LPA'
+	// This tests how the policy deciding when a vertex of My LPA moves, given its votes, affects the allocation
+	// for 30 times each test
+	//votepolicy.RunTestSuite(30)
+
+	// Run the Test Suite 'Stopping Rules of CLPA and My LPA'
+	// This tests how stopping on few moved vertices, a fitness plateau or oscillating vertices, instead of only once
+	// no label changes, affects the allocation and the number of iterations run, for 30 times each test
+	//stopping.RunTestSuite(30)
+
+	// Run the Test Suite 'Scanned vs Cached Neighbour Weights in Scoring'
+	// This tests how much faster CLPA in parallel and My LPA run at 16 and 24 shards when the weight of the edges of
+	// each vertex to each shard is cached, instead of scanned for every shard, for 30 times each test
+	//scorecache.RunTestSuite(30)
+
 }
 
 // Generates graph statistics for each epoch and writes them to a CSV file
@@ -156,3 +227,111 @@ func writeEpochStatistics(numberOfEpochs int, datasetDir string, outputFilePath
 	log.Println("Dataset Statistics written to CSV successfully")
 
 }
+
+// Runs My LPA over the epochs and exports the account-to-shard allocation of each epoch to the output directory
+// The format is either "csv" or "json"
+func exportEpochAllocations(numberOfEpochs int, numberOfShards int, datasetDir string, outputDir string, format string) {
+
+	if err := os.MkdirAll(outputDir, 0755); err != nil {
+		log.Printf("Error creating output directory: %v\n", err)
+		return
+	}
+
+	// The same settings as in the tests
+	alpha, beta, tau, rho := 0.5, 0.5, 100, 50
+
+	var graph *shared.Graph = nil
+	nextSeedIndex := 0
+
+	for epoch := 1; epoch <= numberOfEpochs; epoch++ {
+
+		// Get the random seeds
+		seeds, err := mylpa.GetSeeds("mylpa/seeds.csv", 8, nextSeedIndex)
+		if err != nil {
+			log.Printf("Failed to load seeds: %v", err)
+			return
+		}
+		nextSeedIndex += len(seeds)
+
+		seedsResults, inactiveVertices := mylpa.ShardAllocation(datasetDir, numberOfShards, epoch, graph,
+			alpha, beta, tau, rho, seeds)
+		if seedsResults == nil {
+			continue
+		}
+
+		// Get the best graph, and add the inactive vertices back so that every account is exported
+		graph = shared.GetBestGraph(seedsResults)
+		for id, vertex := range inactiveVertices {
+			graph.Vertices[id] = vertex
+		}
+
+		outputFilePath := filepath.Join(outputDir, fmt.Sprintf("epoch_%d.%s", epoch, format))
+		if err := shared.ExportAllocation(outputFilePath, graph, epoch); err != nil {
+			log.Printf("Error exporting allocation of epoch %d: %v\n", epoch, err)
+			return
+		}
+	}
+
+	// Log success message
+	log.Println("Allocations exported successfully")
+}
+
+// Lists the accounts that moved shard between two exported allocations, and writes them to a CSV file
+func diffAllocations(beforeFilePath string, afterFilePath string, outputFilePath string) {
+
+	before, err := shared.LoadAllocation(beforeFilePath)
+	if err != nil {
+		log.Printf("Error loading allocation: %v\n", err)
+		return
+	}
+
+	after, err := shared.LoadAllocation(afterFilePath)
+	if err != nil {
+		log.Printf("Error loading allocation: %v\n", err)
+		return
+	}
+
+	moves := shared.DiffAllocations(before, after)
+	if err := shared.WriteAllocationDiff(outputFilePath, moves); err != nil {
+		log.Printf("Error writing allocation diff: %v\n", err)
+		return
+	}
+
+	// Log success message
+	log.Printf("%d accounts moved shard from epoch %d to epoch %d\n", len(moves), before.Epoch, after.Epoch)
+}
+
+// Replays the transactions of an epoch against an exported allocation on a chain with the given number of shards,
+// and writes the statistics of each shard
+func simulateEpoch(epochFilePath string, allocationFilePath string, numberOfShards int, outputFilePath string) {
+
+	rows, err := shared.ReadCSV(epochFilePath)
+	if err != nil {
+		log.Printf("Error reading CSV %s: %v\n", epochFilePath, err)
+		return
+	}
+
+	allocation, err := shared.LoadAllocation(allocationFilePath)
+	if err != nil {
+		log.Printf("Error loading allocation: %v\n", err)
+		return
+	}
+
+	config := simulator.DefaultConfig()
+	config.NumberOfShards = numberOfShards
+
+	result, err := simulator.Simulate(rows, allocation, config)
+	if err != nil {
+		log.Printf("Error simulating epoch: %v\n", err)
+		return
+	}
+
+	if err := simulator.WriteResult(outputFilePath, result); err != nil {
+		log.Printf("Error writing simulation results: %v\n", err)
+		return
+	}
+
+	// Log success message
+	log.Printf("Simulation finished: %.3f tx/s, mean latency %.3f s, p99 latency %.3f s\n",
+		result.Throughput, result.Latency.Mean, result.Latency.P99)
+}
@@ -5,7 +5,6 @@ import (
 	"log"
 	"math"
 	"math/rand"
-	"sort"
 
 	"example.com/shardinglpa/shared"
 )
@@ -34,10 +33,17 @@ func updateGraphFromRows(rows [][]string, graph *shared.Graph) *shared.Graph {
 	}
 
 	// The vertices from previous epoch are kept in the graph, but the edges and number of time updated are cleared
+	// With a sliding window, only the edges of the epochs that fall out of the window are removed
 	for _, vertex := range graph.Vertices {
-		vertex.Edges = make(map[string]int) // Reset edges
+		if graph.Window == nil {
+			vertex.Edges = make(map[string]int) // Reset edges
+			vertex.Sent = make(map[string]int)
+		}
 		vertex.LabelUpdateCounter = 0
 	}
+	if graph.Window != nil {
+		graph.Window.StartEpoch(graph)
+	}
 
 	for i, row := range rows {
 		// Skip the header
@@ -56,6 +62,7 @@ func updateGraphFromRows(rows [][]string, graph *shared.Graph) *shared.Graph {
 				ID:    from,
 				Label: -1,
 				Edges: make(map[string]int),
+				Sent:  make(map[string]int),
 			}
 		}
 		if _, exists := graph.Vertices[to]; !exists {
@@ -63,6 +70,7 @@ func updateGraphFromRows(rows [][]string, graph *shared.Graph) *shared.Graph {
 				ID:    to,
 				Label: -1,
 				Edges: make(map[string]int),
+				Sent:  make(map[string]int),
 			}
 		}
 
@@ -72,132 +80,199 @@ func updateGraphFromRows(rows [][]string, graph *shared.Graph) *shared.Graph {
 		if from != to {
 			graph.Vertices[to].Edges[from]++
 		}
+
+		// Keep track of the direction of the transaction, for cost models that charge the sender and receiver differently
+		graph.Vertices[from].Sent[to]++
+
+		// Record the transaction, so that its edge can be removed once the epoch falls out of the window
+		if graph.Window != nil {
+			graph.Window.Record(from, to)
+		}
 	}
 
 	return graph
 }
 
-// Function to set the label of the new vertices in the graph
-func initialiseNewVertices(graph *shared.Graph, randomGen *rand.Rand) *shared.Graph {
+// Function to set the label of the new vertices in the label state of a seed
+func initialiseNewVertices(topology *shared.Topology, state *shared.LabelState, randomGen *rand.Rand) {
 
-	// Collect keys and sort them, necessary to be deterministic
-	keys := make([]string, 0, len(graph.Vertices))
-	for k := range graph.Vertices {
-		keys = append(keys, k)
+	// The vertices of the topology are sorted by ID, which is necessary to be deterministic
+	var newVertices []int
+	for v := range topology.Vertices {
+		if state.Labels[v] == -1 {
+			newVertices = append(newVertices, v)
+		}
 	}
-	sort.Strings(keys)
 
-	// Assign random shards to each new vertex
-	for _, k := range keys {
-		vertex := graph.Vertices[k]
-		if vertex.Label == -1 {
-			vertex.Label = randomGen.Intn(graph.NumberOfShards)
-			vertex.LabelUpdateCounter = 0
-			vertex.LabelVotes = make(map[int]int)
-			vertex.LabelVotes[vertex.Label] = 1 // Initialize with a self-vote
+	// If the topology has a placement policy, it places all the new vertices at once
+	// Otherwise, assign random shards to each new vertex
+	if topology.Placement != nil {
+		topology.PlaceNewVertices(state, randomGen)
+	}
 
+	for _, v := range newVertices {
+		if topology.Placement == nil {
+			state.Labels[v] = randomGen.Intn(topology.NumberOfShards)
 		}
+		state.LabelUpdateCounter[v] = 0
+		state.LabelVotes[v] = make(map[int]float64)
+		state.LabelVotes[v][state.Labels[v]] = 1 // Initialize with a self-vote
 	}
+}
 
-	return graph
+/*
+Function to decay and cap the votes that the vertices of the graph carry over from the previous epoch.
+A decay of 1 keeps all the votes, while a decay of 0 forgets them.
+It is applied once per epoch, before the seeds copy the votes, to the vertices that are active in the epoch and
+also to the inactive ones. So a vertex that comes back after some epochs without transactions carries votes that
+were decayed once for every epoch that went by, rather than the votes of the last epoch it was active in.
+*/
+func decayCarriedVotes(topology *shared.Topology, inactiveVertices map[string]*shared.Vertex,
+	voteMemory *shared.VoteMemoryConfig) {
+
+	for _, vertex := range topology.Vertices {
+		decayVotes(vertex, voteMemory)
+	}
+	for _, vertex := range inactiveVertices {
+		decayVotes(vertex, voteMemory)
+	}
 }
 
-// Function to calculate from sratch the workload of each shard
-func calculateShardWorkloads(graph *shared.Graph) []int {
+// Function to decay and cap the votes a vertex carries over
+func decayVotes(vertex *shared.Vertex, voteMemory *shared.VoteMemoryConfig) {
 
-	workloads := make([]int, graph.NumberOfShards)
+	for shard, votes := range vertex.LabelVotes {
 
-	for _, v := range graph.Vertices { // Iterate through all vertices
-		for neighbourID, weight := range v.Edges { // Iterate through all neighbours
-			if v.Label == graph.Vertices[neighbourID].Label {
-				if v.ID < neighbourID { // Process undirected edge only once to avoid double counting
-					workloads[v.Label] += weight // Intra-shard tx
-				} else if v.ID == neighbourID {
-					workloads[v.Label] += weight // Self-loop (vertex connects to itself)
-				}
-			} else {
-				workloads[v.Label] += weight // Cross-shard tx
-			}
+		// Older votes count for less than the votes of the previous epoch
+		votes *= voteMemory.Decay
+
+		// Cap the votes, so that a vertex is still able to move away from a shard it stayed in for long
+		if voteMemory.MaxVotes > 0 && votes > voteMemory.MaxVotes {
+			votes = voteMemory.MaxVotes
+		}
+
+		vertex.LabelVotes[shard] = votes
+	}
+}
+
+// Function to copy the votes carried over by the vertices of the graph into the label state of a seed
+// Vertices that carry no votes are left with no vote map, to be initialised as usual
+func copyCarriedVotes(topology *shared.Topology, state *shared.LabelState) {
+
+	for v, vertex := range topology.Vertices {
+		if vertex.LabelVotes == nil {
+			continue
 		}
+
+		// Each seed needs its own copy, since the votes are updated during the CLPA iterations
+		votes := make(map[int]float64, len(vertex.LabelVotes))
+		for shard, count := range vertex.LabelVotes {
+			votes[shard] = count
+		}
+		state.LabelVotes[v] = votes
 	}
-	return workloads
 }
 
-func moveVertex(graph *shared.Graph, vertex *shared.Vertex, newShard int, rho int) {
+func moveVertex(topology *shared.Topology, state *shared.LabelState, v int, newShard int, rho int) {
 
 	// Old shard refers to the shard the vertex was in before the current CLPA iteration
-	oldShard := vertex.Label
+	oldShard := state.Labels[v]
 
 	// Exit the function if new shard is same as old, since vertex does not need to move
 	// Also, Exit the function if current vertex has reached its threshold for updating its label
-	if oldShard == newShard || vertex.LabelUpdateCounter >= rho {
+	if oldShard == newShard || state.LabelUpdateCounter[v] >= rho {
 		return
 	}
 
 	// The shard workloads are not calculated from scratch but rather updated since this is more efficient
-	intra, crossWithNew, crossWithOthers, special_intra := 0, 0, 0, 0
+	// The edges are grouped by the shard of the neighbour, and the workloads are updated by the cost model
+	var intra, crossWithNew, crossWithOthers, special_intra shared.EdgeSums
 
-	for neighbour, weight := range vertex.Edges {
-		if graph.Vertices[neighbour].Label == oldShard {
+	for _, neighbour := range topology.Neighbours[v] {
+		sent, received := neighbour.Sent, neighbour.Weight-neighbour.Sent
+		if state.Labels[neighbour.Index] == oldShard {
 			// special_intra keeps track of txs that create self-loops
-			if graph.Vertices[neighbour].ID == vertex.ID {
-				special_intra += weight
+			if neighbour.Index == v {
+				special_intra.Add(sent, received)
 			} else {
-				intra += weight
+				intra.Add(sent, received)
 			}
-		} else if graph.Vertices[neighbour].Label == newShard {
-			crossWithNew += weight
+		} else if state.Labels[neighbour.Index] == newShard {
+			crossWithNew.Add(sent, received)
 		} else {
-			crossWithOthers += weight
+			crossWithOthers.Add(sent, received)
+		}
+
+		// Keep the cached weight of the edges of the neighbour to each shard up to date
+		if state.NeighbourWeights != nil {
+			neighbourWeights := state.NeighbourWeights[neighbour.Index]
+			neighbourWeights[oldShard] -= neighbour.Weight
+			neighbourWeights[newShard] += neighbour.Weight
 		}
 	}
 
+	// Update the workloads of shards
+	shared.ApplyMove(topology.CostModel, state.ShardWorkloads, oldShard, newShard,
+		intra, crossWithNew, crossWithOthers, special_intra)
+
 	// Update the label of the vertex to the new shard
-	vertex.Label = newShard
+	state.Labels[v] = newShard
 
 	// Increment the counter for number of times the vertex has updated its label
-	vertex.LabelUpdateCounter++
+	state.LabelUpdateCounter[v]++
 
-	// Update the workloads of shards
-	graph.ShardWorkloads[oldShard] -= (crossWithNew + crossWithOthers + special_intra)
-	graph.ShardWorkloads[newShard] += crossWithOthers + intra + special_intra
+	// In debug mode, record the move, and check the workloads kept incrementally against the workloads worked out
+	// from scratch
+	state.Checker.Moved(topology.Vertices[v].ID)
+	if state.Checker.EveryMove() {
+		checkInvariants(topology, state, v)
+	}
+}
 
+// Function to run the invariant checks on the label state, if they are on
+// moved is the index of the vertex that just moved, or -1 if the checks run after an iteration
+func checkInvariants(topology *shared.Topology, state *shared.LabelState, moved int) {
+	state.Checker.CheckState(topology, state, topology.CalculateShardWorkloads(state), moved)
 }
 
 // Score function: calculate how much a shard scores with respect to a vertex
-func calculateScores(graph *shared.Graph, v *shared.Vertex, beta float64) []*float64 {
+func calculateScores(topology *shared.Topology, state *shared.LabelState, v int, beta float64) []*float64 {
 
 	// Find the minimum workload of a shard
-	minWorkload := graph.ShardWorkloads[0]
-	for _, w := range graph.ShardWorkloads {
+	minWorkload := state.ShardWorkloads[0]
+	for _, w := range state.ShardWorkloads {
 		if w < minWorkload {
 			minWorkload = w
 		}
 	}
 
 	// Find the maximum workload of a shard
-	maxWorkload := graph.ShardWorkloads[0]
-	for _, w := range graph.ShardWorkloads {
+	maxWorkload := state.ShardWorkloads[0]
+	for _, w := range state.ShardWorkloads {
 		if w > maxWorkload {
 			maxWorkload = w
 		}
 	}
 
 	// scores is a slice that will hold the score of each shard for this vertex
-	scores := make([]*float64, len(graph.ShardWorkloads))
+	scores := make([]*float64, len(state.ShardWorkloads))
 
 	// shard represents the variable 'k' in the equation (8) from the paper
-	for shard := 0; shard < graph.NumberOfShards; shard++ {
+	for shard := 0; shard < topology.NumberOfShards; shard++ {
 
 		// Calculate the edge weight contribution to the shard
 		edgeWeightWithShard := 0
 
 		/* The weight of edges between the vertex being considered (v) and other vertices that reside in
-		the shard being considered (shard) is calculated.
+		the shard being considered (shard) is looked up in the cache, or calculated if there is no cache.
 		v represents 'i' in the equation (8) */
-		for neighbour, weight := range v.Edges {
-			if graph.Vertices[neighbour].Label == shard {
-				edgeWeightWithShard += weight
+		if state.NeighbourWeights != nil {
+			edgeWeightWithShard = state.NeighbourWeights[v][shard]
+		} else {
+			for _, neighbour := range topology.Neighbours[v] {
+				if state.Labels[neighbour.Index] == shard {
+					edgeWeightWithShard += neighbour.Weight
+				}
 			}
 		}
 
@@ -216,7 +291,7 @@ func calculateScores(graph *shared.Graph, v *shared.Vertex, beta float64) []*flo
 			firstTerm := float64(edgeWeightWithShard)
 
 			// Calculate penalty term (second term of the score function)
-			pen_numerator := float64(graph.ShardWorkloads[shard]) - float64(minWorkload)
+			pen_numerator := float64(state.ShardWorkloads[shard]) - float64(minWorkload)
 			pen_denominator := float64(maxWorkload) - float64(minWorkload) + 0.0000000001
 			penalty := 1 - (beta * (pen_numerator / pen_denominator))
 
@@ -256,21 +331,12 @@ func getBestShard(scores []*float64, randomGen *rand.Rand) int {
 }
 
 // Function to set the random order of traversal of vertices
-func setVerticesOrder(graph *shared.Graph, randomGen *rand.Rand) []*shared.Vertex {
-
-	// Extract vertex ids from the map
-	ids := make([]string, 0, len(graph.Vertices))
-	for id := range graph.Vertices {
-		ids = append(ids, id)
-	}
-
-	// Sort the keys to enforce an order
-	sort.Strings(ids)
+func setVerticesOrder(topology *shared.Topology, randomGen *rand.Rand) []int {
 
-	// Create a slice of Vertex pointers in sorted order
-	vertices := make([]*shared.Vertex, 0, len(ids))
-	for _, key := range ids {
-		vertices = append(vertices, graph.Vertices[key])
+	// The vertices of the topology are already sorted by ID, which enforces an order
+	vertices := make([]int, len(topology.Vertices))
+	for v := range vertices {
+		vertices[v] = v
 	}
 
 	// Shuffle the slice randomly (accprding to seed)
@@ -0,0 +1,63 @@
+package mylpa
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"example.com/shardinglpa/internal/testutil"
+	"example.com/shardinglpa/shared"
+)
+
+// Function to build a random topology with the functions of My LPA, and a label state with votes
+func randomTopology(randomGen *rand.Rand, numberOfVertices int, numberOfTransactions int, numberOfShards int,
+	model shared.CostModel) (*shared.Topology, *shared.LabelState) {
+
+	return testutil.RandomTopology(randomGen, numberOfVertices, numberOfTransactions, numberOfShards, model,
+		updateGraphFromRows, func(topology *shared.Topology, state *shared.LabelState, randomGen *rand.Rand) {
+			state.LabelVotes = make([]map[int]float64, len(topology.Vertices))
+			initialiseNewVertices(topology, state, randomGen)
+		})
+}
+
+// Moving vertices one after the other must keep the workloads and the cached neighbour weights equal to the ones
+// worked out from scratch, under every cost model
+func TestMoveVertexKeepsWorkloads(t *testing.T) {
+	testutil.CheckMovesKeepBookkeeping(t, func(randomGen *rand.Rand, model shared.CostModel) testutil.Labelling {
+		topology, state := randomTopology(randomGen, 30, 120, 4, model)
+		state.NeighbourWeights = topology.CalculateNeighbourWeights(state)
+		return testutil.NewStateLabelling(topology, state, moveVertex)
+	})
+}
+
+// A vertex only moves to another shard, and only until it has updated its label rho times
+func TestMoveVertexRespectsRho(t *testing.T) {
+	testutil.CheckMoveRespectsRho(t, func() testutil.Labelling {
+		topology, state := randomTopology(rand.New(rand.NewSource(2)), 20, 60, 4, shared.PaperCostModel)
+		return testutil.NewStateLabelling(topology, state, moveVertex)
+	})
+}
+
+// The workloads of the labels given to new vertices add up to the cost of the edges, and follow their shards
+func TestCalculateShardWorkloadsProperties(t *testing.T) {
+	testutil.CheckWorkloadProperties(t, func(randomGen *rand.Rand, model shared.CostModel) *shared.Graph {
+		topology, state := randomTopology(randomGen, 30, 120, 4, model)
+		return topology.Apply(state)
+	})
+}
+
+// The scores looked up in the cache are the same as the scores worked out by scanning the edges, and without a
+// penalty the score of a shard is the weight of the edges of the vertex to it
+func TestCalculateScoresProperties(t *testing.T) {
+	testutil.CheckCachedScores(t, func(randomGen *rand.Rand) (*shared.Topology, *shared.LabelState) {
+		return randomTopology(randomGen, 30, 120, 4, shared.PaperCostModel)
+	}, calculateScores, func(scores []*float64, weights []int) error {
+		for shard, score := range scores {
+			if score != nil && *score != float64(weights[shard]) {
+				return fmt.Errorf("score of shard %d without penalty is %v, expected %d", shard, *score,
+					weights[shard])
+			}
+		}
+		return nil
+	})
+}
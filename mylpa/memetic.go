@@ -0,0 +1,272 @@
+package mylpa
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+
+	"example.com/shardinglpa/shared"
+)
+
+/*
+The memetic optimiser is a genetic algorithm that starts from the labellings found by the seeds of an epoch, to find
+out how much better the allocation can get beyond the single best seed.
+
+Each labelling is an individual of the population. In each generation, pairs of parents picked by tournament are
+combined into children: the shards of the second parent are first renamed to match the shards of the first as
+closely as possible (the same allocation can be labelled with the shards in any order), and then every vertex takes
+the shard of one of the two parents. Some of the vertices on the boundary of a shard are then moved to the shard of
+one of their neighbours, and the CLPA is run on the child for a few iterations as a local search.
+The best labellings among the parents and the children make up the next generation.
+*/
+
+// Struct to hold the settings of the memetic optimiser
+type MemeticConfig struct {
+	Generations           int     // Number of generations
+	PopulationSize        int     // Number of labellings kept in each generation, 0 means the number of seeds
+	MutationRate          float64 // Chance of each boundary vertex being moved to the shard of one of its neighbours
+	LocalSearchIterations int     // Number of CLPA iterations run on each child
+	Seed                  int64   // Seed of the random generator picking the parents and the seeds of the children
+	MaxWorkers            int     // Maximum number of children worked out at the same time, 0 means no limit
+}
+
+// Function to return the settings of the memetic optimiser used by the test suite
+func DefaultMemeticConfig() MemeticConfig {
+	return MemeticConfig{
+		Generations:           20,
+		MutationRate:          0.05,
+		LocalSearchIterations: 10,
+		Seed:                  1,
+	}
+}
+
+// An individual of the population, which is the labelling of a seed or of a child
+type individual struct {
+	result *shared.EpochResult
+	state  *shared.LabelState
+}
+
+/*
+Function to run the memetic optimiser on the seeds of an epoch, which must hold their label states
+(so no memory budget can be set when they are run)
+
+It returns the result of the best labelling found, and the best fitness of each generation, starting with the best
+fitness of the seeds. The result holds the label state on the topology of the seeds, and is not a seed, so its Seed
+is -1. Since the best labelling is always kept, the result is never worse than the best seed, and it is picked by
+shared.GetBestGraph if it is added to the results of the seeds. It returns nil if no seed holds its label state.
+
+If the context is cancelled, the generations stop early and the best labelling found so far is returned.
+*/
+func OptimiseMemetic(ctx context.Context, seedsResults []*shared.EpochResult, alpha float64, beta float64, rho int,
+	config MemeticConfig) (*shared.EpochResult, []float64) {
+
+	// The seeds make up the first generation
+	var topology *shared.Topology
+	var population []*individual
+	for _, result := range seedsResults {
+		if result.Pruned || result.State == nil || result.Topology == nil {
+			continue
+		}
+		if topology != nil && result.Topology != topology {
+			continue
+		}
+		topology = result.Topology
+		population = append(population, &individual{result: result, state: result.State})
+	}
+
+	if len(population) == 0 {
+		return nil, nil
+	}
+
+	populationSize := config.PopulationSize
+	if populationSize <= 0 {
+		populationSize = len(population)
+	}
+
+	sortPopulation(population)
+	if len(population) > populationSize {
+		population = population[:populationSize]
+	}
+
+	bestFitness := []float64{population[0].result.Fitness}
+
+	randomGen := rand.New(rand.NewSource(config.Seed))
+
+	// Work out how many children can be worked out at the same time
+	numberOfWorkers := populationSize
+	if config.MaxWorkers > 0 && config.MaxWorkers < numberOfWorkers {
+		numberOfWorkers = config.MaxWorkers
+	}
+
+	for generation := 1; generation <= config.Generations; generation++ {
+
+		// Stop the generations if the context was cancelled or its deadline was exceeded
+		if shared.Cancelled(ctx) {
+			break
+		}
+
+		// Each child has its own seed, so that the children can be worked out in any order
+		childSeeds := make([]int64, populationSize)
+		for i := range childSeeds {
+			childSeeds[i] = randomGen.Int63()
+		}
+
+		parents := population
+		children := shared.RunSeeds(ctx, childSeeds, numberOfWorkers, false,
+			func(seed int64) *shared.EpochResult {
+
+				childRandomGen := rand.New(rand.NewSource(seed))
+
+				// Pick two parents by tournament and combine them
+				first := tournament(parents, childRandomGen)
+				second := tournament(parents, childRandomGen)
+				state := crossover(topology, first.state, second.state, childRandomGen)
+
+				// Move some of the vertices on the boundary of a shard
+				mutateBoundary(topology, state, config.MutationRate, childRandomGen)
+
+				// Run the CLPA on the child as a local search, with fresh votes and label updates
+				state.LabelVotes = make([]map[int]float64, len(topology.Vertices))
+				state.ShardWorkloads = topology.CalculateShardWorkloads(state)
+				result := runClpa(ctx, alpha, beta, config.LocalSearchIterations, rho, topology, state,
+					childRandomGen, seed, shared.AllocationConfig{})
+
+				result.State = state
+				result.Topology = topology
+				return result
+			})
+
+		// Keep the best labellings among the parents and the children
+		for _, child := range children {
+			population = append(population, &individual{result: child, state: child.State})
+		}
+		sortPopulation(population)
+		population = population[:min(populationSize, len(population))]
+
+		bestFitness = append(bestFitness, population[0].result.Fitness)
+	}
+
+	// The best labelling is returned as a result that is not a seed
+	best := population[0]
+	workloadImbalance, crossShardWorkload, fitness := topology.CalculateFitness(best.state, alpha)
+
+	return &shared.EpochResult{
+		Seed:               -1,
+		Fitness:            fitness,
+		WorkloadImbalance:  workloadImbalance,
+		CrossShardWorkload: crossShardWorkload,
+		ConvergenceIter:    -1,
+		Metrics:            topology.CalculateMetrics(best.state, alpha),
+		Interrupted:        shared.Cancelled(ctx),
+		State:              best.state,
+		Topology:           topology,
+	}, bestFitness
+}
+
+// Function to sort the population by fitness, keeping the order of individuals with the same fitness
+func sortPopulation(population []*individual) {
+	sort.SliceStable(population, func(i, j int) bool {
+		return population[i].result.Fitness < population[j].result.Fitness
+	})
+}
+
+// Function to pick a parent by a tournament between two random individuals, which the fitter one wins
+func tournament(population []*individual, randomGen *rand.Rand) *individual {
+	a := population[randomGen.Intn(len(population))]
+	b := population[randomGen.Intn(len(population))]
+	if b.result.Fitness < a.result.Fitness {
+		return b
+	}
+	return a
+}
+
+/*
+Function to combine two labellings into a new one
+
+The shards of the second parent are renamed to the shards of the first parent that they share the most vertices with,
+picking the pairs of shards with the largest overlap first. Vertices on which the parents then agree keep their shard,
+and each of the other vertices takes the shard of a random parent.
+*/
+func crossover(topology *shared.Topology, first *shared.LabelState, second *shared.LabelState,
+	randomGen *rand.Rand) *shared.LabelState {
+
+	numberOfShards := topology.NumberOfShards
+
+	// Count the vertices in each pair of shards of the two parents
+	overlap := make([][]int, numberOfShards)
+	for shard := range overlap {
+		overlap[shard] = make([]int, numberOfShards)
+	}
+	for v := range topology.Vertices {
+		overlap[first.Labels[v]][second.Labels[v]]++
+	}
+
+	// Sort the pairs of shards by their overlap, largest first, breaking ties by shard to be deterministic
+	type pair struct{ firstShard, secondShard, count int }
+	pairs := make([]pair, 0, numberOfShards*numberOfShards)
+	for i := range overlap {
+		for j, count := range overlap[i] {
+			pairs = append(pairs, pair{i, j, count})
+		}
+	}
+	sort.SliceStable(pairs, func(a, b int) bool {
+		return pairs[a].count > pairs[b].count
+	})
+
+	// Greedily match the shards of the second parent to the shards of the first parent
+	rename := make([]int, numberOfShards)
+	for shard := range rename {
+		rename[shard] = -1
+	}
+	taken := make([]bool, numberOfShards)
+	for _, p := range pairs {
+		if rename[p.secondShard] == -1 && !taken[p.firstShard] {
+			rename[p.secondShard] = p.firstShard
+			taken[p.firstShard] = true
+		}
+	}
+
+	child := &shared.LabelState{
+		Labels:             make([]int, len(topology.Vertices)),
+		LabelUpdateCounter: make([]int, len(topology.Vertices)),
+	}
+	for v := range topology.Vertices {
+		firstLabel, secondLabel := first.Labels[v], rename[second.Labels[v]]
+		if firstLabel == secondLabel || randomGen.Intn(2) == 0 {
+			child.Labels[v] = firstLabel
+		} else {
+			child.Labels[v] = secondLabel
+		}
+	}
+
+	return child
+}
+
+// Function to move each vertex on the boundary of a shard, with the given chance, to the shard of a random neighbour
+// that is in another shard
+// The vertices are moved one after the other, so a vertex can end up on a boundary because of an earlier move
+func mutateBoundary(topology *shared.Topology, state *shared.LabelState, mutationRate float64,
+	randomGen *rand.Rand) {
+
+	if mutationRate <= 0 {
+		return
+	}
+
+	for v, neighbours := range topology.Neighbours {
+
+		// Find the shards of the neighbours in other shards
+		var otherShards []int
+		for _, neighbour := range neighbours {
+			if label := state.Labels[neighbour.Index]; label != state.Labels[v] {
+				otherShards = append(otherShards, label)
+			}
+		}
+
+		// Only the vertices on a boundary are mutated
+		if len(otherShards) == 0 || randomGen.Float64() >= mutationRate {
+			continue
+		}
+
+		state.Labels[v] = otherShards[randomGen.Intn(len(otherShards))]
+	}
+}
@@ -0,0 +1,77 @@
+package mylpa
+
+import (
+	"context"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"example.com/shardinglpa/internal/testutil"
+	"example.com/shardinglpa/shared"
+)
+
+// Two parents that are the same allocation with the shards in another order combine into that allocation, whatever
+// the random choices of the crossover
+func TestCrossoverOfRelabelledParents(t *testing.T) {
+
+	randomGen := rand.New(rand.NewSource(5))
+
+	for trial := 0; trial < 20; trial++ {
+		topology, first := randomTopology(randomGen, 30, 120, 4, nil)
+
+		// Rename the shards of the first parent by a random permutation
+		permutation := randomGen.Perm(topology.NumberOfShards)
+		second := &shared.LabelState{Labels: make([]int, len(first.Labels))}
+		for v, label := range first.Labels {
+			second.Labels[v] = permutation[label]
+		}
+
+		if child := crossover(topology, first, second, randomGen); !slices.Equal(child.Labels, first.Labels) {
+			t.Fatalf("Trial %d: parents renamed by %v combined into %v, expected %v", trial, permutation,
+				child.Labels, first.Labels)
+		}
+	}
+}
+
+// The memetic optimiser keeps the best labelling of every generation, so it is never worse than the best seed
+func TestOptimiseMemeticNeverWorseThanBestSeed(t *testing.T) {
+
+	alpha, beta, rho := 0.5, 0.5, 50
+	seedsResults, _ := ShardAllocationWithConfig(context.Background(), testutil.FixtureDir, 4, 1, nil, alpha, beta,
+		20, rho, []int64{11, 22, 33}, shared.AllocationConfig{})
+	if seedsResults == nil {
+		t.Fatal("No results for the fixture epoch")
+	}
+	bestSeedFitness := seedsResults[0].Fitness
+	for _, result := range seedsResults {
+		bestSeedFitness = min(bestSeedFitness, result.Fitness)
+	}
+
+	configs := []MemeticConfig{
+		DefaultMemeticConfig(),
+		{Generations: 5, MutationRate: 0.5, LocalSearchIterations: 0, Seed: 2},
+		{Generations: 5, PopulationSize: 2, MutationRate: 1, LocalSearchIterations: 1, Seed: 3, MaxWorkers: 1},
+	}
+
+	for i, config := range configs {
+		result, bestFitness := OptimiseMemetic(context.Background(), seedsResults, alpha, beta, rho, config)
+		if result == nil {
+			t.Fatalf("Config %d: no result", i)
+		}
+
+		if result.Fitness > bestSeedFitness {
+			t.Errorf("Config %d: fitness %v is worse than the best seed fitness %v", i, result.Fitness,
+				bestSeedFitness)
+		}
+		if len(bestFitness) != config.Generations+1 || bestFitness[0] != bestSeedFitness ||
+			bestFitness[len(bestFitness)-1] != result.Fitness {
+			t.Errorf("Config %d: best fitness of the generations is %v, expected %d generations from %v to %v", i,
+				bestFitness, config.Generations, bestSeedFitness, result.Fitness)
+		}
+		for generation := 1; generation < len(bestFitness); generation++ {
+			if bestFitness[generation] > bestFitness[generation-1] {
+				t.Errorf("Config %d: best fitness got worse in generation %d: %v", i, generation, bestFitness)
+			}
+		}
+	}
+}
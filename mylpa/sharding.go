@@ -1,11 +1,12 @@
 package mylpa
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"math/rand"
 	"strconv"
-	"sync"
+	"time"
 
 	"example.com/shardinglpa/shared"
 )
@@ -31,19 +32,45 @@ the vertices with no transcations in this epoch
 func ShardAllocation(datasetDir string, numberOfShards int, epochNumber int,
 	graph *shared.Graph, alpha float64, beta float64, tau int, rho int, seeds []int64) ([]*shared.EpochResult, map[string]*shared.Vertex) {
 
-	// Create a WaitGroup to wait for all goroutines to finish
-	var wg sync.WaitGroup
+	// Run every seed at the same time, without any limit
+	return ShardAllocationWithConfig(context.Background(), datasetDir, numberOfShards, epochNumber, graph, alpha, beta, tau, rho, seeds,
+		shared.AllocationConfig{})
+}
 
-	// Buffered channel to collect results from each seed's run
-	results := make(chan *shared.EpochResult, len(seeds))
+/*
+Function to perform shard allocation, with the optional settings in config
 
-	// Create a new graph if it was not passed in to function
-	if graph == nil {
-		graph = &shared.Graph{
-			Vertices:       make(map[string]*shared.Vertex),
-			NumberOfShards: numberOfShards,
-		}
-	}
+The config sets the maximum number of seeds run at the same time, separately from the number of seeds.
+It can also set a memory budget, which throttles the number of per-seed label states that exist at once.
+When a memory budget is set, only the label state of the best result is kept, and the label states of the
+other results are discarded.
+
+All seeds share the topology of the graph (its vertices and edges), and each seed only keeps its own labels.
+The labels of the best seed are written back into the graph by shared.GetBestGraph.
+
+If the context is cancelled or its deadline is exceeded, every seed stops its iterations early and keeps the
+best labelling it found so far, and the seeds that have not started yet are skipped. The results of the seeds
+that were cut short have their Interrupted flag set.
+
+If a seed race is set in the config, the seeds report their fitness to it every few iterations, and seeds that
+fall behind the leader are abandoned. The results of abandoned seeds have their Pruned flag set and no labels.
+The outcome of the race can be read from the race once this function returns.
+
+If a cost model is set in the config, it is kept in the graph and decides how transactions add to the workloads
+of shards. Otherwise the cost model of the graph is used, which is the one of the paper for a new graph.
+
+If a vote memory is set in the config, the votes of the winning seed are carried over to the next epoch,
+after being decayed and capped, instead of every vertex starting with empty votes.
+
+If a vote policy is set in the config, it decides how the votes of a vertex add up within the epoch and when the
+vertex moves, instead of a shard needing one more vote than the current shard. It is recorded in the results.
+
+If stopping rules are set in the config, the iterations stop once one of them fires, instead of only once no label
+changes after at least 5 iterations. The rule that fired is recorded in the results.
+*/
+func ShardAllocationWithConfig(ctx context.Context, datasetDir string, numberOfShards int, epochNumber int, graph *shared.Graph,
+	alpha float64, beta float64, tau int, rho int, seeds []int64,
+	config shared.AllocationConfig) ([]*shared.EpochResult, map[string]*shared.Vertex) {
 
 	// Generate the filename dynamically based on the epoch value
 	filename := fmt.Sprintf("%sepoch_%d.csv", datasetDir, epochNumber)
@@ -55,10 +82,46 @@ func ShardAllocation(datasetDir string, numberOfShards int, epochNumber int,
 		return nil, nil
 	}
 
+	return ShardAllocationFromRows(ctx, rows, numberOfShards, graph, alpha, beta, tau, rho, seeds, config)
+}
+
+/*
+Function to perform shard allocation on the transactions in rows, instead of on the transactions of an epoch file
+
+The first row is the header, which must have a "from" and a "to" column. Otherwise, this works in the same way
+as ShardAllocationWithConfig.
+*/
+func ShardAllocationFromRows(ctx context.Context, rows [][]string, numberOfShards int, graph *shared.Graph,
+	alpha float64, beta float64, tau int, rho int, seeds []int64,
+	config shared.AllocationConfig) ([]*shared.EpochResult, map[string]*shared.Vertex) {
+
+	// Create a new graph if it was not passed in to function
+	if graph == nil {
+		graph = &shared.Graph{
+			Vertices:       make(map[string]*shared.Vertex),
+			NumberOfShards: numberOfShards,
+		}
+	}
+
+	// Select the cost model of the graph, if one is set in the config
+	if config.CostModel != nil {
+		graph.CostModel = config.CostModel
+	}
+
+	// Keep the edges of the last epochs in the graph, if a sliding window is set in the config
+	if config.EdgeWindow > 0 {
+		graph.SetEdgeWindow(config.EdgeWindow)
+	}
+
+	// Select the placement policy of new vertices, if one is set in the config
+	if config.Placement != nil {
+		graph.Placement = config.Placement
+	}
+
 	// Update the graph based on the rows of the current epoch
 	graph = updateGraphFromRows(rows, graph)
 
-	//The following process can be done on the graph before a copy is provided to each go routine:
+	//The following process can be done on the graph before the topology is shared with each go routine:
 	/* inactiveVertices refers to vertices which have no edges in this particular epoch.
 	These will be dealt with by being removed since CLPA should ignore them, and then
 	after CLPA is run, added back to graph. */
@@ -72,108 +135,245 @@ func ShardAllocation(datasetDir string, numberOfShards int, epochNumber int,
 		}
 	}
 
-	// Iterate through each seed
-	for _, seed := range seeds {
+	// Clear the state of the seed race from any previous epoch
+	if config.Race != nil {
+		config.Race.Start()
+	}
+
+	// Build the topology of the graph once, to be shared by all seeds
+	topology := shared.NewTopology(graph)
 
-		// Increment the WaitGroup counter by 1 to track a new goroutine
-		wg.Add(1)
+	// Decay the votes carried over from the previous epoch once, before they are copied by each seed
+	if config.VoteMemory != nil {
+		decayCarriedVotes(topology, inactiveVertices, config.VoteMemory)
+	}
 
-		// Launch a new goroutine to run the CLPA for a specific seed
-		go func(seed int64) {
+	// Work out how many seeds can run at the same time
+	numberOfWorkers := shared.ConcurrentSeedLimit(topology.EstimateStateSize(true), len(seeds), config)
 
-			// Decrease the WaitGroup counter when the goroutine finishes
-			defer wg.Done()
+	// Run the CLPA for each seed using a pool of goroutines
+	// If a memory budget is set, only the best label state found so far is kept, unless the consensus needs them all
+	keepOnlyBest := config.MemoryBudget > 0 && config.Consensus == nil
+	seedsResultsForEpoch := shared.RunSeeds(ctx, seeds, numberOfWorkers, keepOnlyBest,
+		func(seed int64) *shared.EpochResult {
 
 			// Use unique random generator for each parallel run
 			randomGen := rand.New(rand.NewSource(seed))
 
-			// Deep copy the graph for this goroutine
-			localGraph := shared.DeepCopyGraph(graph)
+			// Create the labels of this goroutine, starting from the labels of the graph
+			// Unless a vote memory is set, the votes are not carried over from the graph, so every seed starts
+			// with empty vote maps
+			state := topology.NewLabelState()
+			state.LabelVotes = make([]map[int]float64, len(topology.Vertices))
+			if config.VoteMemory != nil {
+				copyCarriedVotes(topology, state)
+			}
 
-			// Initialise the graph with random shard labels for new vertices
-			localGraph = initialiseNewVertices(localGraph, randomGen)
+			// Initialise the labels with random shard labels for new vertices
+			initialiseNewVertices(topology, state, randomGen)
 
 			// Work out workloads for the first time this epoch
-			localGraph.ShardWorkloads = calculateShardWorkloads(localGraph)
+			state.ShardWorkloads = topology.CalculateShardWorkloads(state)
 
 			// Now that preparation is ready, the actual CLPA can run and the results recorded
-			epochResult := runClpa(alpha, beta, tau, rho, localGraph, randomGen, seed)
+			epochResult := runClpa(ctx, alpha, beta, tau, rho, topology, state, randomGen, seed, config)
 
-			epochResult.Graph = localGraph
+			// The labels of an abandoned seed are not needed, so they are discarded straight away
+			if !epochResult.Pruned {
+				epochResult.State = state
+				epochResult.Topology = topology
+			}
 
-			// Send the epoch results for this seed to the results channel
-			results <- epochResult
+			return epochResult
+		})
 
-		}(seed)
+	// Work out the outcome of the seed race
+	if config.Race != nil {
+		config.Race.Finish(seedsResultsForEpoch)
 	}
 
-	// Wait for all Goroutines to finish and close the results channel
-	wg.Wait()
-
-	close(results)
-
-	// Collect all the seeds results for the epoch into a slice
-	var seedsResultsForEpoch []*shared.EpochResult
-	for result := range results {
-		seedsResultsForEpoch = append(seedsResultsForEpoch, result)
+	// In ensemble mode, add the consensus of the seeds, which is picked by GetBestGraph instead of the best seed
+	if config.Consensus != nil {
+		if consensusResult := runConsensus(ctx, seedsResultsForEpoch, alpha, beta, tau, rho,
+			config); consensusResult != nil {
+			seedsResultsForEpoch = append(seedsResultsForEpoch, consensusResult)
+		}
 	}
 
 	// Return the collected results of all the seeds for the epoch
 	return seedsResultsForEpoch, inactiveVertices
 }
 
+/*
+Function to build the consensus of the seeds, in which the vertices that almost always share a shard are merged,
+and to run a final CLPA pass on it, starting from the labels of the best seed
+
+It returns the result of the consensus, labelled on the topology of the seeds, or nil if no seed holds its labels.
+*/
+func runConsensus(ctx context.Context, seedsResults []*shared.EpochResult, alpha float64, beta float64, tau int,
+	rho int, config shared.AllocationConfig) *shared.EpochResult {
+
+	consensus := shared.NewConsensus(seedsResults, config.Consensus.Agreement)
+	if consensus == nil {
+		return nil
+	}
+
+	// Run the CLPA on the merged graph, with the random generator of the best seed and the same vote policy and
+	// stopping rules
+	// The merged graph is not part of the seed race, and it is not annealed
+	mergedTopology := shared.NewTopology(consensus.Graph)
+	mergedState := mergedTopology.NewLabelState()
+	mergedState.LabelVotes = make([]map[int]float64, len(mergedTopology.Vertices))
+	mergedState.ShardWorkloads = mergedTopology.CalculateShardWorkloads(mergedState)
+
+	randomGen := rand.New(rand.NewSource(consensus.BestSeed))
+	result := runClpa(ctx, alpha, beta, tau, rho, mergedTopology, mergedState, randomGen, consensus.BestSeed,
+		shared.AllocationConfig{VotePolicy: config.VotePolicy, Stopping: config.Stopping,
+			NoNeighbourWeightCache: config.NoNeighbourWeightCache})
+
+	// Give the labels of the merged vertices to the vertices they were merged from
+	state := consensus.Expand(mergedState)
+	state.ShardWorkloads = consensus.Topology.CalculateShardWorkloads(state)
+
+	// The fitness is the same on both graphs, but it is worked out again on the graph the seeds were run on
+	result.WorkloadImbalance, result.CrossShardWorkload, result.Fitness = consensus.Topology.CalculateFitness(state,
+		alpha)
+	result.Metrics = consensus.Topology.CalculateMetrics(state, alpha)
+	result.Seed = -1
+	result.Consensus = true
+	result.State = state
+	result.Topology = consensus.Topology
+
+	return result
+}
+
 // The CLPA function
-func runClpa(alpha float64, beta float64, tau int, rho int, graph *shared.Graph,
-	randomGen *rand.Rand, seed int64) *shared.EpochResult {
+func runClpa(ctx context.Context, alpha float64, beta float64, tau int, rho int, topology *shared.Topology,
+	state *shared.LabelState, randomGen *rand.Rand, seed int64, config shared.AllocationConfig) *shared.EpochResult {
+
+	// The seed race, simulated annealing, vote policy and stopping rules are taken from the config
+	race := config.Race
+	annealing := config.Annealing
+	votePolicy := shared.DefaultVotePolicy()
+	if config.VotePolicy != nil {
+		votePolicy = *config.VotePolicy
+	}
+	// Run at least 5 iterations before checking convergence, unless the stopping rules set their own minimum
+	stoppingRules := shared.StoppingRules{}
+	if config.Stopping != nil {
+		stoppingRules = *config.Stopping
+	}
+	if stoppingRules.MinIterations == 0 {
+		stoppingRules.MinIterations = 5
+	}
+
+	// The shards each vertex voted for in the last iterations are only needed if the votes are over a window
+	if votePolicy.Window > 0 {
+		state.VoteHistory = make([][]int, len(topology.Vertices))
+	}
 
 	// Ensure all vertices have initialised LabelVotes
-	for _, vertex := range graph.Vertices {
-		if vertex.LabelVotes == nil {
-			vertex.LabelVotes = make(map[int]int)
-			vertex.LabelVotes[vertex.Label] = 1 // Give an initial vote for current label
+	for v, votes := range state.LabelVotes {
+		if votes == nil {
+			state.LabelVotes[v] = make(map[int]float64)
+			state.LabelVotes[v][state.Labels[v]] = 1 // Give an initial vote for current label
 		}
 	}
 
+	// Cache the weight of the edges of each vertex to each shard, which the moves keep up to date, to score faster
+	if !config.NoNeighbourWeightCache {
+		state.NeighbourWeights = topology.CalculateNeighbourWeights(state)
+	}
+
+	// In debug mode, check the bookkeeping of the CLPA as it runs, starting with the edges and the initial workloads
+	state.Checker = shared.NewInvariantChecker(config.InvariantChecks)
+	state.Checker.CheckTopologyEdges(topology)
+	if state.Checker.EveryIteration() {
+		checkInvariants(topology, state, -1)
+	}
+
 	convergenceIter := -1 // Default value if no convergence within iterations
+	stopReason := ""
+
+	// Keep track of the best labelling, in case the iterations are cut short
+	tracker := shared.NewStateAnytimeTracker(ctx, topology, state, alpha)
+	interrupted := false
+
+	// Keep track of the fitness before the first iteration and after it, to measure the effect of the initial placement
+	_, _, initialFitness := topology.CalculateFitness(state, alpha)
+	firstIterFitness := initialFitness
 
-	minIterations := 5 // Run at least 5 iterations before checking convergence
+	// Keep track of whether the seed was abandoned during seed racing, and of the time it ran for
+	pruned := false
+	start := time.Now()
+
+	// Keep track of the labels of the iterations, to find when a stopping rule fires
+	monitor := stoppingRules.NewMonitor(state.Labels)
 
 	// Carry out CLPA iterations
 	for iter := 0; iter < tau; iter++ {
 
-		// create a map with all old labels - meaning labels of vertices before current CLPA iteration
-		oldLabels := make(map[string]int)
-		for id, vertex := range graph.Vertices {
-			oldLabels[id] = vertex.Label
+		// Stop the iterations if the context was cancelled or its deadline was exceeded
+		if shared.Cancelled(ctx) {
+			interrupted = true
+			break
 		}
+		state.Checker.StartIteration(iter)
 
 		// Perform an iteration of CLPA while keeping track of which vertices are pending
-		clpaIteration(graph, beta, randomGen, rho)
-
-		// CLPA iterations should stop once convergence is reached
+		// With simulated annealing, the vertices vote for shards sampled at the temperature of the iteration
+		temperature := 0.0
+		if annealing != nil {
+			temperature = annealing.Temperature(iter)
+		}
+		clpaIteration(ctx, topology, state, beta, randomGen, rho, temperature, votePolicy)
 
-		// Set flag to show convergencence occurred unless a label changes
-		converged := true
+		// If the iteration was cut short, it is not taken into account for convergence
+		if shared.Cancelled(ctx) {
+			interrupted = true
+			break
+		}
+		if state.Checker.EveryIteration() {
+			checkInvariants(topology, state, -1)
+		}
+		tracker.RecordState(topology, state)
+		if iter == 0 {
+			_, _, firstIterFitness = topology.CalculateFitness(state, alpha)
+		}
 
-		// Iterate through all vertices
-		for id, vertex := range graph.Vertices {
+		// CLPA iterations should stop once a stopping rule fires, which by default is when no label changes
+		iterationFitness := 0.0
+		if monitor.NeedsFitness() {
+			_, _, iterationFitness = topology.CalculateFitness(state, alpha)
+		}
+		if reason := monitor.Observe(state.Labels, iterationFitness); reason != "" {
+			convergenceIter = iter + 1
+			stopReason = reason
+			break
+		}
 
-			// Check if any vertex changed its label, and adjust flag if so
-			if oldLabels[id] != vertex.Label {
-				converged = false
+		// Report the fitness to the seed race every few iterations, and stop if the seed fell behind
+		if race != nil && race.IsCheckpoint(iter+1) {
+			_, _, iterationFitness := topology.CalculateFitness(state, alpha)
+			if !race.Checkpoint(seed, iter+1, iterationFitness, time.Since(start), tau-iter-1) {
+				pruned = true
 				break
 			}
 		}
 
-		if converged && iter+1 >= minIterations {
-			convergenceIter = iter + 1
-			break
-		}
+	}
 
+	// The cache is only kept up to date by the CLPA, so it is dropped once the iterations are over, as are the checks
+	state.NeighbourWeights = nil
+	state.Checker = nil
+
+	// If the iterations were cut short, go back to the best labelling found so far
+	if interrupted && tracker.RestoreState(topology, state) {
+		state.ShardWorkloads = topology.CalculateShardWorkloads(state)
 	}
 
 	// Calculate the workload imbalance, number of cross shard transactions and fitness of the partitioning
-	workloadImbalance, crossShardWorkload, fitness := shared.CalculateFitness(graph, alpha)
+	workloadImbalance, crossShardWorkload, fitness := topology.CalculateFitness(state, alpha)
 
 	// Return the results of the epoch
 	return &shared.EpochResult{
@@ -182,41 +382,56 @@ func runClpa(alpha float64, beta float64, tau int, rho int, graph *shared.Graph,
 		WorkloadImbalance:  workloadImbalance,
 		CrossShardWorkload: crossShardWorkload,
 		ConvergenceIter:    convergenceIter,
+		StopReason:         stopReason,
+		InitialFitness:     initialFitness,
+		FirstIterFitness:   firstIterFitness,
+		Metrics:            topology.CalculateMetrics(state, alpha),
+		Interrupted:        interrupted,
+		Pruned:             pruned,
+		VotePolicy:         votePolicy.String(),
 	}
 
 }
 
 // The function that performs an iteration through all vertices and assigns shards
-func clpaIteration(graph *shared.Graph, beta float64, randomGen *rand.Rand, rho int) {
+// If the temperature is above 0, the shard each vertex votes for is sampled rather than the one with the highest score
+// The vote policy decides how the votes add up, and when a vertex moves to the shard with the most votes
+func clpaIteration(ctx context.Context, topology *shared.Topology, state *shared.LabelState, beta float64,
+	randomGen *rand.Rand, rho int, temperature float64, votePolicy shared.VotePolicy) {
 
 	// Get a random order to use for this CLPA iteration
-	sortedVertices := setVerticesOrder(graph, randomGen)
+	sortedVertices := setVerticesOrder(topology, randomGen)
 
 	// Iterate through each vertex in some order
-	for _, vertex := range sortedVertices {
+	for i, vertex := range sortedVertices {
+
+		// Every so often, stop the iteration if the context was cancelled
+		// Each move keeps the graph valid, so the iteration can stop after any vertex
+		if i%shared.ContextCheckInterval == 0 && shared.Cancelled(ctx) {
+			return
+		}
 
 		// Calculate the score of shards with respect to current vertex
-		scores := calculateScores(graph, vertex, beta)
+		scores := calculateScores(topology, state, vertex, beta)
 
 		// Get the ID of the best shard with respect to current vertex
-		bestShard := getBestShard(scores, randomGen)
+		var bestShard int
+		if temperature > 0 {
+			bestShard = shared.SampleShard(scores, temperature, randomGen)
+		} else {
+			bestShard = getBestShard(scores, randomGen)
+		}
 
 		// Instead of moving immediately, add a vote
-		vertex.LabelVotes[bestShard]++
-
-		// Find the label with the most votes
-		winningShard, maxVotes := vertex.Label, vertex.LabelVotes[vertex.Label]
-		for shard, votes := range vertex.LabelVotes {
-			if votes > maxVotes {
-				winningShard = shard
-				maxVotes = votes
-			}
+		var history *[]int
+		if state.VoteHistory != nil {
+			history = &state.VoteHistory[vertex]
 		}
+		votePolicy.CastVote(state.LabelVotes[vertex], history, bestShard)
 
-		// If winning shard is different and has enough dominance, then move
-		voteMargin := 1 // <-- configurable: need at least 1 more votes than current label
-		if winningShard != vertex.Label && (vertex.LabelVotes[winningShard]-vertex.LabelVotes[vertex.Label] >= voteMargin) {
-			moveVertex(graph, vertex, winningShard, rho)
+		// If the shard with the most votes is far enough ahead of the current shard, then move
+		if winningShard, moves := votePolicy.Winner(state.LabelVotes[vertex], state.Labels[vertex]); moves {
+			moveVertex(topology, state, vertex, winningShard, rho)
 		}
 	}
 }
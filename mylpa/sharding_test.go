@@ -0,0 +1,94 @@
+package mylpa
+
+import (
+	"context"
+	"maps"
+	"testing"
+
+	"example.com/shardinglpa/internal/testutil"
+	"example.com/shardinglpa/shared"
+)
+
+// Replays My LPA over the fixture epochs with fixed seeds, and pins the fitness of every seed, and the workloads
+// and labels of the best graph of every epoch
+func TestShardAllocationGolden(t *testing.T) {
+
+	seeds := []int64{11, 22, 33}
+
+	out := testutil.ReplaySeeds(t, func(epoch int, graph *shared.Graph) ([]*shared.EpochResult,
+		map[string]*shared.Vertex) {
+		return ShardAllocationWithConfig(context.Background(), testutil.FixtureDir, 4, epoch, graph, 0.5, 0.5, 20,
+			50, seeds, shared.AllocationConfig{})
+	})
+
+	testutil.CheckGolden(t, "shard_allocation", out)
+}
+
+// The votes carried over by a vertex decay once for every epoch, including the epochs in which it has no transactions,
+// so a vertex that was only active in the first epoch does not keep the full votes of that epoch
+func TestCarriedVotesDecayWhileInactive(t *testing.T) {
+
+	const decay = 0.5
+	config := shared.AllocationConfig{VoteMemory: &shared.VoteMemoryConfig{Decay: decay}}
+
+	// The account is only active in the first fixture epoch
+	const account = "0x000c"
+
+	var graph *shared.Graph
+	var votes map[int]float64
+
+	for epoch := 1; epoch <= testutil.FixtureEpochs; epoch++ {
+
+		seedsResults, inactiveVertices := ShardAllocationWithConfig(context.Background(), testutil.FixtureDir, 4, epoch,
+			graph, 0.5, 0.5, 20, 50, []int64{1}, config)
+		graph = shared.GetBestGraph(seedsResults)
+		for id, vertex := range inactiveVertices {
+			graph.Vertices[id] = vertex
+		}
+
+		vertex := graph.Vertices[account]
+		if epoch == 1 {
+			if len(vertex.LabelVotes) == 0 {
+				t.Fatalf("Account %s has no votes after the first epoch", account)
+			}
+			votes = maps.Clone(vertex.LabelVotes)
+			continue
+		}
+		if _, inactive := inactiveVertices[account]; !inactive {
+			t.Fatalf("Account %s is active in epoch %d", account, epoch)
+		}
+
+		for shard := range votes {
+			votes[shard] *= decay
+		}
+		if !maps.Equal(vertex.LabelVotes, votes) {
+			t.Fatalf("Epoch %d: account %s carries the votes %v, expected %v", epoch, account, vertex.LabelVotes, votes)
+		}
+	}
+}
+
+// Stopping rules that leave MinIterations unset still run the 5 iterations My LPA runs by default before any rule
+// can fire, so turning on a rule does not also turn off the minimum
+func TestStoppingRulesKeepMinIterations(t *testing.T) {
+
+	// Fewer vertices than all of them move in every iteration, so the rule fires as soon as it is allowed to
+	rules := shared.StoppingRules{MovedFraction: 1}
+
+	for _, tc := range []struct {
+		minIterations int
+		want          int
+	}{
+		{0, 5},
+		{2, 2},
+	} {
+		rules.MinIterations = tc.minIterations
+		seedsResults, _ := ShardAllocationWithConfig(context.Background(), testutil.FixtureDir, 4, 1, nil, 0.5, 0.5,
+			20, 50, []int64{1}, shared.AllocationConfig{Stopping: &rules})
+		if seedsResults == nil {
+			t.Fatalf("No results for MinIterations %d", tc.minIterations)
+		}
+		if got := seedsResults[0].ConvergenceIter; got != tc.want {
+			t.Errorf("MinIterations %d: stopped in iteration %d, expected %d", tc.minIterations, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,473 @@
+package online
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+
+	"example.com/shardinglpa/mylpa"
+	"example.com/shardinglpa/shared"
+)
+
+/*
+The online mode reads transactions one at a time, in timestamp order, instead of a whole epoch at once.
+
+An account that has not been seen before is given a shard as soon as its first transaction arrives, instead of
+waiting for the random shard it would be given at the start of the next epoch. If the other account of the
+transaction already has a shard, the new account is put in whichever shard gives the best fitness once the
+transaction is added, given the current shard workloads. Otherwise both accounts are put in the shard with the
+lowest workload.
+
+Every EpochSize transactions, My LPA is run on the transactions of the epoch, starting from the shards given to
+the accounts online. The fitness of the shards given online (before My LPA runs) is recorded next to the fitness
+after My LPA, which measures the quality of the interim placements.
+*/
+
+// The settings of the online mode
+type Config struct {
+	NumberOfShards int
+	EpochSize      int // The number of transactions in an epoch, after which My LPA is run
+	Alpha          float64
+	Beta           float64
+	Tau            int
+	Rho            int
+	SeedsFile      string // The file the seeds of My LPA are read from
+	SeedsPerEpoch  int
+	RandomSeed     int64 // The seed used to break ties when placing new accounts
+}
+
+// Function to get the settings used by the tests, with epochs as long as the low arrival rate dataset
+func DefaultConfig() Config {
+	return Config{
+		NumberOfShards: 8,
+		EpochSize:      100_000,
+		Alpha:          0.5,
+		Beta:           0.5,
+		Tau:            100,
+		Rho:            50,
+		SeedsFile:      "mylpa/seeds.csv",
+		SeedsPerEpoch:  4,
+		RandomSeed:     1,
+	}
+}
+
+// The statistics of an epoch of the online mode
+type EpochStats struct {
+	Epoch        int
+	Transactions int
+	NewAccounts  int // The number of accounts first seen in this epoch, which were placed online
+	OutOfOrder   int // The number of transactions with an earlier timestamp than the one before
+
+	// The fitness of the shards given online, before My LPA runs
+	InterimWorkloadImbalance  float64
+	InterimCrossShardWorkload int
+	InterimFitness            float64
+
+	// The fitness after My LPA runs
+	ClpaWorkloadImbalance  float64
+	ClpaCrossShardWorkload int
+	ClpaFitness            float64
+
+	// The number of accounts placed online in this epoch which My LPA then moved to another shard
+	MovedNewAccounts int
+}
+
+// Placer gives shards to accounts as their transactions arrive, and runs My LPA at the end of each epoch
+type Placer struct {
+	config    Config
+	graph     *shared.Graph
+	randomGen *rand.Rand
+
+	epoch         int
+	nextSeedIndex int
+
+	// The transactions of the current epoch, with the header row first
+	rows [][]string
+
+	// The workload of each shard and the cross-shard workload, for the transactions of the current epoch
+	shardWorkloads     []int
+	crossShardWorkload int
+
+	// The shards given to the accounts first seen in the current epoch
+	newAccounts map[string]int
+
+	// Used to check that the transactions arrive in timestamp order
+	lastTimestamp int64
+	outOfOrder    int
+}
+
+// Function to create a placer, starting from the graph of a previous epoch, or from an empty graph if it is nil
+// An error is returned if the config has no shards or empty epochs, or if the graph has another number of shards
+func NewPlacer(config Config, graph *shared.Graph) (*Placer, error) {
+
+	if config.NumberOfShards <= 0 || config.EpochSize <= 0 {
+		return nil, errors.New("the number of shards and the epoch size must be positive")
+	}
+
+	if graph != nil && graph.NumberOfShards != config.NumberOfShards {
+		return nil, fmt.Errorf("the graph has %d shards, but the config has %d", graph.NumberOfShards,
+			config.NumberOfShards)
+	}
+
+	if graph == nil {
+		graph = &shared.Graph{
+			Vertices:       make(map[string]*shared.Vertex),
+			NumberOfShards: config.NumberOfShards,
+		}
+	}
+
+	placer := &Placer{
+		config:    config,
+		graph:     graph,
+		randomGen: rand.New(rand.NewSource(config.RandomSeed)),
+		epoch:     1,
+	}
+	placer.startEpoch()
+
+	return placer, nil
+}
+
+// Function to clear the transactions and workloads at the start of an epoch
+func (placer *Placer) startEpoch() {
+	placer.rows = [][]string{{"from", "to"}}
+	placer.shardWorkloads = make([]int, placer.config.NumberOfShards)
+	placer.crossShardWorkload = 0
+	placer.newAccounts = make(map[string]int)
+	placer.outOfOrder = 0
+}
+
+// Function to get the shard an account is on, and whether the account has been seen
+func (placer *Placer) Shard(account string) (int, bool) {
+	vertex, exists := placer.graph.Vertices[account]
+	if !exists {
+		return 0, false
+	}
+	return vertex.Label, true
+}
+
+// Function to get the graph, with the shards given so far
+func (placer *Placer) Graph() *shared.Graph {
+	return placer.graph
+}
+
+// Function to add a transaction, giving a shard straight away to any of its accounts that were not seen before
+func (placer *Placer) Add(from string, to string, timestamp int64) {
+
+	if timestamp < placer.lastTimestamp {
+		placer.outOfOrder++
+	} else {
+		placer.lastTimestamp = timestamp
+	}
+
+	fromShard, fromExists := placer.Shard(from)
+	toShard, toExists := placer.Shard(to)
+
+	switch {
+	case !fromExists && !toExists:
+		// Neither account has a shard, so both go to the shard with the lowest workload
+		shard := placer.leastLoadedShard()
+		placer.place(from, shard)
+		placer.place(to, shard)
+		fromShard, toShard = shard, shard
+	case !fromExists:
+		fromShard = placer.bestShard(toShard)
+		placer.place(from, fromShard)
+	case !toExists:
+		toShard = placer.bestShard(fromShard)
+		placer.place(to, toShard)
+	}
+
+	// Update the workloads in the same way as when they are worked out for the whole epoch
+	if fromShard == toShard {
+		placer.shardWorkloads[fromShard]++
+	} else {
+		placer.shardWorkloads[fromShard]++
+		placer.shardWorkloads[toShard]++
+		placer.crossShardWorkload++
+	}
+
+	placer.rows = append(placer.rows, []string{from, to})
+}
+
+// Function to check whether the current epoch has all of its transactions
+func (placer *Placer) EpochFull() bool {
+	return len(placer.rows)-1 >= placer.config.EpochSize
+}
+
+// Function to give a shard to a new account
+func (placer *Placer) place(account string, shard int) {
+	placer.graph.Vertices[account] = &shared.Vertex{
+		ID:    account,
+		Label: shard,
+		Edges: make(map[string]int),
+	}
+	placer.newAccounts[account] = shard
+}
+
+// Function to find the shard with the lowest workload, breaking ties randomly
+func (placer *Placer) leastLoadedShard() int {
+
+	var candidateShards []int
+	minWorkload := math.MaxInt
+	for shard, workload := range placer.shardWorkloads {
+		if workload < minWorkload {
+			minWorkload = workload
+			candidateShards = []int{shard}
+		} else if workload == minWorkload {
+			candidateShards = append(candidateShards, shard)
+		}
+	}
+
+	return candidateShards[placer.randomGen.Intn(len(candidateShards))]
+}
+
+// Function to find the best shard for a new account whose transaction is with an account in neighbourShard
+// Each shard is scored by the fitness once the transaction is added, and ties are broken randomly
+func (placer *Placer) bestShard(neighbourShard int) int {
+
+	workloads := make([]int, len(placer.shardWorkloads))
+
+	var candidateShards []int
+	bestFitness := math.Inf(1)
+	for shard := range placer.shardWorkloads {
+
+		// Work out the workloads and cross-shard workload if the account was put in this shard
+		copy(workloads, placer.shardWorkloads)
+		crossShardWorkload := placer.crossShardWorkload
+		workloads[shard]++
+		if shard != neighbourShard {
+			workloads[neighbourShard]++
+			crossShardWorkload++
+		}
+
+		fitness := placer.config.Alpha*float64(crossShardWorkload) +
+			(1-placer.config.Alpha)*shared.WorkloadImbalance(workloads)
+
+		if fitness < bestFitness {
+			bestFitness = fitness
+			candidateShards = []int{shard}
+		} else if fitness == bestFitness {
+			candidateShards = append(candidateShards, shard)
+		}
+	}
+
+	return candidateShards[placer.randomGen.Intn(len(candidateShards))]
+}
+
+// Function to end the current epoch, running My LPA on its transactions, and to return the epoch statistics
+func (placer *Placer) EndEpoch(ctx context.Context) (*EpochStats, error) {
+
+	config := placer.config
+
+	stats := &EpochStats{
+		Epoch:                     placer.epoch,
+		Transactions:              len(placer.rows) - 1,
+		NewAccounts:               len(placer.newAccounts),
+		OutOfOrder:                placer.outOfOrder,
+		InterimWorkloadImbalance:  shared.WorkloadImbalance(placer.shardWorkloads),
+		InterimCrossShardWorkload: placer.crossShardWorkload,
+	}
+	stats.InterimFitness = config.Alpha*float64(stats.InterimCrossShardWorkload) +
+		(1-config.Alpha)*stats.InterimWorkloadImbalance
+
+	// Get the random seeds
+	seeds, err := mylpa.GetSeeds(config.SeedsFile, config.SeedsPerEpoch, placer.nextSeedIndex)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load seeds: %w", err)
+	}
+	placer.nextSeedIndex += len(seeds)
+
+	// Every account already has a shard, so My LPA starts from the shards given online
+	seedsResults, inactiveVertices := mylpa.ShardAllocationFromRows(ctx, placer.rows, config.NumberOfShards,
+		placer.graph, config.Alpha, config.Beta, config.Tau, config.Rho, seeds, shared.AllocationConfig{})
+	if len(seedsResults) == 0 {
+		return nil, errors.New("no results from My LPA")
+	}
+
+	// Get the best graph, and add inactive vertices back to graph for the next epoch
+	placer.graph = shared.GetBestGraph(seedsResults)
+	for id, vertex := range inactiveVertices {
+		placer.graph.Vertices[id] = vertex
+	}
+
+	stats.ClpaWorkloadImbalance, stats.ClpaCrossShardWorkload, stats.ClpaFitness =
+		shared.CalculateFitness(placer.graph, config.Alpha)
+
+	for account, shard := range placer.newAccounts {
+		if placer.graph.Vertices[account].Label != shard {
+			stats.MovedNewAccounts++
+		}
+	}
+
+	placer.epoch++
+	placer.startEpoch()
+
+	return stats, nil
+}
+
+/*
+Function to run the online mode on the transactions read from input, writing the statistics of each epoch to output
+
+The input is CSV, with a header row which must have a "from" and a "to" column, and can have a "timestamp"
+column, which must hold integers. The transactions must be in timestamp order. Transactions that are out of order
+are still added, but counted in the epoch statistics. A last, shorter epoch is run on the transactions left at the end of the input.
+*/
+func Run(ctx context.Context, input io.Reader, output *csv.Writer, config Config) error {
+
+	reader := csv.NewReader(input)
+	reader.ReuseRecord = true
+
+	// Parse header row to find "from", "to" and "timestamp" indices
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("error reading header: %w", err)
+	}
+	fromIdx, toIdx, timestampIdx := -1, -1, -1
+	for i, col := range header {
+		switch col {
+		case "from":
+			fromIdx = i
+		case "to":
+			toIdx = i
+		case "timestamp":
+			timestampIdx = i
+		}
+	}
+	if fromIdx == -1 || toIdx == -1 {
+		return errors.New("'from' or 'to' column not found in header")
+	}
+
+	writeStatsHeader(output)
+
+	placer, err := NewPlacer(config, nil)
+	if err != nil {
+		return err
+	}
+
+	// The number of the row read last, counting the header as row 1
+	rowNumber := 1
+
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("error reading transaction: %w", err)
+		}
+		rowNumber++
+		if len(row) <= max(fromIdx, toIdx, timestampIdx) {
+			continue // Skip invalid/malformed rows
+		}
+
+		timestamp := int64(0)
+		if timestampIdx != -1 {
+			timestamp, err = strconv.ParseInt(row[timestampIdx], 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid timestamp at row %d: %w", rowNumber, err)
+			}
+		}
+
+		placer.Add(row[fromIdx], row[toIdx], timestamp)
+
+		if placer.EpochFull() {
+			if err := endEpoch(ctx, placer, output); err != nil {
+				return err
+			}
+		}
+	}
+
+	// Run the last epoch on the transactions left over, if any
+	if len(placer.rows) > 1 {
+		return endEpoch(ctx, placer, output)
+	}
+
+	return nil
+}
+
+// Function to run the online mode on a CSV file, or on stdin if the input path is "-"
+// The statistics of each epoch are written to the output CSV file
+func RunFile(ctx context.Context, inputPath string, outputPath string, config Config) error {
+
+	input := os.Stdin
+	if inputPath != "-" {
+		file, err := os.Open(inputPath)
+		if err != nil {
+			return fmt.Errorf("error opening input: %w", err)
+		}
+		defer file.Close()
+		input = file
+	}
+
+	outFile, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("error creating output CSV file: %w", err)
+	}
+	defer outFile.Close()
+
+	writer := csv.NewWriter(outFile)
+	defer writer.Flush()
+
+	return Run(ctx, input, writer, config)
+}
+
+// Function to end an epoch and write its statistics
+func endEpoch(ctx context.Context, placer *Placer, output *csv.Writer) error {
+
+	stats, err := placer.EndEpoch(ctx)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Online epoch %d: %d transactions, %d new accounts, interim fitness %.3f, fitness after My LPA %.3f",
+		stats.Epoch, stats.Transactions, stats.NewAccounts, stats.InterimFitness, stats.ClpaFitness)
+
+	writeStats(output, stats)
+	return nil
+}
+
+// Function to write the header of the epoch statistics
+func writeStatsHeader(writer *csv.Writer) {
+	header := []string{"epoch", "transactions", "newAccounts", "outOfOrder",
+		"interimWorkloadImbalance", "interimCrossShardWorkload", "interimFitness",
+		"clpaWorkloadImbalance", "clpaCrossShardWorkload", "clpaFitness", "movedNewAccounts"}
+
+	if err := writer.Write(header); err != nil {
+		log.Printf("Error writing header to CSV: %v", err)
+	}
+}
+
+// Function to write the statistics of an epoch
+func writeStats(writer *csv.Writer, stats *EpochStats) {
+
+	// Prepare row for writing to csv
+	record := []string{
+		strconv.Itoa(stats.Epoch),
+		strconv.Itoa(stats.Transactions),
+		strconv.Itoa(stats.NewAccounts),
+		strconv.Itoa(stats.OutOfOrder),
+		fmt.Sprintf("%.3f", stats.InterimWorkloadImbalance),
+		strconv.Itoa(stats.InterimCrossShardWorkload),
+		fmt.Sprintf("%.3f", stats.InterimFitness),
+		fmt.Sprintf("%.3f", stats.ClpaWorkloadImbalance),
+		strconv.Itoa(stats.ClpaCrossShardWorkload),
+		fmt.Sprintf("%.3f", stats.ClpaFitness),
+		strconv.Itoa(stats.MovedNewAccounts),
+	}
+
+	if err := writer.Write(record); err != nil {
+		log.Printf("Error writing record to CSV: %v", err)
+	}
+	writer.Flush()
+
+	if err := writer.Error(); err != nil {
+		log.Printf("Error flushing CSV writer: %v", err)
+	}
+}
@@ -0,0 +1,196 @@
+package online
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+	"strings"
+	"testing"
+
+	"example.com/shardinglpa/shared"
+)
+
+// Function to get the settings of the tests, with the seeds file read from the directory of the package
+func testConfig(numberOfShards int, alpha float64) Config {
+	config := DefaultConfig()
+	config.NumberOfShards = numberOfShards
+	config.Alpha = alpha
+	config.EpochSize = 4
+	config.SeedsFile = "../mylpa/seeds.csv"
+	return config
+}
+
+// Function to create a placer for a test, failing the test if the config is rejected
+func newTestPlacer(t *testing.T, config Config) *Placer {
+	t.Helper()
+
+	placer, err := NewPlacer(config, nil)
+	if err != nil {
+		t.Fatalf("Failed to create placer: %v", err)
+	}
+	return placer
+}
+
+// Function to get the shard of an account that must have been placed
+func shardOf(t *testing.T, placer *Placer, account string) int {
+	t.Helper()
+
+	shard, exists := placer.Shard(account)
+	if !exists {
+		t.Fatalf("Account %s has no shard", account)
+	}
+	return shard
+}
+
+// Configs without shards or with empty epochs are rejected, instead of panicking when an account is placed
+func TestNewPlacerRejectsInvalidConfigs(t *testing.T) {
+
+	cases := []struct {
+		name   string
+		config Config
+		graph  *shared.Graph
+	}{
+		{"no shards", Config{NumberOfShards: 0, EpochSize: 10}, nil},
+		{"negative shards", Config{NumberOfShards: -1, EpochSize: 10}, nil},
+		{"empty epochs", Config{NumberOfShards: 2, EpochSize: 0}, nil},
+		{"negative epochs", Config{NumberOfShards: 2, EpochSize: -5}, nil},
+		{"graph with other shards", Config{NumberOfShards: 2, EpochSize: 10},
+			&shared.Graph{Vertices: map[string]*shared.Vertex{}, NumberOfShards: 3}},
+	}
+
+	for _, c := range cases {
+		if placer, err := NewPlacer(c.config, c.graph); err == nil {
+			t.Errorf("%s: expected an error, but got %+v", c.name, placer)
+		}
+	}
+}
+
+// Two new accounts go to the shard with the lowest workload
+func TestAddPlacesNewAccountsOnLeastLoadedShard(t *testing.T) {
+
+	placer := newTestPlacer(t, testConfig(3, 0.5))
+
+	// Every transaction loads the shard it is put on, so three transactions fill the three shards in turn
+	used := make(map[int]bool)
+	for _, pair := range [][2]string{{"a", "b"}, {"c", "d"}, {"e", "f"}} {
+		placer.Add(pair[0], pair[1], 0)
+
+		shard := shardOf(t, placer, pair[0])
+		if shardOf(t, placer, pair[1]) != shard {
+			t.Fatalf("Accounts %s and %s were put on different shards", pair[0], pair[1])
+		}
+		if used[shard] {
+			t.Fatalf("Accounts %s and %s were put on shard %d, which already had a workload", pair[0], pair[1],
+				shard)
+		}
+		used[shard] = true
+	}
+}
+
+// A new account with a known account goes to the shard with the best fitness once the transaction is added
+func TestAddPlacesNewAccountOnBestShard(t *testing.T) {
+
+	// Load the shard of a and b with 4 transactions, and each other shard with 1
+	load := func(placer *Placer) int {
+		placer.Add("a", "b", 0)
+		placer.Add("c", "d", 0)
+		placer.Add("e", "f", 0)
+		for i := 0; i < 3; i++ {
+			placer.Add("a", "b", 0)
+		}
+		return shardOf(t, placer, "a")
+	}
+
+	// With alpha 0.5 the cross-shard transaction costs more than the imbalance it saves (fitness 4/3 on the shard of
+	// a against 5/3 on another shard), so the new account joins a, whether it is the sender or the receiver
+	placer := newTestPlacer(t, testConfig(3, 0.5))
+	shard := load(placer)
+	placer.Add("g", "a", 0)
+	placer.Add("a", "h", 0)
+	if shardOf(t, placer, "g") != shard || shardOf(t, placer, "h") != shard {
+		t.Errorf("New accounts g and h were put on shards %d and %d, expected shard %d of a",
+			shardOf(t, placer, "g"), shardOf(t, placer, "h"), shard)
+	}
+
+	// With alpha 0.1 the imbalance matters more (fitness 2.4 on the shard of a against 2.2 on another shard)
+	placer = newTestPlacer(t, testConfig(3, 0.1))
+	shard = load(placer)
+	placer.Add("g", "a", 0)
+	if shardOf(t, placer, "g") == shard {
+		t.Errorf("New account g was put on shard %d of a, which has the highest workload", shard)
+	}
+}
+
+// The statistics of an epoch give the fitness of the shards given online, and the fitness after My LPA
+func TestEndEpochStats(t *testing.T) {
+
+	config := testConfig(2, 0.5)
+	placer := newTestPlacer(t, config)
+
+	// a and b go to one shard, c and d to the other, then a cross-shard transaction arrives out of order
+	placer.Add("a", "b", 10)
+	placer.Add("c", "d", 20)
+	placer.Add("a", "c", 5)
+	placer.Add("a", "b", 30)
+	if !placer.EpochFull() {
+		t.Fatalf("Epoch is not full after %d transactions", config.EpochSize)
+	}
+
+	online := make(map[string]int)
+	for _, account := range []string{"a", "b", "c", "d"} {
+		online[account] = shardOf(t, placer, account)
+	}
+
+	stats, err := placer.EndEpoch(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to end epoch: %v", err)
+	}
+
+	// The workloads are 3 and 2, so the imbalance is 0.5, and one transaction is cross-shard
+	if stats.Epoch != 1 || stats.Transactions != 4 || stats.NewAccounts != 4 || stats.OutOfOrder != 1 {
+		t.Errorf("Epoch %d has %d transactions, %d new accounts and %d out of order, expected 1, 4, 4 and 1",
+			stats.Epoch, stats.Transactions, stats.NewAccounts, stats.OutOfOrder)
+	}
+	if stats.InterimWorkloadImbalance != 0.5 || stats.InterimCrossShardWorkload != 1 || stats.InterimFitness != 0.75 {
+		t.Errorf("Interim imbalance %v, cross-shard workload %d and fitness %v, expected 0.5, 1 and 0.75",
+			stats.InterimWorkloadImbalance, stats.InterimCrossShardWorkload, stats.InterimFitness)
+	}
+
+	// The fitness after My LPA is the fitness of the graph kept for the next epoch
+	imbalance, cross, fitness := shared.CalculateFitness(placer.Graph(), config.Alpha)
+	if stats.ClpaWorkloadImbalance != imbalance || stats.ClpaCrossShardWorkload != cross ||
+		stats.ClpaFitness != fitness {
+		t.Errorf("Fitness after My LPA is %v, %d and %v, but %v, %d and %v for the graph",
+			stats.ClpaWorkloadImbalance, stats.ClpaCrossShardWorkload, stats.ClpaFitness, imbalance, cross, fitness)
+	}
+	moved := 0
+	for account, shard := range online {
+		if shardOf(t, placer, account) != shard {
+			moved++
+		}
+	}
+	if stats.MovedNewAccounts != moved {
+		t.Errorf("%d new accounts were counted as moved, but %d moved", stats.MovedNewAccounts, moved)
+	}
+
+	// The next epoch only counts its own transactions and new accounts
+	placer.Add("a", "e", 40)
+	stats, err = placer.EndEpoch(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to end second epoch: %v", err)
+	}
+	if stats.Epoch != 2 || stats.Transactions != 1 || stats.NewAccounts != 1 || stats.OutOfOrder != 0 {
+		t.Errorf("Epoch %d has %d transactions, %d new accounts and %d out of order, expected 2, 1, 1 and 0",
+			stats.Epoch, stats.Transactions, stats.NewAccounts, stats.OutOfOrder)
+	}
+}
+
+// A timestamp that is not an integer stops the run with an error, instead of being read as 0
+func TestRunRejectsInvalidTimestamp(t *testing.T) {
+
+	input := strings.NewReader("from,to,timestamp\na,b,1\nb,c,later\n")
+	err := Run(context.Background(), input, csv.NewWriter(io.Discard), testConfig(2, 0.5))
+	if err == nil || !strings.Contains(err.Error(), "row 3") {
+		t.Fatalf("Expected an error for the timestamp at row 3, got %v", err)
+	}
+}
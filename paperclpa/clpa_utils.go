@@ -2,6 +2,7 @@ package paperclpa
 
 // Import necessary packages
 import (
+	"context"
 	"log"
 	"math"
 	"math/rand"
@@ -11,11 +12,14 @@ import (
 )
 
 // ClpaIterationMode represents a CLPA iteration strategy (async or sync)
-type ClpaIterationMode func(graph *shared.Graph, beta float64, randomGen *rand.Rand,
+// iter is the iteration being run (counted from 0), for the modes that change over the iterations of a CLPA run
+// An iteration returns early, leaving the graph in a valid state, if the context is cancelled
+type ClpaIterationMode func(ctx context.Context, graph *shared.Graph, iter int, beta float64, randomGen *rand.Rand,
 	rho int, scoringPenalty ScoringPenalty)
 
 // ClpaCall indicates whether to stop iterations on convergence, or not, or run a convergence test
-type ClpaCall func(alpha float64, beta float64, tau int, rho int, graph *shared.Graph,
+// The iterations stop early if the context is cancelled or its deadline is exceeded
+type ClpaCall func(ctx context.Context, alpha float64, beta float64, tau int, rho int, graph *shared.Graph,
 	randomGen *rand.Rand, runClpaIter ClpaIterationMode, scoringPenalty ScoringPenalty) *shared.EpochResult
 
 // ScoringPenalty is used to call the func to calculate scores for shards with different
@@ -46,10 +50,20 @@ func InitialiseGraphFromRows(rows [][]string, graph *shared.Graph, randomGen *ra
 	}
 
 	// The vertices from previous epoch are kept in the graph, but the edges and number of time updated are cleared
+	// With a sliding window, only the edges of the epochs that fall out of the window are removed
 	for _, vertex := range graph.Vertices {
-		vertex.Edges = make(map[string]int) // Reset edges
+		if graph.Window == nil {
+			vertex.Edges = make(map[string]int) // Reset edges
+			vertex.Sent = make(map[string]int)
+		}
 		vertex.LabelUpdateCounter = 0
 	}
+	if graph.Window != nil {
+		graph.Window.StartEpoch(graph)
+	}
+
+	// The vertices added in this epoch, in the order in which they first appear
+	var newVertices []*shared.Vertex
 
 	for i, row := range rows {
 		// Skip the header
@@ -64,18 +78,12 @@ func InitialiseGraphFromRows(rows [][]string, graph *shared.Graph, randomGen *ra
 
 		// Add vertices if they do not already exist in the graph
 		if _, exists := graph.Vertices[from]; !exists {
-			graph.Vertices[from] = &shared.Vertex{
-				ID:    from,
-				Label: randomGen.Intn(graph.NumberOfShards), // Vertex label is initially assigned a random shard
-				Edges: make(map[string]int),
-			}
+			graph.Vertices[from] = newVertex(from, graph, randomGen)
+			newVertices = append(newVertices, graph.Vertices[from])
 		}
 		if _, exists := graph.Vertices[to]; !exists {
-			graph.Vertices[to] = &shared.Vertex{
-				ID:    to,
-				Label: randomGen.Intn(graph.NumberOfShards), // Vertex label is initially assigned a random shard
-				Edges: make(map[string]int),
-			}
+			graph.Vertices[to] = newVertex(to, graph, randomGen)
+			newVertices = append(newVertices, graph.Vertices[to])
 		}
 
 		// Add the edge between "from" and "to" vertices to the map of edges of both vertices
@@ -84,30 +92,39 @@ func InitialiseGraphFromRows(rows [][]string, graph *shared.Graph, randomGen *ra
 		if from != to {
 			graph.Vertices[to].Edges[from]++
 		}
+
+		// Keep track of the direction of the transaction, for cost models that charge the sender and receiver differently
+		graph.Vertices[from].Sent[to]++
+
+		// Record the transaction, so that its edge can be removed once the epoch falls out of the window
+		if graph.Window != nil {
+			graph.Window.Record(from, to)
+		}
+	}
+
+	// If the graph has a placement policy, the new vertices are placed once all their edges are known
+	if graph.Placement != nil {
+		shared.PlaceNewVertices(graph, newVertices, graph.Placement, randomGen)
 	}
 
 	return graph
 }
 
-// Function to calculate from sratch the workload of each shard
-func calculateShardWorkloads(graph *shared.Graph) []int {
-
-	workloads := make([]int, graph.NumberOfShards)
+// Function to create a new vertex, which is initially assigned a random shard
+// If the graph has a placement policy, the vertex is left without a shard, to be placed later
+func newVertex(id string, graph *shared.Graph, randomGen *rand.Rand) *shared.Vertex {
 
-	for _, v := range graph.Vertices { // Iterate through all vertices
-		for neighbourID, weight := range v.Edges { // Iterate through all neighbours
-			if v.Label == graph.Vertices[neighbourID].Label {
-				if v.ID < neighbourID { // Process undirected edge only once to avoid double counting
-					workloads[v.Label] += weight // Intra-shard tx
-				} else if v.ID == neighbourID {
-					workloads[v.Label] += weight // Self-loop (vertex connects to itself)
-				}
-			} else {
-				workloads[v.Label] += weight // Cross-shard tx
-			}
-		}
+	vertex := &shared.Vertex{
+		ID:    id,
+		Label: -1,
+		Edges: make(map[string]int),
+		Sent:  make(map[string]int),
+	}
+	if graph.Placement == nil {
+		vertex.Label = randomGen.Intn(graph.NumberOfShards)
 	}
-	return workloads
+
+	return vertex
 }
 
 func moveVertex(graph *shared.Graph, vertex *shared.Vertex, newShard int, rho int) {
@@ -121,34 +138,65 @@ func moveVertex(graph *shared.Graph, vertex *shared.Vertex, newShard int, rho in
 		return
 	}
 
+	// The paper's cost model does not depend on the direction of transactions, so looking it up can be skipped
+	directed := graph.CostModel != nil
+
 	// The shard workloads are not calculated from scratch but rather updated since this is more efficient
-	intra, crossWithNew, crossWithOthers, special_intra := 0, 0, 0, 0
+	// The edges are grouped by the shard of the neighbour, and the workloads are updated by the cost model
+	var intra, crossWithNew, crossWithOthers, special_intra shared.EdgeSums
 
 	for neighbour, weight := range vertex.Edges {
+		sent := 0
+		if directed {
+			sent = vertex.Sent[neighbour]
+		}
+		received := weight - sent
+
 		if graph.Vertices[neighbour].Label == oldShard {
 			// special_intra keeps track of txs that create self-loops
 			if graph.Vertices[neighbour].ID == vertex.ID {
-				special_intra += weight
+				special_intra.Add(sent, received)
 			} else {
-				intra += weight
+				intra.Add(sent, received)
 			}
 		} else if graph.Vertices[neighbour].Label == newShard {
-			crossWithNew += weight
+			crossWithNew.Add(sent, received)
 		} else {
-			crossWithOthers += weight
+			crossWithOthers.Add(sent, received)
 		}
 	}
 
+	// Update the workloads of shards
+	shared.ApplyMove(graph.WorkloadCostModel(), graph.ShardWorkloads, oldShard, newShard,
+		intra, crossWithNew, crossWithOthers, special_intra)
+
 	// Update the label of the vertex to the new shard
 	vertex.Label = newShard
 
 	// Increment the counter for number of times the vertex has updated its label
 	vertex.LabelUpdateCounter++
 
-	// Update the workloads of shards
-	graph.ShardWorkloads[oldShard] -= (crossWithNew + crossWithOthers + special_intra)
-	graph.ShardWorkloads[newShard] += crossWithOthers + intra + special_intra
+	// In debug mode, record the move, and check the workloads kept incrementally against the workloads worked out
+	// from scratch
+	graph.Checker.Moved(vertex.ID)
+	if graph.Checker.EveryMove() {
+		graph.Checker.CheckGraph(graph, shared.CalculateShardWorkloads(graph), vertex.ID)
+	}
+}
 
+// Function to start the invariant checks of a CLPA run on the graph, if they are on at the level kept in the graph,
+// checking the edges and the initial workloads
+func startInvariantChecks(graph *shared.Graph) {
+	graph.Checker = shared.NewInvariantChecker(graph.InvariantChecks)
+	graph.Checker.CheckGraphEdges(graph)
+	checkIteration(graph)
+}
+
+// Function to run the invariant checks after an iteration, if they are on
+func checkIteration(graph *shared.Graph) {
+	if graph.Checker.EveryIteration() {
+		graph.Checker.CheckGraph(graph, shared.CalculateShardWorkloads(graph), "")
+	}
 }
 
 // Score function: calculates how much a shard scores with respect to a vertex
@@ -307,6 +355,19 @@ func getBestShard(scores []*float64, randomGen *rand.Rand) int {
 // Function to set the random order of traversal of vertices
 func setVerticesOrder(graph *shared.Graph, randomGen *rand.Rand) []*shared.Vertex {
 
+	vertices := sortedVertices(graph)
+
+	// Shuffle the slice randomly
+	randomGen.Shuffle(len(vertices), func(i, j int) {
+		vertices[i], vertices[j] = vertices[j], vertices[i]
+	})
+
+	return vertices
+}
+
+// Function to get the vertices of the graph, sorted by their IDs
+func sortedVertices(graph *shared.Graph) []*shared.Vertex {
+
 	// Extract vertex ids from the map
 	ids := make([]string, 0, len(graph.Vertices))
 	for id := range graph.Vertices {
@@ -322,10 +383,16 @@ func setVerticesOrder(graph *shared.Graph, randomGen *rand.Rand) []*shared.Verte
 		vertices = append(vertices, graph.Vertices[key])
 	}
 
-	// Shuffle the slice randomly
-	randomGen.Shuffle(len(vertices), func(i, j int) {
-		vertices[i], vertices[j] = vertices[j], vertices[i]
-	})
-
 	return vertices
 }
+
+// Function to write the labels of the vertices, in the same order, into the labels slice, which is reused if possible
+func vertexLabels(vertices []*shared.Vertex, labels []int) []int {
+
+	labels = labels[:0]
+	for _, vertex := range vertices {
+		labels = append(labels, vertex.Label)
+	}
+
+	return labels
+}
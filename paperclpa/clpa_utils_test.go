@@ -0,0 +1,103 @@
+package paperclpa
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"example.com/shardinglpa/internal/testutil"
+	"example.com/shardinglpa/shared"
+)
+
+// Function to build a random graph with random labels, including self-loops and repeated transactions, with the
+// workloads worked out from scratch
+func randomGraph(randomGen *rand.Rand, numberOfVertices int, numberOfTransactions int, numberOfShards int,
+	model shared.CostModel) *shared.Graph {
+
+	graph := InitialiseGraphFromRows(testutil.RandomRows(randomGen, numberOfVertices, numberOfTransactions),
+		&shared.Graph{
+			Vertices:       make(map[string]*shared.Vertex),
+			NumberOfShards: numberOfShards,
+			CostModel:      model,
+		}, randomGen)
+	graph.ShardWorkloads = shared.CalculateShardWorkloads(graph)
+
+	return graph
+}
+
+// Moving vertices one after the other must keep the workloads equal to the ones worked out from scratch, under
+// every cost model
+func TestMoveVertexKeepsWorkloads(t *testing.T) {
+	testutil.CheckMovesKeepBookkeeping(t, func(randomGen *rand.Rand, model shared.CostModel) testutil.Labelling {
+		return testutil.NewGraphLabelling(randomGraph(randomGen, 30, 120, 4, model), moveVertex)
+	})
+}
+
+// A vertex only moves to another shard, and only until it has updated its label rho times
+func TestMoveVertexRespectsRho(t *testing.T) {
+	testutil.CheckMoveRespectsRho(t, func() testutil.Labelling {
+		return testutil.NewGraphLabelling(randomGraph(rand.New(rand.NewSource(2)), 20, 60, 4, nil), moveVertex)
+	})
+}
+
+// The workloads of the graphs built from the transactions add up to the cost of their edges, and follow their shards
+func TestCalculateShardWorkloadsProperties(t *testing.T) {
+	testutil.CheckWorkloadProperties(t, func(randomGen *rand.Rand, model shared.CostModel) *shared.Graph {
+		return randomGraph(randomGen, 30, 120, 4, model)
+	})
+}
+
+// Under both penalties, a shard only has a score if the vertex has an edge to it, and without a penalty the score is
+// the fraction of the weight of the edges of the vertex that go to the shard, so the scores add up to 1
+func TestCalculateScoresProperties(t *testing.T) {
+
+	penalties := []struct {
+		name           string
+		scoringPenalty ScoringPenalty
+	}{
+		{"paper", CalculateScoresPaper},
+		{"new", CalculateScoresNew},
+	}
+
+	for _, penalty := range penalties {
+		randomGen := rand.New(rand.NewSource(4))
+
+		for trial := 0; trial < 20; trial++ {
+			graph := randomGraph(randomGen, 30, 120, 4, nil)
+
+			// The penalty of the paper divides by the minimum workload, so it is undefined with an empty shard
+			if slices.Min(graph.ShardWorkloads) == 0 {
+				continue
+			}
+
+			for _, vertex := range sortedVertices(graph) {
+
+				// Work out the weight of the edges of the vertex to each shard
+				weights := make([]int, graph.NumberOfShards)
+				for neighbourID, weight := range vertex.Edges {
+					weights[graph.Vertices[neighbourID].Label] += weight
+				}
+
+				for _, beta := range []float64{0, 0.5, 1} {
+					scores := penalty.scoringPenalty(graph, vertex, beta)
+
+					total := 0.0
+					for shard, score := range scores {
+						if (score == nil) != (weights[shard] == 0) {
+							t.Fatalf("%s, trial %d, vertex %s, shard %d: score is %v, but the weight to the shard "+
+								"is %d", penalty.name, trial, vertex.ID, shard, score, weights[shard])
+						}
+						if beta == 0 && score != nil {
+							total += *score
+						}
+					}
+					if beta == 0 && math.Abs(total-1) > 1e-9 {
+						t.Fatalf("%s, trial %d, vertex %s: scores without penalty add up to %v, expected 1",
+							penalty.name, trial, vertex.ID, total)
+					}
+				}
+			}
+		}
+	}
+}
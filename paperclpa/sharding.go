@@ -1,9 +1,12 @@
 package paperclpa
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"math/rand"
+	"runtime"
+	"sync"
 	"time"
 
 	"example.com/shardinglpa/shared"
@@ -31,17 +34,24 @@ the epoch results
 func ShardAllocation(datasetDir string, shards int, epoch int, graph *shared.Graph, alpha float64, beta float64,
 	tau int, rho int, runClpaIter ClpaIterationMode, clpaCall ClpaCall, scoringPenalty ScoringPenalty) *shared.EpochResult {
 
+	// Run the allocation without any deadline
+	return ShardAllocationContext(context.Background(), datasetDir, shards, epoch, graph, alpha, beta, tau, rho,
+		runClpaIter, clpaCall, scoringPenalty)
+}
+
+/*
+Function to perform shard allocation, which can be stopped through the context
+
+If the context is cancelled or its deadline is exceeded, the CLPA iterations stop early and the best labelling
+found so far is kept. In that case, the Interrupted flag of the epoch results is set.
+*/
+func ShardAllocationContext(ctx context.Context, datasetDir string, shards int, epoch int, graph *shared.Graph,
+	alpha float64, beta float64, tau int, rho int, runClpaIter ClpaIterationMode, clpaCall ClpaCall,
+	scoringPenalty ScoringPenalty) *shared.EpochResult {
+
 	// Prepare rand
 	randomGen := rand.New(rand.NewSource(time.Now().UnixNano()))
 
-	// Create a new graph if it was not passed in to function
-	if graph == nil {
-		graph = &shared.Graph{
-			Vertices:       make(map[string]*shared.Vertex),
-			NumberOfShards: shards,
-		}
-	}
-
 	// Generate the filename dynamically based on the epoch value
 	filename := fmt.Sprintf("%sepoch_%d.csv", datasetDir, epoch)
 
@@ -52,6 +62,53 @@ func ShardAllocation(datasetDir string, shards int, epoch int, graph *shared.Gra
 		return nil
 	}
 
+	return ShardAllocationFromRows(ctx, rows, shards, graph, alpha, beta, tau, rho, randomGen, runClpaIter, clpaCall,
+		scoringPenalty)
+}
+
+/*
+Function to create the graph of the first epoch, with the settings of the config that the CLPA of the paper uses:
+the cost model, the sliding window of epochs whose edges are kept, the placement policy of new vertices, and the
+level of the invariant checks
+
+The graph is then passed to the first epoch and carried over to the next ones, which keep its settings.
+*/
+func NewGraph(shards int, config shared.AllocationConfig) *shared.Graph {
+
+	graph := &shared.Graph{
+		Vertices:        make(map[string]*shared.Vertex),
+		NumberOfShards:  shards,
+		CostModel:       config.CostModel,
+		Placement:       config.Placement,
+		InvariantChecks: config.InvariantChecks,
+	}
+
+	// Keep the edges of the last epochs in the graph, if a sliding window is set in the config
+	if config.EdgeWindow > 0 {
+		graph.SetEdgeWindow(config.EdgeWindow)
+	}
+
+	return graph
+}
+
+/*
+Function to perform shard allocation on the transactions in rows, instead of on the transactions of an epoch file
+
+The first row is the header, which must have a "from" and a "to" column. The random generator is used both to
+label new vertices and by the CLPA. Otherwise, this works in the same way as ShardAllocationContext.
+*/
+func ShardAllocationFromRows(ctx context.Context, rows [][]string, shards int, graph *shared.Graph,
+	alpha float64, beta float64, tau int, rho int, randomGen *rand.Rand, runClpaIter ClpaIterationMode,
+	clpaCall ClpaCall, scoringPenalty ScoringPenalty) *shared.EpochResult {
+
+	// Create a new graph if it was not passed in to function
+	if graph == nil {
+		graph = &shared.Graph{
+			Vertices:       make(map[string]*shared.Vertex),
+			NumberOfShards: shards,
+		}
+	}
+
 	// Initialise the graph with random shard labels for new vertices
 	graph = InitialiseGraphFromRows(rows, graph, randomGen)
 
@@ -69,10 +126,10 @@ func ShardAllocation(datasetDir string, shards int, epoch int, graph *shared.Gra
 	}
 
 	// Work out workloads for the first time this epoch
-	graph.ShardWorkloads = calculateShardWorkloads(graph)
+	graph.ShardWorkloads = shared.CalculateShardWorkloads(graph)
 
 	// Now that preparation is ready, the actual CLPA can run and the results recorded
-	result := clpaCall(alpha, beta, tau, rho, graph, randomGen, runClpaIter, scoringPenalty)
+	result := clpaCall(ctx, alpha, beta, tau, rho, graph, randomGen, runClpaIter, scoringPenalty)
 
 	// Add inactive vertices back to graph for the next epoch
 	for id, vertex := range inactiveVertices {
@@ -86,43 +143,94 @@ func ShardAllocation(datasetDir string, shards int, epoch int, graph *shared.Gra
 }
 
 // The CLPA function that continues iterations for all tau iterations irrespective of convergence, as per paper
-func RunClpaPaper(alpha float64, beta float64, tau int, rho int, graph *shared.Graph,
+func RunClpaPaper(ctx context.Context, alpha float64, beta float64, tau int, rho int, graph *shared.Graph,
 	randomGen *rand.Rand, runClpaIter ClpaIterationMode, scoringPenalty ScoringPenalty) *shared.EpochResult {
 
+	return runClpaPaper(ctx, alpha, beta, tau, rho, graph, randomGen, runClpaIter, scoringPenalty,
+		shared.DefaultStoppingRules())
+}
+
+// Function that returns the CLPA function that continues iterations for all tau iterations, as per paper, and records
+// the iteration in which the first of the stopping rules fired, together with the rule
+func NewRunClpaPaper(rules shared.StoppingRules) ClpaCall {
+	return func(ctx context.Context, alpha float64, beta float64, tau int, rho int, graph *shared.Graph,
+		randomGen *rand.Rand, runClpaIter ClpaIterationMode, scoringPenalty ScoringPenalty) *shared.EpochResult {
+		return runClpaPaper(ctx, alpha, beta, tau, rho, graph, randomGen, runClpaIter, scoringPenalty, rules)
+	}
+}
+
+// The CLPA function that continues iterations for all tau iterations, recording when a stopping rule first fired
+func runClpaPaper(ctx context.Context, alpha float64, beta float64, tau int, rho int, graph *shared.Graph,
+	randomGen *rand.Rand, runClpaIter ClpaIterationMode, scoringPenalty ScoringPenalty,
+	rules shared.StoppingRules) *shared.EpochResult {
+
 	convergenceIter := -1 // Default value if no convergence within iterations
+	stopReason := ""
+
+	// Keep track of the labels of the iterations, to find when a stopping rule fires
+	vertices := sortedVertices(graph)
+	labels := vertexLabels(vertices, nil)
+	monitor := rules.NewMonitor(labels)
+
+	// In debug mode, check the bookkeeping of the CLPA as it runs
+	startInvariantChecks(graph)
+
+	// Keep track of the best labelling, in case the iterations are cut short
+	tracker := shared.NewAnytimeTracker(ctx, graph, alpha)
+	interrupted := false
+
+	// Keep track of the fitness before the first iteration and after it, to measure the effect of the initial placement
+	_, _, initialFitness := shared.CalculateFitness(graph, alpha)
+	firstIterFitness := initialFitness
 
 	// Carry out CLPA iterations
 	for iter := 0; iter < tau; iter++ {
 
-		// Create a map with all old labels - meaning labels of vertices before current CLPA iteration
-		oldLabels := make(map[string]int)
-		for id, vertex := range graph.Vertices {
-			oldLabels[id] = vertex.Label
+		// Stop the iterations if the context was cancelled or its deadline was exceeded
+		if shared.Cancelled(ctx) {
+			interrupted = true
+			break
 		}
+		graph.Checker.StartIteration(iter)
 
 		// Perform an iteration of CLPA according to the mode (sync or async)
-		runClpaIter(graph, beta, randomGen, rho, scoringPenalty)
+		runClpaIter(ctx, graph, iter, beta, randomGen, rho, scoringPenalty)
+
+		// If the iteration was cut short, it is not taken into account for convergence
+		if shared.Cancelled(ctx) {
+			interrupted = true
+			break
+		}
+		checkIteration(graph)
+		tracker.Record(graph)
+		if iter == 0 {
+			_, _, firstIterFitness = shared.CalculateFitness(graph, alpha)
+		}
 
 		// If convergenceIter is not -1, then it was already found that the algorithm converged
 		// CLPA iterations should still continue, as stipulated in the paper
 		if convergenceIter == -1 {
-			converged := true
-
-			// Check if any vertex's label changed
-			for id, vertex := range graph.Vertices {
-				if oldLabels[id] != vertex.Label {
-					converged = false
-					break
-				}
+			labels = vertexLabels(vertices, labels)
+			iterationFitness := 0.0
+			if monitor.NeedsFitness() {
+				_, _, iterationFitness = shared.CalculateFitness(graph, alpha)
 			}
-			if converged {
+			if reason := monitor.Observe(labels, iterationFitness); reason != "" {
 
-				// Record the iteration number when convergence occurred (1-based)
+				// Record the iteration number when a stopping rule fired (1-based), and the rule
 				convergenceIter = iter + 1
+				stopReason = reason
 			}
 		}
 	}
 
+	graph.Checker = nil
+
+	// If the iterations were cut short, go back to the best labelling found so far
+	if interrupted && tracker.Restore(graph) {
+		graph.ShardWorkloads = shared.CalculateShardWorkloads(graph)
+	}
+
 	// Calculate the workload imbalance, number of cross shard transactions and fitness of the partitioning
 	workloadImbalance, crossShardWorkload, fitness := shared.CalculateFitness(graph, alpha)
 
@@ -133,48 +241,104 @@ func RunClpaPaper(alpha float64, beta float64, tau int, rho int, graph *shared.G
 		WorkloadImbalance:  workloadImbalance,
 		CrossShardWorkload: crossShardWorkload,
 		ConvergenceIter:    convergenceIter,
+		StopReason:         stopReason,
+		InitialFitness:     initialFitness,
+		FirstIterFitness:   firstIterFitness,
+		Metrics:            shared.CalculateMetrics(graph, alpha),
+		Interrupted:        interrupted,
 	}
 
 }
 
 // The CLPA function that stops iterations upon convergence
-func RunClpaConvergenceStop(alpha float64, beta float64, tau int, rho int, graph *shared.Graph,
+func RunClpaConvergenceStop(ctx context.Context, alpha float64, beta float64, tau int, rho int, graph *shared.Graph,
 	randomGen *rand.Rand, runClpaIter ClpaIterationMode, scoringPenalty ScoringPenalty) *shared.EpochResult {
 
+	return runClpaConvergenceStop(ctx, alpha, beta, tau, rho, graph, randomGen, runClpaIter, scoringPenalty,
+		shared.DefaultStoppingRules())
+}
+
+// Function that returns the CLPA function that stops iterations once the first of the stopping rules fires
+func NewRunClpaConvergenceStop(rules shared.StoppingRules) ClpaCall {
+	return func(ctx context.Context, alpha float64, beta float64, tau int, rho int, graph *shared.Graph,
+		randomGen *rand.Rand, runClpaIter ClpaIterationMode, scoringPenalty ScoringPenalty) *shared.EpochResult {
+		return runClpaConvergenceStop(ctx, alpha, beta, tau, rho, graph, randomGen, runClpaIter, scoringPenalty,
+			rules)
+	}
+}
+
+// The CLPA function that stops iterations once a stopping rule fires
+func runClpaConvergenceStop(ctx context.Context, alpha float64, beta float64, tau int, rho int, graph *shared.Graph,
+	randomGen *rand.Rand, runClpaIter ClpaIterationMode, scoringPenalty ScoringPenalty,
+	rules shared.StoppingRules) *shared.EpochResult {
+
 	convergenceIter := -1 // Default value if no convergence within iterations
+	stopReason := ""
+
+	// Keep track of the labels of the iterations, to find when a stopping rule fires
+	vertices := sortedVertices(graph)
+	labels := vertexLabels(vertices, nil)
+	monitor := rules.NewMonitor(labels)
+
+	// In debug mode, check the bookkeeping of the CLPA as it runs
+	startInvariantChecks(graph)
+
+	// Keep track of the best labelling, in case the iterations are cut short
+	tracker := shared.NewAnytimeTracker(ctx, graph, alpha)
+	interrupted := false
+
+	// Keep track of the fitness before the first iteration and after it, to measure the effect of the initial placement
+	_, _, initialFitness := shared.CalculateFitness(graph, alpha)
+	firstIterFitness := initialFitness
 
 	// Carry out CLPA iterations
 	for iter := 0; iter < tau; iter++ {
 
-		// Create a map with all old labels - meaning labels of vertices before current CLPA iteration
-		oldLabels := make(map[string]int)
-		for id, vertex := range graph.Vertices {
-			oldLabels[id] = vertex.Label
+		// Stop the iterations if the context was cancelled or its deadline was exceeded
+		if shared.Cancelled(ctx) {
+			interrupted = true
+			break
 		}
+		graph.Checker.StartIteration(iter)
 
 		// Perform an iteration of CLPA according to the mode (sync or async)
-		runClpaIter(graph, beta, randomGen, rho, scoringPenalty)
+		runClpaIter(ctx, graph, iter, beta, randomGen, rho, scoringPenalty)
 
-		// CLPA iterations should stop once convergence is reached
-		converged := true
+		// If the iteration was cut short, it is not taken into account for convergence
+		if shared.Cancelled(ctx) {
+			interrupted = true
+			break
+		}
+		checkIteration(graph)
+		tracker.Record(graph)
+		if iter == 0 {
+			_, _, firstIterFitness = shared.CalculateFitness(graph, alpha)
+		}
 
-		// Check if any vertex's label changed
-		for id, vertex := range graph.Vertices {
-			if oldLabels[id] != vertex.Label {
-				converged = false
-				break
-			}
+		// CLPA iterations should stop once a stopping rule fires, which by default is when no label changes
+		labels = vertexLabels(vertices, labels)
+		iterationFitness := 0.0
+		if monitor.NeedsFitness() {
+			_, _, iterationFitness = shared.CalculateFitness(graph, alpha)
 		}
-		if converged {
+		if reason := monitor.Observe(labels, iterationFitness); reason != "" {
 
-			// Record the iteration number when convergence occurred (1-based)
+			// Record the iteration number when a stopping rule fired (1-based), and the rule
 			convergenceIter = iter + 1
+			stopReason = reason
 
 			// Stop CLPA iterations in case of convergence
 			break
 		}
 	}
 
+	graph.Checker = nil
+
+	// If the iterations were cut short, go back to the best labelling found so far
+	if interrupted && tracker.Restore(graph) {
+		graph.ShardWorkloads = shared.CalculateShardWorkloads(graph)
+	}
+
 	// Calculate the workload imbalance, number of cross shard transactions and fitness of the partitioning
 	workloadImbalance, crossShardWorkload, fitness := shared.CalculateFitness(graph, alpha)
 
@@ -185,12 +349,17 @@ func RunClpaConvergenceStop(alpha float64, beta float64, tau int, rho int, graph
 		WorkloadImbalance:  workloadImbalance,
 		CrossShardWorkload: crossShardWorkload,
 		ConvergenceIter:    convergenceIter,
+		StopReason:         stopReason,
+		InitialFitness:     initialFitness,
+		FirstIterFitness:   firstIterFitness,
+		Metrics:            shared.CalculateMetrics(graph, alpha),
+		Interrupted:        interrupted,
 	}
 
 }
 
 // The CLPA function that tests convergence behaviour
-func RunClpaConvergenceTest(alpha float64, beta float64, tau int, rho int, graph *shared.Graph,
+func RunClpaConvergenceTest(ctx context.Context, alpha float64, beta float64, tau int, rho int, graph *shared.Graph,
 	randomGen *rand.Rand, runClpaIter ClpaIterationMode, scoringPenalty ScoringPenalty) *shared.EpochResult {
 
 	// Create slice to store boolean indicating whether a vertex changed label or not in each iteration
@@ -200,9 +369,27 @@ func RunClpaConvergenceTest(alpha float64, beta float64, tau int, rho int, graph
 	// Create slice to store the fitness of the partioning in each iteration
 	fitness := make([]float64, tau)
 
+	interrupted := false
+
+	// Keep track of the fitness before the first iteration, to measure the effect of the initial placement
+	_, _, initialFitness := shared.CalculateFitness(graph, alpha)
+
+	// In debug mode, check the bookkeeping of the CLPA as it runs
+	startInvariantChecks(graph)
+
 	// Carry out CLPA iterations
 	for iter := 0; iter < tau; iter++ {
 
+		// Stop the iterations if the context was cancelled or its deadline was exceeded
+		// Only the information of the iterations that were completed is kept
+		if shared.Cancelled(ctx) {
+			labelChanged = labelChanged[:iter]
+			fitness = fitness[:iter]
+			interrupted = true
+			break
+		}
+		graph.Checker.StartIteration(iter)
+
 		// Create a map with all old labels - meaning labels of vertices before current CLPA iteration
 		oldLabels := make(map[string]int)
 		for id, vertex := range graph.Vertices {
@@ -210,7 +397,8 @@ func RunClpaConvergenceTest(alpha float64, beta float64, tau int, rho int, graph
 		}
 
 		// Perform an iteration of CLPA according to the mode (sync or async)
-		runClpaIter(graph, beta, randomGen, rho, scoringPenalty)
+		runClpaIter(ctx, graph, iter, beta, randomGen, rho, scoringPenalty)
+		checkIteration(graph)
 
 		// Calculate the fitness of the partitioning for the current iteration
 		_, _, iterationfitness := shared.CalculateFitness(graph, alpha)
@@ -225,6 +413,7 @@ func RunClpaConvergenceTest(alpha float64, beta float64, tau int, rho int, graph
 		}
 
 	}
+	graph.Checker = nil
 
 	// Create IterationsInfo struct and populate it
 	iterationsInfo := &shared.IterationsInfo{
@@ -232,21 +421,35 @@ func RunClpaConvergenceTest(alpha float64, beta float64, tau int, rho int, graph
 		Fitness:      fitness,
 	}
 
+	firstIterFitness := initialFitness
+	if len(fitness) > 0 {
+		firstIterFitness = fitness[0]
+	}
+
 	// Return the epoch result with only the information about the iterations
 	return &shared.EpochResult{
-		IterationsInfo: iterationsInfo,
+		InitialFitness:   initialFitness,
+		FirstIterFitness: firstIterFitness,
+		IterationsInfo:   iterationsInfo,
+		Interrupted:      interrupted,
 	}
 }
 
 // The function that performs an iteration through all vertices and assigns shards
-func ClpaIterationAsync(graph *shared.Graph, beta float64, randomGen *rand.Rand,
+func ClpaIterationAsync(ctx context.Context, graph *shared.Graph, iter int, beta float64, randomGen *rand.Rand,
 	rho int, scoringPenalty ScoringPenalty) {
 
 	// Get a random order to use for this CLPA iteration
 	sortedVertices := setVerticesOrder(graph, randomGen)
 
 	// Iterate through each vertex in some order
-	for _, vertex := range sortedVertices {
+	for i, vertex := range sortedVertices {
+
+		// Every so often, stop the iteration if the context was cancelled
+		// Each move keeps the graph valid, so the iteration can stop after any vertex
+		if i%shared.ContextCheckInterval == 0 && shared.Cancelled(ctx) {
+			return
+		}
 
 		// Calculate the score of shards with respect to current vertex
 		scores := scoringPenalty(graph, vertex, beta)
@@ -261,14 +464,20 @@ func ClpaIterationAsync(graph *shared.Graph, beta float64, randomGen *rand.Rand,
 }
 
 // Alternative function for a CLPA iteration with sync mode of updating instead of async
-func ClpaIterationSync(graph *shared.Graph, beta float64, randomGen *rand.Rand,
+func ClpaIterationSync(ctx context.Context, graph *shared.Graph, iter int, beta float64, randomGen *rand.Rand,
 	rho int, scoringPenalty ScoringPenalty) {
 
 	// Get a random order to use for this CLPA iteration
 	sortedVertices := setVerticesOrder(graph, randomGen)
 
 	// Iterate through each vertex in some order
-	for _, vertex := range sortedVertices {
+	for i, vertex := range sortedVertices {
+
+		// Every so often, stop the iteration if the context was cancelled
+		// No label has been updated yet, so the graph is left as it was before the iteration
+		if i%shared.ContextCheckInterval == 0 && shared.Cancelled(ctx) {
+			return
+		}
 
 		// Calculate the score of shards with respect to current vertex
 		scores := scoringPenalty(graph, vertex, beta)
@@ -287,3 +496,129 @@ func ClpaIterationSync(graph *shared.Graph, beta float64, randomGen *rand.Rand,
 		moveVertex(graph, vertex, vertex.NewLabel, rho)
 	}
 }
+
+/*
+Function that returns a CLPA iteration with async mode of updating, where the shard each vertex moves to is picked
+by simulated annealing: it is sampled with softmax probabilities over the scores, at a temperature that decays
+after every iteration, rather than always being the shard with the highest score.
+
+The temperature is worked out from the iteration passed in by the CLPA run, as in My LPA, so the same iteration mode
+can be used for every epoch and by several goroutines at once. The shards are sampled with the seeded random
+generator passed in to the iteration, so the results stay deterministic for a given seed.
+*/
+func NewClpaIterationAsyncAnnealing(schedule shared.AnnealingSchedule) ClpaIterationMode {
+
+	return func(ctx context.Context, graph *shared.Graph, iter int, beta float64, randomGen *rand.Rand,
+		rho int, scoringPenalty ScoringPenalty) {
+
+		temperature := schedule.Temperature(iter)
+
+		// Get a random order to use for this CLPA iteration
+		sortedVertices := setVerticesOrder(graph, randomGen)
+
+		// Iterate through each vertex in some order
+		for i, vertex := range sortedVertices {
+
+			// Every so often, stop the iteration if the context was cancelled
+			// Each move keeps the graph valid, so the iteration can stop after any vertex
+			if i%shared.ContextCheckInterval == 0 && shared.Cancelled(ctx) {
+				return
+			}
+
+			// Calculate the score of shards with respect to current vertex
+			scores := scoringPenalty(graph, vertex, beta)
+
+			// Sample the shard with respect to current vertex, at the temperature of the iteration
+			shard := shared.SampleShard(scores, temperature, randomGen)
+
+			// Move current vertex to the sampled shard
+			moveVertex(graph, vertex, shard, rho)
+		}
+	}
+}
+
+// Number of vertices scored with the same random generator in the sync mode with parallel scoring
+const syncParallelChunkSize = 256
+
+/*
+Function that returns a CLPA iteration with sync mode of updating, where the scoring phase is split across
+a number of goroutines. Since in sync mode every vertex is scored using the labels of the previous iteration,
+the vertices can be scored independently of each other.
+
+The vertices are split into chunks of a fixed size, and each chunk is scored with its own random generator,
+derived from the seeded random generator passed in to the iteration. The goroutines take turns at the chunks, so
+the results stay deterministic for a given seed, whatever the number of goroutines.
+If the number of goroutines is not positive, it is set to the number of cores available.
+*/
+func NewClpaIterationSyncParallel(numberOfWorkers int) ClpaIterationMode {
+
+	if numberOfWorkers <= 0 {
+		numberOfWorkers = runtime.NumCPU()
+	}
+
+	return func(ctx context.Context, graph *shared.Graph, iter int, beta float64, randomGen *rand.Rand,
+		rho int, scoringPenalty ScoringPenalty) {
+
+		// Get a random order to use for this CLPA iteration
+		sortedVertices := setVerticesOrder(graph, randomGen)
+
+		// Derive the seeds of the chunks before launching any goroutine, so that the main random
+		// generator is always advanced by the same amount
+		chunkSeeds := make([]int64, (len(sortedVertices)+syncParallelChunkSize-1)/syncParallelChunkSize)
+		for i := range chunkSeeds {
+			chunkSeeds[i] = randomGen.Int63()
+		}
+
+		var wg sync.WaitGroup
+
+		for worker := 0; worker < min(numberOfWorkers, len(chunkSeeds)); worker++ {
+
+			wg.Add(1)
+
+			go func(worker int) {
+				defer wg.Done()
+
+				// Each goroutine scores every numberOfWorkers-th chunk of the vertices
+				for chunk := worker; chunk < len(chunkSeeds); chunk += numberOfWorkers {
+
+					// Stop scoring if the context was cancelled
+					if shared.Cancelled(ctx) {
+						return
+					}
+
+					// Use a separate random generator for each chunk
+					chunkRandomGen := rand.New(rand.NewSource(chunkSeeds[chunk]))
+
+					// The graph is only read during the scoring phase, and each goroutine writes the
+					// new label of its own vertices only
+					start := chunk * syncParallelChunkSize
+					end := min(start+syncParallelChunkSize, len(sortedVertices))
+					for _, vertex := range sortedVertices[start:end] {
+
+						// Calculate the score of shards with respect to current vertex
+						scores := scoringPenalty(graph, vertex, beta)
+
+						// Store the ID of the shard which the vertex should set its label to
+						vertex.NewLabel = getBestShard(scores, chunkRandomGen)
+					}
+				}
+			}(worker)
+		}
+
+		// Wait for the scoring phase to finish
+		wg.Wait()
+
+		// If the scoring phase was cut short, no label is updated, so the graph is left as it was
+		if shared.Cancelled(ctx) {
+			return
+		}
+
+		// The labels chosen by all goroutines are applied in a single merged pass, in the same order used
+		// to split the vertices, so that the shard workloads are updated one move at a time
+		for _, vertex := range sortedVertices {
+
+			// move vertex to new best shard
+			moveVertex(graph, vertex, vertex.NewLabel, rho)
+		}
+	}
+}
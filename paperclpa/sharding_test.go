@@ -0,0 +1,223 @@
+package paperclpa
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math/rand"
+	"slices"
+	"strings"
+	"testing"
+
+	"example.com/shardinglpa/internal/testutil"
+	"example.com/shardinglpa/shared"
+)
+
+// Replays the CLPA of the paper over the fixture epochs with a fixed seed, and pins the fitness, workloads and labels
+// of every epoch, for the update modes and penalties the tests suites compare
+func TestShardAllocationGolden(t *testing.T) {
+
+	variants := []struct {
+		name           string
+		runClpaIter    ClpaIterationMode
+		clpaCall       ClpaCall
+		scoringPenalty ScoringPenalty
+	}{
+		{"async_paper", ClpaIterationAsync, RunClpaPaper, CalculateScoresPaper},
+		{"sync_convergence_new", ClpaIterationSync, RunClpaConvergenceStop, CalculateScoresNew},
+	}
+
+	for _, variant := range variants {
+		t.Run(variant.name, func(t *testing.T) {
+
+			// The same generator is carried across epochs, as it labels the new vertices of each epoch
+			randomGen := rand.New(rand.NewSource(1))
+
+			var graph *shared.Graph
+			var out strings.Builder
+
+			for epoch := 1; epoch <= testutil.FixtureEpochs; epoch++ {
+
+				filename := fmt.Sprintf("%sepoch_%d.csv", testutil.FixtureDir, epoch)
+				rows, err := shared.ReadCSV(filename)
+				if err != nil {
+					t.Fatalf("Failed to read %s: %v", filename, err)
+				}
+
+				result := ShardAllocationFromRows(context.Background(), rows, 4, graph, 0.5, 0.5, 20, 50, randomGen,
+					variant.runClpaIter, variant.clpaCall, variant.scoringPenalty)
+				graph = result.Graph
+
+				// The workloads kept by the CLPA must match the workloads worked out from scratch
+				if workloads := shared.CalculateShardWorkloads(graph); !slices.Equal(workloads, graph.ShardWorkloads) {
+					t.Errorf("Epoch %d: workloads are %v, but %v from scratch", epoch, graph.ShardWorkloads,
+						workloads)
+				}
+
+				out.WriteString(testutil.DescribeResult(epoch, result))
+			}
+
+			testutil.CheckGolden(t, "shard_allocation_"+variant.name, out.String())
+		})
+	}
+}
+
+// The annealing mode works out the temperature from the iteration of the CLPA run, so reusing one mode for every
+// epoch cools down in the same way as a new mode for every epoch
+func TestAnnealingModeReusedAcrossEpochs(t *testing.T) {
+
+	schedule := shared.DefaultAnnealingSchedule()
+
+	replay := func(newMode func() ClpaIterationMode) string {
+		randomGen := rand.New(rand.NewSource(1))
+		var graph *shared.Graph
+		var out strings.Builder
+
+		for epoch := 1; epoch <= testutil.FixtureEpochs; epoch++ {
+			filename := fmt.Sprintf("%sepoch_%d.csv", testutil.FixtureDir, epoch)
+			rows, err := shared.ReadCSV(filename)
+			if err != nil {
+				t.Fatalf("Failed to read %s: %v", filename, err)
+			}
+			result := ShardAllocationFromRows(context.Background(), rows, 4, graph, 0.5, 0.5, 20, 50, randomGen,
+				newMode(), RunClpaPaper, CalculateScoresPaper)
+			graph = result.Graph
+			out.WriteString(testutil.DescribeResult(epoch, result))
+		}
+
+		return out.String()
+	}
+
+	reused := NewClpaIterationAsyncAnnealing(schedule)
+	got := replay(func() ClpaIterationMode { return reused })
+	want := replay(func() ClpaIterationMode { return NewClpaIterationAsyncAnnealing(schedule) })
+	if got != want {
+		t.Fatalf("Reusing the annealing mode across epochs gives different results than a new mode every epoch")
+	}
+}
+
+// The sync mode with parallel scoring gives the same labels whatever the number of goroutines, on a graph with
+// several chunks of vertices
+// Every shard gets the same score, so that every vertex breaks the tie at random and the labels depend on the
+// random generators of the goroutines
+func TestSyncParallelIndependentOfWorkers(t *testing.T) {
+
+	tiedScores := func(graph *shared.Graph, vertex *shared.Vertex, beta float64) []*float64 {
+		scores := make([]*float64, graph.NumberOfShards)
+		for shard := range scores {
+			scores[shard] = new(float64)
+		}
+		return scores
+	}
+
+	var want map[string]int
+
+	for _, workers := range []int{1, 2, 3, 8} {
+
+		graph := randomGraph(rand.New(rand.NewSource(3)), 1000, 4000, 4, nil)
+		runClpaIter := NewClpaIterationSyncParallel(workers)
+
+		randomGen := rand.New(rand.NewSource(4))
+		for iter := 0; iter < 5; iter++ {
+			runClpaIter(context.Background(), graph, iter, 0.5, randomGen, 50, tiedScores)
+		}
+
+		labels := make(map[string]int, len(graph.Vertices))
+		for id, vertex := range graph.Vertices {
+			labels[id] = vertex.Label
+		}
+		if want == nil {
+			want = labels
+		} else if !maps.Equal(labels, want) {
+			t.Fatalf("%d goroutines give different labels than 1 goroutine", workers)
+		}
+	}
+}
+
+// With a sliding window of K epochs, the edges and sent weights of the graph after each epoch are the sum of the
+// transactions of the last K epochs, including self-loops, and edges whose weight drops to zero are removed
+func TestEdgeWindowKeepsLastEpochs(t *testing.T) {
+
+	const windowSize = 2
+
+	// Transactions of each epoch, where the edge from a to b and the self-loop of c are only in the first epoch,
+	// so they drop to zero once it falls out of the window, and d only transacts in the first epoch
+	epochs := [][][2]string{
+		{{"a", "b"}, {"a", "b"}, {"b", "a"}, {"c", "c"}, {"c", "d"}, {"e", "e"}},
+		{{"b", "c"}, {"c", "b"}, {"e", "e"}, {"a", "e"}},
+		{{"e", "e"}, {"b", "c"}, {"a", "c"}},
+		{{"c", "a"}, {"b", "b"}},
+	}
+
+	randomGen := rand.New(rand.NewSource(1))
+	graph := NewGraph(2, shared.AllocationConfig{EdgeWindow: windowSize})
+
+	for epoch := range epochs {
+
+		rows := [][]string{{"from", "to"}}
+		for _, transaction := range epochs[epoch] {
+			rows = append(rows, []string{transaction[0], transaction[1]})
+		}
+		result := ShardAllocationFromRows(context.Background(), rows, 2, graph, 0.5, 0.5, 5, 50, randomGen,
+			ClpaIterationAsync, RunClpaPaper, CalculateScoresPaper)
+		graph = result.Graph
+
+		// Work out the edges and sent weights of the epochs in the window from scratch
+		edges := make(map[string]map[string]int)
+		sent := make(map[string]map[string]int)
+		add := func(weights map[string]map[string]int, from string, to string) {
+			if weights[from] == nil {
+				weights[from] = make(map[string]int)
+			}
+			weights[from][to]++
+		}
+		for _, transactions := range epochs[max(0, epoch-windowSize+1) : epoch+1] {
+			for _, transaction := range transactions {
+				from, to := transaction[0], transaction[1]
+				add(edges, from, to)
+				if from != to {
+					add(edges, to, from)
+				}
+				add(sent, from, to)
+			}
+		}
+
+		for id, vertex := range graph.Vertices {
+			if !maps.Equal(vertex.Edges, edges[id]) || !maps.Equal(vertex.Sent, sent[id]) {
+				t.Fatalf("Epoch %d, vertex %s: edges %v and sent %v, expected %v and %v", epoch+1, id,
+					vertex.Edges, vertex.Sent, edges[id], sent[id])
+			}
+		}
+
+		// The workloads must still match the workloads worked out from scratch
+		if workloads := shared.CalculateShardWorkloads(graph); !slices.Equal(workloads, graph.ShardWorkloads) {
+			t.Fatalf("Epoch %d: workloads are %v, but %v from scratch", epoch+1, graph.ShardWorkloads, workloads)
+		}
+	}
+}
+
+// The level of the invariant checks set in the config of NewGraph turns on the checks of the CLPA run on the graph
+func TestNewGraphKeepsInvariantChecks(t *testing.T) {
+
+	rows := [][]string{{"from", "to"}, {"a", "b"}, {"b", "c"}, {"c", "d"}, {"d", "a"}}
+
+	// A penalty that skews the workloads kept by the CLPA before scoring, which only the checks can notice
+	skewingPenalty := func(graph *shared.Graph, v *shared.Vertex, beta float64) []*float64 {
+		graph.ShardWorkloads[0]++
+		return CalculateScoresPaper(graph, v, beta)
+	}
+
+	for _, level := range []shared.InvariantCheckLevel{shared.NoInvariantChecks, shared.CheckEveryIteration} {
+		graph := NewGraph(2, shared.AllocationConfig{InvariantChecks: level})
+
+		panicked := func() (panicked bool) {
+			defer func() { panicked = recover() != nil }()
+			ShardAllocationFromRows(context.Background(), rows, 2, graph, 0.5, 0.5, 5, 50,
+				rand.New(rand.NewSource(1)), ClpaIterationAsync, RunClpaPaper, skewingPenalty)
+			return false
+		}()
+		if checksOn := level != shared.NoInvariantChecks; panicked != checksOn {
+			t.Errorf("Level %d: the CLPA panicked %v, expected %v", level, panicked, checksOn)
+		}
+	}
+}
@@ -0,0 +1,432 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"example.com/shardinglpa/clpaparallel"
+	"example.com/shardinglpa/mylpa"
+	"example.com/shardinglpa/paperclpa"
+	"example.com/shardinglpa/shared"
+)
+
+/*
+Server keeps a graph in memory and serves shard lookups and re-allocations over an HTTP/JSON API
+
+The API is:
+
+	GET  /shard?account=X  the shard account X is on
+	GET  /workloads        the current workload of each shard
+	POST /transactions     add a batch of transactions, to be used by the next re-allocation
+	POST /reallocate       run a re-allocation on the pending transactions, with the chosen variant and config
+
+A re-allocation works on a copy of the graph, which replaces the graph once it finishes. So lookups are still
+answered from the previous allocation while a re-allocation is running. Only one re-allocation runs at a time.
+
+Server implements http.Handler, so it can be tested with httptest without opening any ports.
+*/
+type Server struct {
+	mux *http.ServeMux
+
+	// Protects the fields below
+	mu sync.RWMutex
+
+	graph          *shared.Graph
+	numberOfShards int
+
+	// The number of re-allocations run so far, used as the epoch number
+	epoch int
+
+	// The transactions added since the last re-allocation, with the header row first
+	pending [][]string
+
+	// Held while a re-allocation is running
+	reallocating sync.Mutex
+}
+
+// A transaction between two accounts, as sent to /transactions
+type Transaction struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Largest body accepted by /transactions, in bytes
+const maxTransactionsBody = 32 << 20
+
+// Largest body accepted by /reallocate, in bytes
+const maxReallocationBody = 1 << 20
+
+// Most seeds a re-allocation can run, whether they are given or picked at random
+const maxSeeds = 64
+
+/*
+The settings of a re-allocation, as sent to /reallocate
+
+The variant is one of "paper", "parallel" or "mylpa" (the default). Any setting that is left out takes the
+default value used in the tests, while a setting given as zero is kept, so that alpha or beta can be 0. If no seeds
+are given, numberOfSeeds random seeds are used (4 by default, at most maxSeeds). If timeoutMs is set, the
+re-allocation keeps the best labelling found within that time.
+*/
+type ReallocationRequest struct {
+	Variant       string  `json:"variant"`
+	Alpha         float64 `json:"alpha"`
+	Beta          float64 `json:"beta"`
+	Tau           int     `json:"tau"`
+	Rho           int     `json:"rho"`
+	Seeds         []int64 `json:"seeds"`
+	NumberOfSeeds int     `json:"numberOfSeeds"`
+	MaxWorkers    int     `json:"maxWorkers"`
+	MemoryBudget  int64   `json:"memoryBudget"`
+	TimeoutMs     int64   `json:"timeoutMs"`
+}
+
+// The outcome of a re-allocation, as returned by /reallocate
+type ReallocationResponse struct {
+	Epoch              int     `json:"epoch"`
+	Variant            string  `json:"variant"`
+	Transactions       int     `json:"transactions"`
+	Fitness            float64 `json:"fitness"`
+	WorkloadImbalance  float64 `json:"workloadImbalance"`
+	CrossShardWorkload int     `json:"crossShardWorkload"`
+	ConvergenceIter    int     `json:"convergenceIter"`
+	Interrupted        bool    `json:"interrupted"`
+	MovedAccounts      int     `json:"movedAccounts"`
+	ShardWorkloads     []int   `json:"shardWorkloads"`
+}
+
+// Function to create a server over the given graph, or over an empty graph if it is nil
+func New(numberOfShards int, graph *shared.Graph) *Server {
+
+	if graph == nil {
+		graph = &shared.Graph{
+			Vertices:       make(map[string]*shared.Vertex),
+			NumberOfShards: numberOfShards,
+		}
+	}
+
+	server := &Server{
+		mux:            http.NewServeMux(),
+		graph:          graph,
+		numberOfShards: numberOfShards,
+		pending:        [][]string{{"from", "to"}},
+	}
+
+	server.mux.HandleFunc("/shard", server.handleShard)
+	server.mux.HandleFunc("/workloads", server.handleWorkloads)
+	server.mux.HandleFunc("/transactions", server.handleTransactions)
+	server.mux.HandleFunc("/reallocate", server.handleReallocate)
+
+	return server
+}
+
+// Function to run a server on the given address, until it fails
+func ListenAndServe(addr string, numberOfShards int) error {
+	log.Printf("Shard allocation server listening on %s", addr)
+	return http.ListenAndServe(addr, New(numberOfShards, nil))
+}
+
+func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.mux.ServeHTTP(w, r)
+}
+
+// GET /shard?account=X
+func (server *Server) handleShard(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	account := r.URL.Query().Get("account")
+	if account == "" {
+		writeError(w, http.StatusBadRequest, "missing account")
+		return
+	}
+
+	server.mu.RLock()
+	vertex, exists := server.graph.Vertices[account]
+	shard := 0
+	if exists {
+		shard = vertex.Label
+	}
+	epoch := server.epoch
+	server.mu.RUnlock()
+
+	// Accounts that were only seen in pending transactions are not allocated yet
+	if !exists {
+		writeError(w, http.StatusNotFound, "account not allocated")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"account": account,
+		"shard":   shard,
+		"epoch":   epoch,
+	})
+}
+
+// GET /workloads
+func (server *Server) handleWorkloads(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	server.mu.RLock()
+	defer server.mu.RUnlock()
+
+	// Before the first re-allocation, every shard has no workload
+	workloads := append([]int(nil), server.graph.ShardWorkloads...)
+	if workloads == nil {
+		workloads = make([]int, server.numberOfShards)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"epoch":               server.epoch,
+		"numberOfShards":      server.numberOfShards,
+		"accounts":            len(server.graph.Vertices),
+		"pendingTransactions": len(server.pending) - 1,
+		"shardWorkloads":      workloads,
+	})
+}
+
+// POST /transactions, with a JSON array of transactions as the body
+func (server *Server) handleTransactions(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var transactions []Transaction
+	body := http.MaxBytesReader(w, r.Body, maxTransactionsBody)
+	if err := json.NewDecoder(body).Decode(&transactions); err != nil {
+		writeError(w, decodeErrorStatus(err), fmt.Sprintf("invalid transactions: %v", err))
+		return
+	}
+
+	for i, transaction := range transactions {
+		if transaction.From == "" || transaction.To == "" {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("transaction %d is missing an account", i))
+			return
+		}
+	}
+
+	server.mu.Lock()
+	for _, transaction := range transactions {
+		server.pending = append(server.pending, []string{transaction.From, transaction.To})
+	}
+	pending := len(server.pending) - 1
+	server.mu.Unlock()
+
+	writeJSON(w, http.StatusAccepted, map[string]any{
+		"accepted":            len(transactions),
+		"pendingTransactions": pending,
+	})
+}
+
+// POST /reallocate, with a JSON ReallocationRequest as the body (which can be empty)
+func (server *Server) handleReallocate(w http.ResponseWriter, r *http.Request) {
+
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	request, err := decodeReallocationRequest(http.MaxBytesReader(w, r.Body, maxReallocationBody))
+	if err != nil {
+		writeError(w, decodeErrorStatus(err), err.Error())
+		return
+	}
+
+	// Only one re-allocation runs at a time
+	if !server.reallocating.TryLock() {
+		writeError(w, http.StatusConflict, "a re-allocation is already running")
+		return
+	}
+	defer server.reallocating.Unlock()
+
+	// Take the pending transactions and a copy of the graph, so lookups carry on while the allocation runs
+	server.mu.Lock()
+	rows := server.pending
+	if len(rows) <= 1 {
+		server.mu.Unlock()
+		writeError(w, http.StatusBadRequest, "no pending transactions")
+		return
+	}
+	server.pending = [][]string{{"from", "to"}}
+	graph := shared.DeepCopyGraph(server.graph)
+	before := shared.SnapshotLabels(server.graph)
+	epoch := server.epoch + 1
+	server.mu.Unlock()
+
+	// Stop the allocation if the client goes away, or once the timeout is reached
+	ctx := r.Context()
+	if request.TimeoutMs > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, time.Duration(request.TimeoutMs)*time.Millisecond)
+		defer cancel()
+	}
+
+	result, graph := server.allocate(ctx, request, rows, graph)
+
+	// If the allocation failed, the transactions are put back so that they are not lost
+	if result == nil {
+		server.mu.Lock()
+		server.pending = append(rows, server.pending[1:]...)
+		server.mu.Unlock()
+		writeError(w, http.StatusInternalServerError, "re-allocation failed")
+		return
+	}
+
+	moved, _ := shared.CountMovedVertices(before, graph)
+
+	server.mu.Lock()
+	server.graph = graph
+	server.epoch = epoch
+	server.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, ReallocationResponse{
+		Epoch:              epoch,
+		Variant:            request.Variant,
+		Transactions:       len(rows) - 1,
+		Fitness:            result.Fitness,
+		WorkloadImbalance:  result.WorkloadImbalance,
+		CrossShardWorkload: result.CrossShardWorkload,
+		ConvergenceIter:    result.ConvergenceIter,
+		Interrupted:        result.Interrupted,
+		MovedAccounts:      moved,
+		ShardWorkloads:     graph.ShardWorkloads,
+	})
+}
+
+// Function to run the chosen variant on the rows and the copy of the graph
+// It returns the result of the best seed and the new graph, or a nil result if the allocation failed
+func (server *Server) allocate(ctx context.Context, request ReallocationRequest, rows [][]string,
+	graph *shared.Graph) (*shared.EpochResult, *shared.Graph) {
+
+	if request.Variant == "paper" {
+		randomGen := rand.New(rand.NewSource(request.Seeds[0]))
+		result := paperclpa.ShardAllocationFromRows(ctx, rows, server.numberOfShards, graph, request.Alpha,
+			request.Beta, request.Tau, request.Rho, randomGen, paperclpa.ClpaIterationAsync, paperclpa.RunClpaPaper,
+			paperclpa.CalculateScoresPaper)
+		if result == nil {
+			return nil, nil
+		}
+		return result, result.Graph
+	}
+
+	config := shared.AllocationConfig{
+		MaxWorkers:   request.MaxWorkers,
+		MemoryBudget: request.MemoryBudget,
+	}
+
+	var seedsResults []*shared.EpochResult
+	var inactiveVertices map[string]*shared.Vertex
+	if request.Variant == "parallel" {
+		seedsResults, inactiveVertices = clpaparallel.ShardAllocationFromRows(ctx, rows, server.numberOfShards, graph,
+			request.Alpha, request.Beta, request.Tau, request.Rho, request.Seeds, config)
+	} else {
+		seedsResults, inactiveVertices = mylpa.ShardAllocationFromRows(ctx, rows, server.numberOfShards, graph,
+			request.Alpha, request.Beta, request.Tau, request.Rho, request.Seeds, config)
+	}
+
+	// Find the best result before GetBestGraph discards the labels of the other seeds
+	var bestResult *shared.EpochResult
+	for _, result := range seedsResults {
+		if !result.Pruned && (bestResult == nil || result.Fitness < bestResult.Fitness) {
+			bestResult = result
+		}
+	}
+	if bestResult == nil {
+		return nil, nil
+	}
+
+	// Get the best graph, and add the inactive vertices back so that they can still be looked up
+	graph = shared.GetBestGraph(seedsResults)
+	for id, vertex := range inactiveVertices {
+		graph.Vertices[id] = vertex
+	}
+
+	return bestResult, graph
+}
+
+// Function to decode the settings of a re-allocation, where the settings that are left out take the defaults used
+// in the tests, and to check them
+// The body can be empty, in which case every setting takes its default
+func decodeReallocationRequest(body io.Reader) (ReallocationRequest, error) {
+
+	// Decode into the defaults, so that only the settings that are given replace them
+	request := ReallocationRequest{
+		Variant:       "mylpa",
+		Alpha:         0.5,
+		Beta:          0.5,
+		Tau:           100,
+		Rho:           50,
+		NumberOfSeeds: 4,
+	}
+	if err := json.NewDecoder(body).Decode(&request); err != nil && !errors.Is(err, io.EOF) {
+		return request, fmt.Errorf("invalid request: %w", err)
+	}
+
+	switch request.Variant {
+	case "":
+		request.Variant = "mylpa"
+	case "paper", "parallel", "mylpa":
+	default:
+		return request, fmt.Errorf("unknown variant %q, expected paper, parallel or mylpa", request.Variant)
+	}
+
+	if request.Alpha < 0 || request.Alpha > 1 || request.Beta < 0 || request.Beta > 1 ||
+		request.Tau < 0 || request.Rho < 0 || request.TimeoutMs < 0 {
+		return request, errors.New("invalid settings")
+	}
+
+	if len(request.Seeds) > maxSeeds {
+		return request, fmt.Errorf("%d seeds given, at most %d are allowed", len(request.Seeds), maxSeeds)
+	}
+	if len(request.Seeds) == 0 {
+		if request.NumberOfSeeds < 1 || request.NumberOfSeeds > maxSeeds {
+			return request, fmt.Errorf("numberOfSeeds must be between 1 and %d", maxSeeds)
+		}
+		randomGen := rand.New(rand.NewSource(time.Now().UnixNano()))
+		request.Seeds = make([]int64, request.NumberOfSeeds)
+		for i := range request.Seeds {
+			request.Seeds[i] = randomGen.Int63()
+		}
+	}
+
+	return request, nil
+}
+
+// Function to get the status of a body that could not be decoded, which tells a body that is too large apart
+func decodeErrorStatus(err error) int {
+	var maxBytesError *http.MaxBytesError
+	if errors.As(err, &maxBytesError) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// Function to write a value as the JSON body of the response
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(value); err != nil {
+		log.Printf("Error writing response: %v", err)
+	}
+}
+
+// Function to write an error as the JSON body of the response
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Function to send a request to the server and decode the JSON body of the response into out (if not nil)
+func do(t *testing.T, server *Server, method string, target string, body string, out any) int {
+	t.Helper()
+
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, httptest.NewRequest(method, target, strings.NewReader(body)))
+
+	if out != nil {
+		if err := json.Unmarshal(recorder.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: failed to decode response %q: %v", method, target, recorder.Body.String(), err)
+		}
+	}
+	return recorder.Code
+}
+
+// Function to build a batch of transactions within four groups of accounts, as the JSON body of /transactions
+func transactionsBody() string {
+	var transactions []Transaction
+	for i := 0; i < 80; i++ {
+		group := i % 4
+		transactions = append(transactions, Transaction{
+			From: fmt.Sprintf("0x%d%d", group, i%5),
+			To:   fmt.Sprintf("0x%d%d", group, (i+1)%5),
+		})
+	}
+	body, _ := json.Marshal(transactions)
+	return string(body)
+}
+
+// Accounts can only be looked up once a re-allocation has placed them, and the workloads follow the re-allocations
+func TestLookupsAndReallocation(t *testing.T) {
+
+	server := New(4, nil)
+
+	var workloads struct {
+		Epoch               int   `json:"epoch"`
+		Accounts            int   `json:"accounts"`
+		PendingTransactions int   `json:"pendingTransactions"`
+		ShardWorkloads      []int `json:"shardWorkloads"`
+	}
+	if code := do(t, server, http.MethodGet, "/workloads", "", &workloads); code != http.StatusOK ||
+		!slices.Equal(workloads.ShardWorkloads, []int{0, 0, 0, 0}) {
+		t.Fatalf("GET /workloads before any re-allocation: status %d, workloads %v", code, workloads.ShardWorkloads)
+	}
+
+	if code := do(t, server, http.MethodPost, "/transactions", transactionsBody(), nil); code != http.StatusAccepted {
+		t.Fatalf("POST /transactions: status %d", code)
+	}
+	if code := do(t, server, http.MethodGet, "/shard?account=0x00", "", nil); code != http.StatusNotFound {
+		t.Fatalf("GET /shard of a pending account: status %d, expected %d", code, http.StatusNotFound)
+	}
+
+	var response ReallocationResponse
+	code := do(t, server, http.MethodPost, "/reallocate", `{"seeds": [1, 2], "tau": 10}`, &response)
+	if code != http.StatusOK {
+		t.Fatalf("POST /reallocate: status %d", code)
+	}
+	if response.Epoch != 1 || response.Variant != "mylpa" || response.Transactions != 80 {
+		t.Fatalf("POST /reallocate: unexpected response %+v", response)
+	}
+
+	var shard struct {
+		Shard int `json:"shard"`
+		Epoch int `json:"epoch"`
+	}
+	if code := do(t, server, http.MethodGet, "/shard?account=0x00", "", &shard); code != http.StatusOK ||
+		shard.Shard < 0 || shard.Shard >= 4 || shard.Epoch != 1 {
+		t.Fatalf("GET /shard: status %d, shard %d, epoch %d", code, shard.Shard, shard.Epoch)
+	}
+
+	do(t, server, http.MethodGet, "/workloads", "", &workloads)
+	if workloads.Epoch != 1 || workloads.Accounts != 20 || workloads.PendingTransactions != 0 ||
+		!slices.Equal(workloads.ShardWorkloads, response.ShardWorkloads) {
+		t.Fatalf("GET /workloads after a re-allocation: %+v, expected the workloads %v", workloads,
+			response.ShardWorkloads)
+	}
+
+	// A re-allocation needs pending transactions
+	if code := do(t, server, http.MethodPost, "/reallocate", "", nil); code != http.StatusBadRequest {
+		t.Fatalf("POST /reallocate without pending transactions: status %d", code)
+	}
+}
+
+// Every variant can be chosen, and alpha can be set to 0, in which case the fitness is the workload imbalance
+func TestReallocationSettings(t *testing.T) {
+
+	for _, variant := range []string{"paper", "parallel", "mylpa"} {
+		server := New(4, nil)
+		do(t, server, http.MethodPost, "/transactions", transactionsBody(), nil)
+
+		var response ReallocationResponse
+		body := fmt.Sprintf(`{"variant": %q, "alpha": 0, "seeds": [3], "tau": 10}`, variant)
+		if code := do(t, server, http.MethodPost, "/reallocate", body, &response); code != http.StatusOK {
+			t.Fatalf("%s: POST /reallocate: status %d", variant, code)
+		}
+		if response.Variant != variant || response.Fitness != response.WorkloadImbalance {
+			t.Fatalf("%s: fitness %v with alpha 0, expected the imbalance %v", variant, response.Fitness,
+				response.WorkloadImbalance)
+		}
+	}
+
+	request, err := decodeReallocationRequest(strings.NewReader(`{"beta": 0}`))
+	if err != nil || request.Alpha != 0.5 || request.Beta != 0 || request.Tau != 100 || request.Rho != 50 ||
+		len(request.Seeds) != 4 {
+		t.Fatalf("Decoding a request with beta 0 gave %+v, %v", request, err)
+	}
+}
+
+// Invalid requests and bodies that are too large are rejected
+func TestInvalidRequests(t *testing.T) {
+
+	server := New(4, nil)
+	do(t, server, http.MethodPost, "/transactions", transactionsBody(), nil)
+
+	cases := []struct {
+		method string
+		target string
+		body   string
+		status int
+	}{
+		{http.MethodPost, "/shard?account=0x00", "", http.StatusMethodNotAllowed},
+		{http.MethodGet, "/shard", "", http.StatusBadRequest},
+		{http.MethodGet, "/transactions", "", http.StatusMethodNotAllowed},
+		{http.MethodPost, "/transactions", `[{"from": "0x00"}]`, http.StatusBadRequest},
+		{http.MethodPost, "/transactions", "not json", http.StatusBadRequest},
+		{http.MethodPost, "/transactions", "[" + strings.Repeat(`{"from":"a","to":"b"},`, maxTransactionsBody/20) +
+			"]", http.StatusRequestEntityTooLarge},
+		{http.MethodPost, "/reallocate", `{"variant": "other"}`, http.StatusBadRequest},
+		{http.MethodPost, "/reallocate", `{"alpha": 2}`, http.StatusBadRequest},
+		{http.MethodPost, "/reallocate", `{"numberOfSeeds": 1000000000}`, http.StatusBadRequest},
+		{http.MethodPost, "/reallocate", `{"numberOfSeeds": 0}`, http.StatusBadRequest},
+		{http.MethodPost, "/reallocate", `{"seeds": [` + strings.Repeat("1,", maxSeeds) + `1]}`,
+			http.StatusBadRequest},
+		{http.MethodPost, "/reallocate", `{"variant": "` + strings.Repeat("x", maxReallocationBody) + `"}`,
+			http.StatusRequestEntityTooLarge},
+	}
+
+	for _, c := range cases {
+		if code := do(t, server, c.method, c.target, c.body, nil); code != c.status {
+			t.Errorf("%s %s (%d bytes): status %d, expected %d", c.method, c.target, len(c.body), code, c.status)
+		}
+	}
+}
+
+// Only one re-allocation runs at a time, and a second one is turned away with 409 without taking the transactions
+func TestReallocationConflict(t *testing.T) {
+
+	server := New(4, nil)
+	do(t, server, http.MethodPost, "/transactions", transactionsBody(), nil)
+
+	// Hold the lock taken by a running re-allocation
+	server.reallocating.Lock()
+	code := do(t, server, http.MethodPost, "/reallocate", `{"seeds": [1]}`, nil)
+	server.reallocating.Unlock()
+	if code != http.StatusConflict {
+		t.Fatalf("POST /reallocate while one is running: status %d, expected %d", code, http.StatusConflict)
+	}
+
+	var workloads struct {
+		PendingTransactions int `json:"pendingTransactions"`
+	}
+	do(t, server, http.MethodGet, "/workloads", "", &workloads)
+	if workloads.PendingTransactions != 80 {
+		t.Fatalf("%d pending transactions after the conflict, expected 80", workloads.PendingTransactions)
+	}
+
+	if code := do(t, server, http.MethodPost, "/reallocate", `{"seeds": [1], "tau": 10}`, nil); code != http.StatusOK {
+		t.Fatalf("POST /reallocate once the other one finished: status %d", code)
+	}
+}
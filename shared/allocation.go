@@ -0,0 +1,191 @@
+package shared
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+/*
+An allocation is the mapping of each account to its shard at the end of an epoch.
+It can be exported to CSV or JSON so that it can be replayed outside of this project, and two exported
+allocations can be compared to list the accounts that moved shard between the two epochs.
+
+The CSV format has the header epoch,account,shard and one row per account, sorted by account.
+The JSON format is an object with the epoch, the number of shards, and the shard of each account.
+*/
+type Allocation struct {
+	Epoch          int            `json:"epoch"`
+	NumberOfShards int            `json:"numberOfShards"`
+	Accounts       map[string]int `json:"accounts"`
+}
+
+// An account that is in a different shard in two allocations
+type AccountMove struct {
+	Account   string
+	FromShard int
+	ToShard   int
+}
+
+// Function to get the allocation of the graph at the end of an epoch
+func NewAllocation(graph *Graph, epoch int) *Allocation {
+	return &Allocation{
+		Epoch:          epoch,
+		NumberOfShards: graph.NumberOfShards,
+		Accounts:       SnapshotLabels(graph),
+	}
+}
+
+// Function to export the allocation of the graph at the end of an epoch
+// The format is chosen from the extension of the path, which must be .csv or .json
+func ExportAllocation(path string, graph *Graph, epoch int) error {
+	return NewAllocation(graph, epoch).Save(path)
+}
+
+// Function to save the allocation, in the format chosen from the extension of the path (.csv or .json)
+func (allocation *Allocation) Save(path string) error {
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating allocation file: %w", err)
+	}
+	defer file.Close()
+
+	switch strings.ToLower(filepath.Ext(path)) {
+
+	case ".json":
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(allocation); err != nil {
+			return fmt.Errorf("error writing allocation: %w", err)
+		}
+
+	case ".csv":
+		writer := csv.NewWriter(file)
+		writer.Write([]string{"epoch", "account", "shard"})
+
+		epoch := strconv.Itoa(allocation.Epoch)
+		for _, account := range allocation.sortedAccounts() {
+			writer.Write([]string{epoch, account, strconv.Itoa(allocation.Accounts[account])})
+		}
+
+		writer.Flush()
+		if err := writer.Error(); err != nil {
+			return fmt.Errorf("error writing allocation: %w", err)
+		}
+
+	default:
+		return fmt.Errorf("unknown allocation format for %s, expected .csv or .json", path)
+	}
+
+	return file.Close()
+}
+
+// Function to load an allocation exported by ExportAllocation
+// The number of shards is not kept in the CSV format, so it is worked out from the highest shard in use
+func LoadAllocation(path string) (*Allocation, error) {
+
+	switch strings.ToLower(filepath.Ext(path)) {
+
+	case ".json":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading allocation file: %w", err)
+		}
+		allocation := &Allocation{}
+		if err := json.Unmarshal(data, allocation); err != nil {
+			return nil, fmt.Errorf("error reading allocation: %w", err)
+		}
+		if allocation.Accounts == nil {
+			allocation.Accounts = make(map[string]int)
+		}
+		return allocation, nil
+
+	case ".csv":
+		rows, err := ReadCSV(path)
+		if err != nil {
+			return nil, fmt.Errorf("error reading allocation file: %w", err)
+		}
+
+		allocation := &Allocation{Accounts: make(map[string]int, len(rows))}
+
+		// Skip the header
+		for i, row := range rows {
+			if i == 0 {
+				continue
+			}
+			if len(row) != 3 {
+				return nil, fmt.Errorf("invalid allocation row %d: %v", i+1, row)
+			}
+			epoch, errEpoch := strconv.Atoi(row[0])
+			shard, errShard := strconv.Atoi(row[2])
+			if errEpoch != nil || errShard != nil {
+				return nil, fmt.Errorf("invalid allocation row %d: %v", i+1, row)
+			}
+			allocation.Epoch = epoch
+			allocation.Accounts[row[1]] = shard
+			if shard+1 > allocation.NumberOfShards {
+				allocation.NumberOfShards = shard + 1
+			}
+		}
+		return allocation, nil
+
+	default:
+		return nil, fmt.Errorf("unknown allocation format for %s, expected .csv or .json", path)
+	}
+}
+
+// Function to list the accounts that are in a different shard in the after allocation, sorted by account
+// Accounts that are only in one of the two allocations did not move, so they are not listed
+func DiffAllocations(before *Allocation, after *Allocation) []AccountMove {
+
+	var moves []AccountMove
+
+	for _, account := range before.sortedAccounts() {
+		fromShard := before.Accounts[account]
+		toShard, exists := after.Accounts[account]
+		if exists && toShard != fromShard {
+			moves = append(moves, AccountMove{Account: account, FromShard: fromShard, ToShard: toShard})
+		}
+	}
+
+	return moves
+}
+
+// Function to write the accounts that moved between two allocations to CSV
+func WriteAllocationDiff(path string, moves []AccountMove) error {
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating allocation diff file: %w", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"account", "fromShard", "toShard"})
+	for _, move := range moves {
+		writer.Write([]string{move.Account, strconv.Itoa(move.FromShard), strconv.Itoa(move.ToShard)})
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing allocation diff: %w", err)
+	}
+
+	return file.Close()
+}
+
+// Function to get the accounts of the allocation in sorted order, so that output files are always the same
+func (allocation *Allocation) sortedAccounts() []string {
+	accounts := make([]string, 0, len(allocation.Accounts))
+	for account := range allocation.Accounts {
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+	return accounts
+}
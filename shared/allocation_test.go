@@ -0,0 +1,96 @@
+package shared
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// An allocation saved to JSON or CSV loads back the same, except for the number of shards that CSV does not keep
+func TestAllocationRoundTrip(t *testing.T) {
+
+	allocation := &Allocation{Epoch: 7, NumberOfShards: 4, Accounts: map[string]int{"c": 2, "a": 0, "b": 2, "d": 1}}
+
+	for _, c := range []struct {
+		file           string
+		numberOfShards int
+	}{
+		{"allocation.json", 4},
+		{"allocation.csv", 3}, // The highest shard in use is shard 2
+		{"ALLOCATION.CSV", 3},
+	} {
+		path := filepath.Join(t.TempDir(), c.file)
+		if err := allocation.Save(path); err != nil {
+			t.Fatalf("%s: failed to save: %v", c.file, err)
+		}
+
+		loaded, err := LoadAllocation(path)
+		if err != nil {
+			t.Fatalf("%s: failed to load: %v", c.file, err)
+		}
+		if loaded.Epoch != allocation.Epoch || loaded.NumberOfShards != c.numberOfShards ||
+			!maps.Equal(loaded.Accounts, allocation.Accounts) {
+			t.Errorf("%s: loaded %+v, expected epoch %d, %d shards and accounts %v", c.file, loaded,
+				allocation.Epoch, c.numberOfShards, allocation.Accounts)
+		}
+	}
+
+	// The rows of the CSV format are sorted by account
+	path := filepath.Join(t.TempDir(), "allocation.csv")
+	if err := ExportAllocation(path, anytimeTestGraph(), 3); err != nil {
+		t.Fatalf("Failed to export: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read export: %v", err)
+	}
+	if expected := "epoch,account,shard\n3,a,0\n3,b,0\n3,c,1\n3,d,1\n"; string(data) != expected {
+		t.Errorf("Exported CSV is %q, expected %q", data, expected)
+	}
+}
+
+// Allocations in an unknown format or with invalid rows are rejected
+func TestAllocationInvalidFiles(t *testing.T) {
+
+	dir := t.TempDir()
+	allocation := &Allocation{Epoch: 1, NumberOfShards: 2, Accounts: map[string]int{"a": 0}}
+
+	if err := allocation.Save(filepath.Join(dir, "allocation.txt")); err == nil {
+		t.Errorf("Saving to .txt did not fail")
+	}
+	if _, err := LoadAllocation(filepath.Join(dir, "allocation.txt")); err == nil {
+		t.Errorf("Loading from .txt did not fail")
+	}
+
+	for name, contents := range map[string]string{
+		"missing column": "epoch,account,shard\n1,a\n",
+		"invalid shard":  "epoch,account,shard\n1,a,x\n",
+		"invalid epoch":  "epoch,account,shard\none,a,0\n",
+	} {
+		path := filepath.Join(dir, "invalid.csv")
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+		if loaded, err := LoadAllocation(path); err == nil {
+			t.Errorf("%s: expected an error, but loaded %+v", name, loaded)
+		}
+	}
+}
+
+// Only the accounts in both allocations that changed shard are listed, sorted by account
+func TestDiffAllocations(t *testing.T) {
+
+	before := &Allocation{Epoch: 1, NumberOfShards: 3, Accounts: map[string]int{"d": 0, "c": 1, "b": 1, "a": 0}}
+	after := &Allocation{Epoch: 2, NumberOfShards: 3, Accounts: map[string]int{"e": 1, "c": 2, "b": 0, "a": 0}}
+
+	expected := []AccountMove{{Account: "b", FromShard: 1, ToShard: 0}, {Account: "c", FromShard: 1, ToShard: 2}}
+	if moves := DiffAllocations(before, after); !slices.Equal(moves, expected) {
+		t.Errorf("Moves are %v, expected %v", moves, expected)
+	}
+
+	if moves := DiffAllocations(before, before); len(moves) != 0 {
+		t.Errorf("An allocation differs from itself by %v", moves)
+	}
+}
@@ -0,0 +1,102 @@
+package shared
+
+import (
+	"math"
+	"math/rand"
+)
+
+/*
+Simulated annealing lets a vertex move to a shard other than the one with the highest score, so that the CLPA can
+escape the local optima it falls into in its first iterations.
+
+Instead of always picking the shard with the highest score, a shard is sampled with softmax probabilities over the
+scores. The scores are divided by the highest score first, so that the temperature does not depend on how many
+transactions a vertex has: a shard whose score is a fraction f of the highest score is picked exp(-(1-f)/T) times
+as often as the best shard. The temperature decays after every iteration, and once it drops below the minimum
+temperature the shard with the highest score is always picked, as without annealing.
+*/
+
+// Struct to hold the temperature schedule of simulated annealing
+type AnnealingSchedule struct {
+	InitialTemperature float64 // Temperature of the first iteration
+	Decay              float64 // Factor the temperature is multiplied by after every iteration
+	MinTemperature     float64 // Temperature below which the shard with the highest score is always picked
+}
+
+// Function to return the temperature schedule used by the test suite
+func DefaultAnnealingSchedule() AnnealingSchedule {
+	return AnnealingSchedule{
+		InitialTemperature: 0.5,
+		Decay:              0.9,
+		MinTemperature:     0.01,
+	}
+}
+
+// Function to get the temperature of an iteration (counted from 0), which is 0 once it drops below the minimum
+func (schedule AnnealingSchedule) Temperature(iteration int) float64 {
+
+	temperature := schedule.InitialTemperature * math.Pow(schedule.Decay, float64(iteration))
+	if temperature < schedule.MinTemperature || temperature <= 0 {
+		return 0
+	}
+
+	return temperature
+}
+
+/*
+Function to pick a shard with softmax probabilities over the scores of the shards, at the given temperature
+
+Shards with a nil score are never picked. At a temperature of 0, the shard with the highest score is picked, and ties
+are broken randomly. The random generator of the seed is used, so the shard picked is deterministic for a seed.
+*/
+func SampleShard(scores []*float64, temperature float64, randomGen *rand.Rand) int {
+
+	// Find the highest score, and the shards that have it
+	maxScore := math.Inf(-1)
+	var candidateShards []int
+	for shard, score := range scores {
+		if score == nil {
+			continue
+		}
+		if *score > maxScore {
+			maxScore = *score
+			candidateShards = []int{shard}
+		} else if *score == maxScore {
+			candidateShards = append(candidateShards, shard)
+		}
+	}
+
+	// Without any temperature, or without a positive highest score to scale by, the selection is greedy
+	if temperature <= 0 || maxScore <= 0 {
+		if len(candidateShards) == 1 {
+			return candidateShards[0]
+		}
+		return candidateShards[randomGen.Intn(len(candidateShards))]
+	}
+
+	// Work out the weight of each shard, relative to the weight of the shards with the highest score
+	weights := make([]float64, len(scores))
+	totalWeight := 0.0
+	for shard, score := range scores {
+		if score == nil {
+			continue
+		}
+		weights[shard] = math.Exp((*score/maxScore - 1) / temperature)
+		totalWeight += weights[shard]
+	}
+
+	// Sample a shard in proportion to its weight
+	target := randomGen.Float64() * totalWeight
+	for shard, weight := range weights {
+		if weight == 0 {
+			continue
+		}
+		target -= weight
+		if target < 0 {
+			return shard
+		}
+	}
+
+	// Rounding can leave a tiny part of the total weight unassigned, in which case a best shard is picked
+	return candidateShards[0]
+}
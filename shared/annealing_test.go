@@ -0,0 +1,76 @@
+package shared
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// Function to turn scores into the pointers the scoring functions return, where NaN stands for a nil score
+func scorePointers(values ...float64) []*float64 {
+	scores := make([]*float64, len(values))
+	for shard, value := range values {
+		if !math.IsNaN(value) {
+			scores[shard] = &value
+		}
+	}
+	return scores
+}
+
+// At a temperature of 0 the shard with the highest score is always picked, and ties are only broken between the shards
+// that share it
+func TestSampleShardGreedyWithoutTemperature(t *testing.T) {
+
+	randomGen := rand.New(rand.NewSource(1))
+	nan := math.NaN()
+
+	for i := 0; i < 200; i++ {
+		if shard := SampleShard(scorePointers(1, 5, nan, 3), 0, randomGen); shard != 1 {
+			t.Fatalf("Picked shard %d, expected the best shard 1", shard)
+		}
+		if shard := SampleShard(scorePointers(4, 2, 4, nan), 0, randomGen); shard != 0 && shard != 2 {
+			t.Fatalf("Picked shard %d, expected one of the tied best shards 0 and 2", shard)
+		}
+	}
+}
+
+// Shards with a nil score are never picked, however high the temperature
+func TestSampleShardSkipsNilScores(t *testing.T) {
+
+	randomGen := rand.New(rand.NewSource(2))
+	nan := math.NaN()
+
+	picked := make([]int, 4)
+	for i := 0; i < 2000; i++ {
+		picked[SampleShard(scorePointers(nan, 1, nan, 0.5), 100, randomGen)]++
+	}
+	if picked[0] != 0 || picked[2] != 0 {
+		t.Fatalf("Shards with a nil score were picked: %v", picked)
+	}
+
+	// At a high temperature the worse shard is picked as well, and nearly as often as the best one
+	if picked[3] < 900 {
+		t.Fatalf("The worse shard was only picked %d times out of 2000 at a high temperature", picked[3])
+	}
+}
+
+// The shards picked only depend on the seed of the random generator
+func TestSampleShardDeterministicForSeed(t *testing.T) {
+
+	sample := func(seed int64) []int {
+		randomGen := rand.New(rand.NewSource(seed))
+		shards := make([]int, 100)
+		for i := range shards {
+			shards[i] = SampleShard(scorePointers(3, 1, 2, 2.5), 0.5, randomGen)
+		}
+		return shards
+	}
+
+	if first, second := sample(3), sample(3); !slices.Equal(first, second) {
+		t.Fatalf("The same seed picked different shards:\n  %v\n  %v", first, second)
+	}
+	if first, other := sample(3), sample(4); slices.Equal(first, other) {
+		t.Fatalf("Different seeds picked the same 100 shards, so the seed is not used")
+	}
+}
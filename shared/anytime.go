@@ -0,0 +1,173 @@
+package shared
+
+import (
+	"context"
+	"maps"
+	"math"
+)
+
+// Number of vertices processed between two checks of whether the context was cancelled during an iteration
+const ContextCheckInterval = 1024
+
+// Function that reports whether the context was cancelled or its deadline was exceeded
+func Cancelled(ctx context.Context) bool {
+	return ctx.Err() != nil
+}
+
+/*
+Struct that keeps track of the best labelling found so far during the CLPA iterations of an allocation,
+so that the best labelling can be returned if the allocation is cut short.
+
+Along with the labels, the number of label updates and the votes of each vertex are kept, so that the labelling
+put back is the whole state the CLPA had at that point. That state is carried into the next epoch, where the votes
+are carried over by the vote memory.
+
+The labelling is only tracked if the context can actually be cancelled, since working out the fitness
+after every iteration is not needed otherwise.
+*/
+type AnytimeTracker struct {
+	enabled     bool
+	alpha       float64
+	bestFitness float64
+
+	// Best labelling of a graph
+	bestLabels   map[string]int
+	bestCounters map[string]int
+	bestVotes    map[string]map[int]float64
+
+	// Best labelling of a label state, when the topology is shared
+	bestStateLabels   []int
+	bestStateCounters []int
+	bestStateVotes    []map[int]float64
+}
+
+// Function to create a tracker, recording the labelling the graph starts with
+func NewAnytimeTracker(ctx context.Context, graph *Graph, alpha float64) *AnytimeTracker {
+
+	tracker := newAnytimeTracker(ctx, alpha)
+	tracker.Record(graph)
+
+	return tracker
+}
+
+// Function to create a tracker for a label state on a shared topology, recording the labelling it starts with
+func NewStateAnytimeTracker(ctx context.Context, topology *Topology, state *LabelState, alpha float64) *AnytimeTracker {
+
+	tracker := newAnytimeTracker(ctx, alpha)
+	tracker.RecordState(topology, state)
+
+	return tracker
+}
+
+func newAnytimeTracker(ctx context.Context, alpha float64) *AnytimeTracker {
+	return &AnytimeTracker{
+		enabled:     ctx.Done() != nil,
+		alpha:       alpha,
+		bestFitness: math.MaxFloat64,
+	}
+}
+
+// Function to record the labelling of the graph if it is the best one so far
+// It should only be called after a whole iteration was completed
+func (t *AnytimeTracker) Record(graph *Graph) {
+
+	if !t.enabled {
+		return
+	}
+
+	_, _, fitness := CalculateFitness(graph, t.alpha)
+	if fitness >= t.bestFitness {
+		return
+	}
+
+	// Save the new best labelling, reusing the maps if they already exist
+	t.bestFitness = fitness
+	if t.bestLabels == nil {
+		t.bestLabels = make(map[string]int, len(graph.Vertices))
+		t.bestCounters = make(map[string]int, len(graph.Vertices))
+		t.bestVotes = make(map[string]map[int]float64, len(graph.Vertices))
+	}
+	for id, vertex := range graph.Vertices {
+		t.bestLabels[id] = vertex.Label
+		t.bestCounters[id] = vertex.LabelUpdateCounter
+		t.bestVotes[id] = maps.Clone(vertex.LabelVotes)
+	}
+}
+
+/*
+Function to put back the best labelling found so far, if it is better than the current labelling of the graph,
+together with the number of label updates and the votes of each vertex at that point.
+It returns true if the labels were changed, in which case the shard workloads of the graph are out of date
+and need to be worked out again by the caller. The tracker must not be used once the labelling is put back.
+*/
+func (t *AnytimeTracker) Restore(graph *Graph) bool {
+
+	if !t.enabled || t.bestLabels == nil {
+		return false
+	}
+
+	// Keep the current labelling if it is at least as good as the best one recorded
+	_, _, fitness := CalculateFitness(graph, t.alpha)
+	if fitness <= t.bestFitness {
+		return false
+	}
+
+	for id, vertex := range graph.Vertices {
+		vertex.Label = t.bestLabels[id]
+		vertex.LabelUpdateCounter = t.bestCounters[id]
+		vertex.LabelVotes = t.bestVotes[id]
+	}
+
+	return true
+}
+
+// Function to record the labelling of a label state if it is the best one so far
+// It should only be called after a whole iteration was completed
+func (t *AnytimeTracker) RecordState(topology *Topology, state *LabelState) {
+
+	if !t.enabled {
+		return
+	}
+
+	_, _, fitness := topology.CalculateFitness(state, t.alpha)
+	if fitness >= t.bestFitness {
+		return
+	}
+
+	t.bestFitness = fitness
+	t.bestStateLabels = append(t.bestStateLabels[:0], state.Labels...)
+	t.bestStateCounters = append(t.bestStateCounters[:0], state.LabelUpdateCounter...)
+	if state.LabelVotes != nil {
+		t.bestStateVotes = append(t.bestStateVotes[:0], state.LabelVotes...)
+		for v, votes := range t.bestStateVotes {
+			t.bestStateVotes[v] = maps.Clone(votes)
+		}
+	}
+}
+
+/*
+Function to put back the best labelling found so far into a label state, if it is better than the current one,
+together with the number of label updates and the votes of each vertex at that point.
+It returns true if the labels were changed, in which case the shard workloads of the state are out of date
+and need to be worked out again by the caller. The tracker must not be used once the labelling is put back.
+*/
+func (t *AnytimeTracker) RestoreState(topology *Topology, state *LabelState) bool {
+
+	if !t.enabled || t.bestStateLabels == nil {
+		return false
+	}
+
+	// Keep the current labelling if it is at least as good as the best one recorded
+	_, _, fitness := topology.CalculateFitness(state, t.alpha)
+	if fitness <= t.bestFitness {
+		return false
+	}
+
+	copy(state.Labels, t.bestStateLabels)
+	copy(state.LabelUpdateCounter, t.bestStateCounters)
+	if state.LabelVotes != nil {
+		copy(state.LabelVotes, t.bestStateVotes)
+	}
+
+	return true
+}
@@ -0,0 +1,101 @@
+package shared
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"testing"
+)
+
+// Function to build a graph of two pairs of accounts that transact with each other, split over two shards
+func anytimeTestGraph() *Graph {
+	graph := &Graph{Vertices: make(map[string]*Vertex), NumberOfShards: 2}
+	for i, id := range []string{"a", "b", "c", "d"} {
+		graph.Vertices[id] = &Vertex{ID: id, Label: i / 2, LabelUpdateCounter: i,
+			LabelVotes: map[int]float64{i / 2: float64(i + 1)}, Edges: map[string]int{}, Sent: map[string]int{}}
+	}
+	for _, pair := range [][2]string{{"a", "b"}, {"c", "d"}} {
+		graph.Vertices[pair[0]].Edges[pair[1]] = 3
+		graph.Vertices[pair[1]].Edges[pair[0]] = 3
+		graph.Vertices[pair[0]].Sent[pair[1]] = 3
+	}
+	graph.ShardWorkloads = CalculateShardWorkloads(graph)
+	return graph
+}
+
+// Putting back the best labelling of a graph also puts back the label updates and votes of its vertices
+func TestAnytimeTrackerRestoresGraph(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	graph := anytimeTestGraph()
+	tracker := NewAnytimeTracker(ctx, graph, 0.5)
+
+	// Move to a worse labelling, where every pair is split over the two shards
+	for i, id := range []string{"a", "b", "c", "d"} {
+		vertex := graph.Vertices[id]
+		vertex.Label = i % 2
+		vertex.LabelUpdateCounter += 10
+		vertex.LabelVotes[i%2] += 5
+	}
+	graph.ShardWorkloads = CalculateShardWorkloads(graph)
+
+	if !tracker.Restore(graph) {
+		t.Fatal("Best labelling was not put back")
+	}
+	for id, expected := range anytimeTestGraph().Vertices {
+		vertex := graph.Vertices[id]
+		if vertex.Label != expected.Label || vertex.LabelUpdateCounter != expected.LabelUpdateCounter ||
+			!maps.Equal(vertex.LabelVotes, expected.LabelVotes) {
+			t.Fatalf("Vertex %s has label %d, counter %d and votes %v, expected %d, %d and %v", id, vertex.Label,
+				vertex.LabelUpdateCounter, vertex.LabelVotes, expected.Label, expected.LabelUpdateCounter,
+				expected.LabelVotes)
+		}
+	}
+}
+
+// Putting back the best labelling of a label state also puts back the label updates and votes of its vertices
+func TestAnytimeTrackerRestoresState(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	topology := NewTopology(anytimeTestGraph())
+	state := topology.NewLabelState()
+	state.LabelVotes = make([]map[int]float64, len(topology.Vertices))
+	for v, vertex := range topology.Vertices {
+		state.LabelVotes[v] = maps.Clone(vertex.LabelVotes)
+	}
+	state.ShardWorkloads = topology.CalculateShardWorkloads(state)
+
+	labels := slices.Clone(state.Labels)
+	counters := slices.Clone(state.LabelUpdateCounter)
+	votes := make([]map[int]float64, len(state.LabelVotes))
+	for v := range votes {
+		votes[v] = maps.Clone(state.LabelVotes[v])
+	}
+
+	tracker := NewStateAnytimeTracker(ctx, topology, state, 0.5)
+
+	// Move to a worse labelling, where every pair is split over the two shards
+	for v := range state.Labels {
+		state.Labels[v] = v % 2
+		state.LabelUpdateCounter[v] += 10
+		state.LabelVotes[v][v%2] += 5
+	}
+	state.ShardWorkloads = topology.CalculateShardWorkloads(state)
+
+	if !tracker.RestoreState(topology, state) {
+		t.Fatal("Best labelling was not put back")
+	}
+	if !slices.Equal(state.Labels, labels) || !slices.Equal(state.LabelUpdateCounter, counters) {
+		t.Fatalf("Labels %v and counters %v, expected %v and %v", state.Labels, state.LabelUpdateCounter, labels,
+			counters)
+	}
+	for v := range votes {
+		if !maps.Equal(state.LabelVotes[v], votes[v]) {
+			t.Fatalf("Vertex %d has votes %v, expected %v", v, state.LabelVotes[v], votes[v])
+		}
+	}
+}
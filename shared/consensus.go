@@ -0,0 +1,209 @@
+package shared
+
+/*
+A consensus allocation is built from the labellings of all the seeds of an epoch, rather than keeping only the one
+with the best fitness and discarding the others.
+
+The seeds vote on every edge of the graph: the agreement of two neighbouring vertices is the fraction of seeds in which
+they share a shard. Neighbours that almost always share a shard are merged into one vertex, so that a final CLPA pass
+is run on the merged graph, moving the groups of vertices that the seeds agree on together.
+
+The edges between the vertices of two groups are summed into an edge between the merged vertices, and the edges
+within a group into a self-loop, so the workloads and fitness of a labelling of the merged graph are the same as those
+of the labelling it gives to the vertices of the graph. This holds for any cost model where an intra-shard transaction
+costs the same whichever way it goes, as for all the cost models in this package.
+*/
+
+// Struct to hold the settings of the consensus allocation built from all the seeds of an epoch
+type ConsensusConfig struct {
+	Agreement float64 // Fraction of seeds in which two neighbours must share a shard to be merged, such as 0.9
+}
+
+// The Consensus struct holds the graph of merged vertices agreed on by the seeds of an epoch
+type Consensus struct {
+	Graph    *Graph    // The graph of merged vertices, labelled with the shard most of their vertices have in the best seed
+	Groups   []int     // Index of the merged vertex of each vertex of the topology, in the topology of Graph
+	Topology *Topology // The topology the seeds were run on
+	Seeds    int       // The number of seeds the consensus was built from
+	BestSeed int64     // The seed with the best fitness, whose labels the merged graph starts from
+}
+
+// Function to build the consensus of the seeds run on a shared topology
+// Seeds abandoned during seed racing are left out. It returns nil if no seed holds its label state.
+func NewConsensus(seedResults []*EpochResult, agreement float64) *Consensus {
+
+	// Collect the label states of the seeds, and find the seed with the best fitness
+	var states []*LabelState
+	var topology *Topology
+	var best *EpochResult
+
+	for _, result := range seedResults {
+		if result.Pruned || result.State == nil || result.Topology == nil {
+			continue
+		}
+		if topology != nil && result.Topology != topology {
+			continue
+		}
+		topology = result.Topology
+		states = append(states, result.State)
+
+		if best == nil || result.Fitness < best.Fitness {
+			best = result
+		}
+	}
+
+	if len(states) == 0 {
+		return nil
+	}
+
+	// Merge the neighbours that share a shard in enough of the seeds, using a union-find over the vertices
+	parent := make([]int, len(topology.Vertices))
+	for v := range parent {
+		parent[v] = v
+	}
+
+	var find func(v int) int
+	find = func(v int) int {
+		if parent[v] != v {
+			parent[v] = find(parent[v])
+		}
+		return parent[v]
+	}
+
+	minAgreeing := agreement * float64(len(states))
+
+	for v, neighbours := range topology.Neighbours {
+		for _, neighbour := range neighbours {
+
+			// Process undirected edge only once, and skip self-loops
+			if neighbour.Index <= v {
+				continue
+			}
+
+			agreeing := 0
+			for _, state := range states {
+				if state.Labels[v] == state.Labels[neighbour.Index] {
+					agreeing++
+				}
+			}
+
+			if float64(agreeing) >= minAgreeing {
+
+				// The root of a group is always its vertex with the lowest index, and so the lowest ID
+				a, b := find(v), find(neighbour.Index)
+				if a > b {
+					a, b = b, a
+				}
+				parent[b] = a
+			}
+		}
+	}
+
+	// Number the groups in the order of their lowest ID, which is also the order of the merged vertices when sorted
+	consensus := &Consensus{
+		Groups:   make([]int, len(topology.Vertices)),
+		Topology: topology,
+		Seeds:    len(states),
+		BestSeed: best.Seed,
+	}
+
+	var groupIDs []string
+	groupOfRoot := make(map[int]int)
+	for v, vertex := range topology.Vertices {
+		root := find(v)
+		group, exists := groupOfRoot[root]
+		if !exists {
+			group = len(groupIDs)
+			groupOfRoot[root] = group
+			groupIDs = append(groupIDs, vertex.ID)
+		}
+		consensus.Groups[v] = group
+	}
+
+	// Build the graph of merged vertices
+	graph := &Graph{
+		Vertices:       make(map[string]*Vertex, len(groupIDs)),
+		NumberOfShards: topology.NumberOfShards,
+		CostModel:      topology.CostModel,
+	}
+	for _, id := range groupIDs {
+		graph.Vertices[id] = &Vertex{
+			ID:    id,
+			Edges: make(map[string]int),
+			Sent:  make(map[string]int),
+		}
+	}
+
+	for v, neighbours := range topology.Neighbours {
+		vertex := graph.Vertices[groupIDs[consensus.Groups[v]]]
+
+		for _, neighbour := range neighbours {
+			neighbourID := groupIDs[consensus.Groups[neighbour.Index]]
+
+			// Every transaction is sent by one vertex, so the sent weights are summed over both directions
+			if neighbour.Sent > 0 {
+				vertex.Sent[neighbourID] += neighbour.Sent
+			}
+
+			// Process undirected edge only once to avoid double counting (a self-loop is only stored once)
+			if neighbour.Index < v {
+				continue
+			}
+			vertex.Edges[neighbourID] += neighbour.Weight
+			if neighbourID != vertex.ID {
+				graph.Vertices[neighbourID].Edges[vertex.ID] += neighbour.Weight
+			}
+		}
+	}
+
+	// Label each merged vertex with the shard most of its vertices have in the best seed, the lowest shard in a tie
+	counts := make([][]int, len(groupIDs))
+	for v, group := range consensus.Groups {
+		if counts[group] == nil {
+			counts[group] = make([]int, topology.NumberOfShards)
+		}
+		counts[group][best.State.Labels[v]]++
+	}
+	for group, id := range groupIDs {
+		label := 0
+		for shard, count := range counts[group] {
+			if count > counts[group][label] {
+				label = shard
+			}
+		}
+		graph.Vertices[id].Label = label
+	}
+
+	consensus.Graph = graph
+
+	return consensus
+}
+
+// Function to turn the label state of the merged graph into the label state of the topology the seeds were run on
+// Each vertex takes the label, label updates and votes of its merged vertex. The workloads are left to be calculated.
+func (c *Consensus) Expand(state *LabelState) *LabelState {
+
+	expanded := &LabelState{
+		Labels:             make([]int, len(c.Groups)),
+		LabelUpdateCounter: make([]int, len(c.Groups)),
+	}
+	if state.LabelVotes != nil {
+		expanded.LabelVotes = make([]map[int]float64, len(c.Groups))
+	}
+
+	for v, group := range c.Groups {
+		expanded.Labels[v] = state.Labels[group]
+		expanded.LabelUpdateCounter[v] = state.LabelUpdateCounter[group]
+
+		// Each vertex gets its own copy of the votes, since they can be changed in place in later epochs
+		if state.LabelVotes != nil && state.LabelVotes[group] != nil {
+			votes := make(map[int]float64, len(state.LabelVotes[group]))
+			for shard, count := range state.LabelVotes[group] {
+				votes[shard] = count
+			}
+			expanded.LabelVotes[v] = votes
+		}
+	}
+
+	return expanded
+}
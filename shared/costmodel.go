@@ -0,0 +1,134 @@
+package shared
+
+/*
+CostModel decides how much workload the transactions between two vertices add to the shards of the two vertices.
+
+EdgeCost is given the weight of the transactions sent by the first vertex to the second (sent), the weight of
+the transactions sent by the second vertex to the first (received), and whether the two vertices are in the
+same shard. It returns the workload added to the shard of the first vertex and to the shard of the second vertex.
+A self-loop is passed in with all of its weight as sent, with sameShard set to true.
+
+The shard workloads are only ever worked out through EdgeCost, both from scratch and when a vertex moves, so the
+scoring penalties (which use the shard workloads) and the workload imbalance always follow the selected model.
+The cross-shard workload in the fitness is the weight of the edges crossing shard boundaries under every model.
+
+EdgeCost must be additive, meaning that the cost of two sets of transactions together is the sum of their costs.
+This lets the workloads be updated once per group of edges when a vertex moves, rather than once per edge.
+*/
+type CostModel interface {
+	EdgeCost(sent int, received int, sameShard bool) (int, int)
+}
+
+// LinearCostModel charges a fixed cost for every unit of transaction weight, depending on where it is processed
+type LinearCostModel struct {
+	IntraShard int // Cost to the shard of a transaction between two vertices of the same shard
+	Sender     int // Cost to the sender's shard of a cross-shard transaction
+	Receiver   int // Cost to the receiver's shard of a cross-shard transaction (its relay transaction)
+}
+
+func (model LinearCostModel) EdgeCost(sent int, received int, sameShard bool) (int, int) {
+	if sameShard {
+		return model.IntraShard * (sent + received), 0
+	}
+	return model.Sender*sent + model.Receiver*received, model.Receiver*sent + model.Sender*received
+}
+
+// The cost model of the paper: a cross-shard transaction adds its full weight to both shards,
+// and any other transaction (including a self-loop) adds its weight once
+var PaperCostModel CostModel = LinearCostModel{IntraShard: 1, Sender: 1, Receiver: 1}
+
+// A cross-shard transaction is only charged to the sender's shard
+var SenderOnlyCostModel CostModel = LinearCostModel{IntraShard: 1, Sender: 1, Receiver: 0}
+
+// The cost of a cross-shard transaction is split equally between the sender's shard and the receiver's shard
+// Workloads are counted in halves of a transaction, so an intra-shard transaction costs 2
+var SplitRelayCostModel CostModel = LinearCostModel{IntraShard: 2, Sender: 1, Receiver: 1}
+
+// Function to get a cost model where a cross-shard transaction adds k times its weight to both shards
+func CrossShardMultiplierCostModel(k int) CostModel {
+	return LinearCostModel{IntraShard: 1, Sender: k, Receiver: k}
+}
+
+// Function to get the cost model of the graph, which is the cost model of the paper if none was selected
+func (graph *Graph) WorkloadCostModel() CostModel {
+	if graph.CostModel == nil {
+		return PaperCostModel
+	}
+	return graph.CostModel
+}
+
+// Sums of the weight sent and received over a group of edges of a vertex
+type EdgeSums struct {
+	Sent     int
+	Received int
+}
+
+// Function to add the weight sent and received over an edge to the sums
+func (sums *EdgeSums) Add(sent int, received int) {
+	sums.Sent += sent
+	sums.Received += received
+}
+
+/*
+Function to update the shard workloads when a vertex moves from oldShard to newShard, given the sums of the edges
+of the vertex grouped by where the neighbour is: in the old shard, in the new shard, in any other shard, and the
+self-loops of the vertex
+*/
+func ApplyMove(model CostModel, shardWorkloads []int, oldShard int, newShard int,
+	withOld EdgeSums, withNew EdgeSums, withOthers EdgeSums, selfLoops EdgeSums) {
+
+	// Edges with the old shard stop being intra-shard, and become cross-shard with the new shard
+	own, other := model.EdgeCost(withOld.Sent, withOld.Received, true)
+	shardWorkloads[oldShard] -= own + other
+	own, other = model.EdgeCost(withOld.Sent, withOld.Received, false)
+	shardWorkloads[newShard] += own
+	shardWorkloads[oldShard] += other
+
+	// Edges with the new shard stop being cross-shard, and become intra-shard
+	own, other = model.EdgeCost(withNew.Sent, withNew.Received, false)
+	shardWorkloads[oldShard] -= own
+	shardWorkloads[newShard] -= other
+	own, other = model.EdgeCost(withNew.Sent, withNew.Received, true)
+	shardWorkloads[newShard] += own + other
+
+	// Edges with other shards stay cross-shard, so only the part charged to the vertex moves
+	// The part charged to the shards of the neighbours does not change
+	own, _ = model.EdgeCost(withOthers.Sent, withOthers.Received, false)
+	shardWorkloads[oldShard] -= own
+	shardWorkloads[newShard] += own
+
+	// Self-loops move together with the vertex
+	own, other = model.EdgeCost(selfLoops.Sent, selfLoops.Received, true)
+	shardWorkloads[oldShard] -= own + other
+	shardWorkloads[newShard] += own + other
+}
+
+// Function to calculate from scratch the workload of each shard of the graph, according to its cost model
+// Only the transactions between vertices that have a shard are counted, so vertices waiting to be placed (with a
+// label of -1) add nothing
+func CalculateShardWorkloads(graph *Graph) []int {
+
+	workloads := make([]int, graph.NumberOfShards)
+	costModel := graph.WorkloadCostModel()
+
+	for _, v := range graph.Vertices {
+		if v.Label < 0 {
+			continue
+		}
+		for neighbourID, weight := range v.Edges {
+
+			// Process undirected edge only once to avoid double counting (a self-loop is only stored once)
+			neighbour := graph.Vertices[neighbourID]
+			if neighbour == nil || neighbour.Label < 0 || v.ID > neighbourID {
+				continue
+			}
+
+			sent := v.Sent[neighbourID]
+			own, other := costModel.EdgeCost(sent, weight-sent, v.Label == neighbour.Label)
+			workloads[v.Label] += own
+			workloads[neighbour.Label] += other
+		}
+	}
+
+	return workloads
+}
@@ -3,19 +3,19 @@ package shared
 import "math"
 
 // Returns max workload deviation from the average across shards (which is the workload imabalnce)
-func calculateWorkloadImbalance(graph *Graph) float64 {
+func calculateWorkloadImbalance(shardWorkloads []int) float64 {
 	// Calculate the total workload
 	totalWorkload := 0
-	for _, workload := range graph.ShardWorkloads {
+	for _, workload := range shardWorkloads {
 		totalWorkload += workload
 	}
 
 	// Calculate the average workload
-	averageWorkload := float64(totalWorkload) / float64(len(graph.ShardWorkloads))
+	averageWorkload := float64(totalWorkload) / float64(len(shardWorkloads))
 
 	// Find the maximum difference between a shard's workload and the average
 	maxDifference := 0.0
-	for _, workload := range graph.ShardWorkloads {
+	for _, workload := range shardWorkloads {
 		difference := math.Abs(float64(workload) - averageWorkload)
 		if difference > maxDifference {
 			maxDifference = difference
@@ -51,7 +51,7 @@ func calculateCrossShardWorkload(graph *Graph) int {
 // Returns the main metrics: workload imbalance, cross-shard workload, and combined fitness score
 func CalculateFitness(graph *Graph, alpha float64) (float64, int, float64) {
 	// Calculate workload imbalance
-	workloadImbalance := calculateWorkloadImbalance(graph)
+	workloadImbalance := calculateWorkloadImbalance(graph.ShardWorkloads)
 
 	// Calculate cross-shard workload
 	crossShardWorkload := calculateCrossShardWorkload(graph)
@@ -61,3 +61,8 @@ func CalculateFitness(graph *Graph, alpha float64) (float64, int, float64) {
 
 	return workloadImbalance, crossShardWorkload, fitness
 }
+
+// Returns the workload imbalance of the given shard workloads, for callers that keep track of their own workloads
+func WorkloadImbalance(shardWorkloads []int) float64 {
+	return calculateWorkloadImbalance(shardWorkloads)
+}
@@ -0,0 +1,255 @@
+package shared
+
+import (
+	"fmt"
+	"log"
+	"sort"
+)
+
+/*
+Invariant checks are a debug mode that verifies the bookkeeping the CLPA does incrementally, instead of from scratch.
+
+When a vertex moves, the workloads of the shards are updated by delta arithmetic on the edges of the vertex, and
+any mistake there silently skews the penalty of every score that follows. With the checks on, the workloads kept by
+the CLPA are compared with the workloads worked out from scratch, the labels are checked to be valid shards, and the
+cached weight of the edges of each vertex to each shard (if any) is compared with the weights worked out from
+scratch. The edges are checked to be symmetric once, when the CLPA starts, since they do not change while it runs.
+
+On the first violation, the checks panic with the iteration and the vertex involved. A check after an iteration
+cannot tell which move went wrong, so it reports the last vertex that moved in the iteration.
+The checks work everything out from scratch, so they make the CLPA much slower, and they are off by default.
+They are turned on for debugging through the InvariantChecks setting of the AllocationConfig of an allocation.
+*/
+
+// Level of the invariant checks
+type InvariantCheckLevel int
+
+const (
+	NoInvariantChecks   InvariantCheckLevel = iota // The checks are off
+	CheckEveryIteration                            // The checks run after every iteration
+	CheckEveryMove                                 // The checks run after every move of a vertex, and every iteration
+)
+
+// Struct to run the invariant checks of a single CLPA run, keeping track of the iteration being run
+type InvariantChecker struct {
+	level     InvariantCheckLevel
+	iteration int    // Iteration being run (counted from 1), 0 before the first iteration
+	lastMoved string // ID of the last vertex that moved in the iteration, empty if none did
+}
+
+// Function to start the invariant checks of a CLPA run at the given level
+// It returns nil if the checks are off, in which case every method of the checker does nothing
+func NewInvariantChecker(level InvariantCheckLevel) *InvariantChecker {
+	if level == NoInvariantChecks {
+		return nil
+	}
+	return &InvariantChecker{level: level}
+}
+
+// Function to record that an iteration (counted from 0, as in the loops of the CLPA) is starting
+func (checker *InvariantChecker) StartIteration(iter int) {
+	if checker != nil {
+		checker.iteration = iter + 1
+		checker.lastMoved = ""
+	}
+}
+
+// Function to record that a vertex moved to another shard, so that a check after the iteration can report it
+func (checker *InvariantChecker) Moved(vertexID string) {
+	if checker != nil {
+		checker.lastMoved = vertexID
+	}
+}
+
+// Function to find whether the checks run after every move, in which case the workloads need to be worked out
+func (checker *InvariantChecker) EveryMove() bool {
+	return checker != nil && checker.level >= CheckEveryMove
+}
+
+// Function to find whether the checks run after every iteration
+func (checker *InvariantChecker) EveryIteration() bool {
+	return checker != nil && checker.level >= CheckEveryIteration
+}
+
+// Function to fail loudly on a violation, naming the iteration and the vertex involved
+// The vertex is the one the violation was found at, or else the one that just moved (or moved last in the iteration)
+func (checker *InvariantChecker) fail(vertexID string, format string, args ...any) {
+
+	where := fmt.Sprintf("in iteration %d", checker.iteration)
+	if checker.iteration == 0 {
+		where = "before the first iteration"
+	}
+
+	log.Panicf("Invariant violated %s at vertex %q: %s", where, vertexID, fmt.Sprintf(format, args...))
+}
+
+/*
+Function to check the label state of a seed on a shared topology, given the workloads worked out from scratch
+
+The moved vertex is the index of the vertex that just moved, or -1 if the check runs after an iteration, in which
+case the last vertex that moved in the iteration is reported.
+*/
+func (checker *InvariantChecker) CheckState(topology *Topology, state *LabelState, workloads []int, moved int) {
+
+	if checker == nil {
+		return
+	}
+
+	movedID := checker.lastMoved
+	if moved >= 0 {
+		movedID = topology.Vertices[moved].ID
+	}
+
+	// Every label must be a valid shard
+	for v, label := range state.Labels {
+		if label < 0 || label >= topology.NumberOfShards {
+			checker.fail(topology.Vertices[v].ID, "label %d is not one of the %d shards (after moving %q)", label,
+				topology.NumberOfShards, movedID)
+		}
+	}
+
+	checker.checkWorkloads(state.ShardWorkloads, workloads, movedID)
+
+	// The cached weight of the edges of each vertex to each shard must match the weights worked out from scratch
+	if state.NeighbourWeights != nil {
+		expected := topology.CalculateNeighbourWeights(state)
+		for v, weights := range state.NeighbourWeights {
+			for shard, weight := range weights {
+				if weight != expected[v][shard] {
+					checker.fail(topology.Vertices[v].ID, "cached weight to shard %d is %d, but it is %d from "+
+						"scratch (after moving %q)", shard, weight, expected[v][shard], movedID)
+				}
+			}
+		}
+	}
+}
+
+// Function to check a whole graph, given the workloads worked out from scratch, and the ID of the vertex that just
+// moved (empty if the check runs after an iteration, in which case the last vertex that moved in it is reported)
+func (checker *InvariantChecker) CheckGraph(graph *Graph, workloads []int, movedID string) {
+
+	if checker == nil {
+		return
+	}
+	if movedID == "" {
+		movedID = checker.lastMoved
+	}
+
+	// Every label must be a valid shard, and the vertices are visited in order so that the same vertex is reported
+	for _, id := range sortedIDs(graph) {
+		if label := graph.Vertices[id].Label; label < 0 || label >= graph.NumberOfShards {
+			checker.fail(id, "label %d is not one of the %d shards (after moving %q)", label, graph.NumberOfShards,
+				movedID)
+		}
+	}
+
+	checker.checkWorkloads(graph.ShardWorkloads, workloads, movedID)
+}
+
+// Function to check that the workloads kept incrementally match the workloads worked out from scratch
+func (checker *InvariantChecker) checkWorkloads(kept []int, workloads []int, movedID string) {
+
+	if len(kept) != len(workloads) {
+		checker.fail(movedID, "%d shard workloads are kept, but there are %d shards", len(kept), len(workloads))
+	}
+	for shard, workload := range workloads {
+		if kept[shard] != workload {
+			checker.fail(movedID, "workload of shard %d is %d, but it is %d from scratch (workloads %v, "+
+				"from scratch %v)", shard, kept[shard], workload, kept, workloads)
+		}
+	}
+}
+
+/*
+Function to check that the edges of a shared topology are symmetric: each edge is stored at both of its vertices
+with the same weight, and the transactions sent each way add up to the weight (a self-loop is stored once, and all
+of its transactions are sent by the vertex)
+*/
+func (checker *InvariantChecker) CheckTopologyEdges(topology *Topology) {
+
+	if checker == nil {
+		return
+	}
+
+	for v, neighbours := range topology.Neighbours {
+		for _, neighbour := range neighbours {
+			id := topology.Vertices[v].ID
+
+			if neighbour.Index == v {
+				if neighbour.Sent != neighbour.Weight {
+					checker.fail(id, "self-loop of weight %d has %d transactions sent", neighbour.Weight,
+						neighbour.Sent)
+				}
+				continue
+			}
+
+			// The neighbours are sorted by index, so the reverse edge can be found by binary search
+			reverse := topology.Neighbours[neighbour.Index]
+			i := sort.Search(len(reverse), func(i int) bool { return reverse[i].Index >= v })
+			neighbourID := topology.Vertices[neighbour.Index].ID
+			if i == len(reverse) || reverse[i].Index != v {
+				checker.fail(id, "edge to %q has no edge back", neighbourID)
+			}
+			checker.checkEdgePair(id, neighbourID, neighbour.Weight, neighbour.Sent, reverse[i].Weight,
+				reverse[i].Sent)
+		}
+	}
+}
+
+// Function to check that the edges of a graph are symmetric, in the same way as CheckTopologyEdges
+func (checker *InvariantChecker) CheckGraphEdges(graph *Graph) {
+
+	if checker == nil {
+		return
+	}
+
+	for _, id := range sortedIDs(graph) {
+		vertex := graph.Vertices[id]
+		for neighbourID, weight := range vertex.Edges {
+
+			if neighbourID == id {
+				if vertex.Sent[id] != weight {
+					checker.fail(id, "self-loop of weight %d has %d transactions sent", weight, vertex.Sent[id])
+				}
+				continue
+			}
+
+			neighbour, exists := graph.Vertices[neighbourID]
+			if !exists {
+				checker.fail(id, "edge to %q leads to a vertex that is not in the graph", neighbourID)
+			}
+			reverseWeight, exists := neighbour.Edges[id]
+			if !exists {
+				checker.fail(id, "edge to %q has no edge back", neighbourID)
+			}
+			checker.checkEdgePair(id, neighbourID, weight, vertex.Sent[neighbourID], reverseWeight,
+				neighbour.Sent[id])
+		}
+	}
+}
+
+// Function to check that the two halves of an edge between different vertices match
+func (checker *InvariantChecker) checkEdgePair(id string, neighbourID string, weight int, sent int,
+	reverseWeight int, reverseSent int) {
+
+	if weight != reverseWeight {
+		checker.fail(id, "edge to %q has weight %d, but the edge back has weight %d", neighbourID, weight,
+			reverseWeight)
+	}
+	if sent+reverseSent != weight {
+		checker.fail(id, "edge to %q of weight %d has %d transactions sent one way and %d the other way",
+			neighbourID, weight, sent, reverseSent)
+	}
+}
+
+// Function to get the IDs of the vertices of a graph, sorted
+func sortedIDs(graph *Graph) []string {
+
+	ids := make([]string, 0, len(graph.Vertices))
+	for id := range graph.Vertices {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	return ids
+}
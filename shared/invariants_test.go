@@ -0,0 +1,64 @@
+package shared
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// Function to run a check and return the message it panicked with, or an empty string if it passed
+func panicMessage(check func()) (message string) {
+	defer func() {
+		if r := recover(); r != nil {
+			message = fmt.Sprint(r)
+		}
+	}()
+	check()
+	return ""
+}
+
+// A workload violation found after an iteration is reported at the last vertex that moved in the iteration
+func TestInvariantCheckerReportsLastMovedVertex(t *testing.T) {
+
+	graph := anytimeTestGraph()
+	topology := NewTopology(graph)
+	state := topology.NewLabelState()
+	state.ShardWorkloads = topology.CalculateShardWorkloads(state)
+	workloads := topology.CalculateShardWorkloads(state)
+
+	checker := NewInvariantChecker(CheckEveryIteration)
+	checker.StartIteration(0)
+	checker.Moved("a")
+	checker.Moved("c")
+
+	// The bookkeeping is right, so the checks pass
+	if message := panicMessage(func() {
+		checker.CheckState(topology, state, workloads, -1)
+		checker.CheckGraph(graph, CalculateShardWorkloads(graph), "")
+	}); message != "" {
+		t.Fatalf("Checks failed on a correct state: %s", message)
+	}
+
+	// Corrupt the workloads kept incrementally
+	state.ShardWorkloads[0]++
+	graph.ShardWorkloads[0]++
+
+	for name, check := range map[string]func(){
+		"state": func() { checker.CheckState(topology, state, workloads, -1) },
+		"graph": func() { checker.CheckGraph(graph, CalculateShardWorkloads(graph), "") },
+	} {
+		message := panicMessage(check)
+		if !strings.Contains(message, `in iteration 1 at vertex "c"`) {
+			t.Fatalf("Check of the %s reported %q, expected the last vertex that moved in iteration 1", name, message)
+		}
+	}
+
+	// A new iteration forgets the vertices that moved in the previous one
+	checker.StartIteration(1)
+	checker.Moved("b")
+	if message := panicMessage(func() {
+		checker.CheckState(topology, state, workloads, -1)
+	}); !strings.Contains(message, `in iteration 2 at vertex "b"`) {
+		t.Fatalf("Check reported %q, expected the last vertex that moved in iteration 2", message)
+	}
+}
@@ -0,0 +1,146 @@
+package shared
+
+import (
+	"math"
+	"sort"
+)
+
+/*
+Metrics of a partitioning, beyond the three numbers returned by CalculateFitness
+
+The workload imbalance, cross-shard workload and fitness are the same as the ones returned by CalculateFitness.
+The rest describe the spread of the shard workloads in more ways than the maximum deviation from the mean, and
+split the workload of each shard into the weight of its intra-shard and cross-shard transactions.
+*/
+type Metrics struct {
+	WorkloadImbalance  float64 // Maximum absolute deviation of a shard workload from the mean
+	CrossShardWorkload int     // Total weight of edges crossing shard boundaries
+	Fitness            float64
+
+	TotalWorkload   int     // Total weight of all edges (transactions), each edge counted once
+	CrossShardRatio float64 // Fraction of the total weight that is cross-shard
+
+	WorkloadStdDev   float64 // Population standard deviation of the shard workloads
+	WorkloadCV       float64 // Coefficient of variation of the shard workloads (standard deviation over mean)
+	MaxMeanLoadRatio float64 // Workload of the busiest shard over the mean workload
+	Gini             float64 // Gini coefficient of the shard workloads (0 is perfectly balanced)
+
+	ShardIntraWorkloads []int // Weight of the edges with both vertices in each shard
+	ShardCrossWorkloads []int // Weight of the cross-shard edges with one of their vertices in each shard
+}
+
+// Function to work out the metrics of a partitioning of the graph
+func CalculateMetrics(graph *Graph, alpha float64) *Metrics {
+
+	intra := make([]int, graph.NumberOfShards)
+	cross := make([]int, graph.NumberOfShards)
+
+	for _, v := range graph.Vertices {
+		for neighbour, weight := range v.Edges {
+
+			// Only process each edge once (to avoid double counting), keeping self-loops
+			if v.ID > neighbour {
+				continue
+			}
+
+			neighbourLabel := graph.Vertices[neighbour].Label
+			if v.Label == neighbourLabel {
+				intra[v.Label] += weight
+			} else {
+				cross[v.Label] += weight
+				cross[neighbourLabel] += weight
+			}
+		}
+	}
+
+	return newMetrics(graph.ShardWorkloads, intra, cross, alpha)
+}
+
+// Function to work out the metrics of a partitioning given by a label state
+func (t *Topology) CalculateMetrics(state *LabelState, alpha float64) *Metrics {
+
+	intra := make([]int, t.NumberOfShards)
+	cross := make([]int, t.NumberOfShards)
+
+	for v, neighbours := range t.Neighbours {
+		for _, neighbour := range neighbours {
+
+			// Only process each edge once (to avoid double counting), keeping self-loops
+			if neighbour.Index < v {
+				continue
+			}
+
+			label, neighbourLabel := state.Labels[v], state.Labels[neighbour.Index]
+			if label == neighbourLabel {
+				intra[label] += neighbour.Weight
+			} else {
+				cross[label] += neighbour.Weight
+				cross[neighbourLabel] += neighbour.Weight
+			}
+		}
+	}
+
+	return newMetrics(state.ShardWorkloads, intra, cross, alpha)
+}
+
+// Function to work out the metrics from the shard workloads and the intra-shard and cross-shard weight of each shard
+func newMetrics(shardWorkloads []int, intra []int, cross []int, alpha float64) *Metrics {
+
+	metrics := &Metrics{
+		WorkloadImbalance:   calculateWorkloadImbalance(shardWorkloads),
+		ShardIntraWorkloads: intra,
+		ShardCrossWorkloads: cross,
+	}
+
+	// Each cross-shard edge was added to both of its shards, so it is halved to be counted once
+	totalCross := 0
+	for shard := range intra {
+		metrics.TotalWorkload += intra[shard]
+		totalCross += cross[shard]
+	}
+	metrics.CrossShardWorkload = totalCross / 2
+	metrics.TotalWorkload += metrics.CrossShardWorkload
+
+	metrics.Fitness = alpha*float64(metrics.CrossShardWorkload) + (1-alpha)*metrics.WorkloadImbalance
+
+	if metrics.TotalWorkload > 0 {
+		metrics.CrossShardRatio = float64(metrics.CrossShardWorkload) / float64(metrics.TotalWorkload)
+	}
+
+	if len(shardWorkloads) == 0 {
+		return metrics
+	}
+
+	// Mean and maximum of the shard workloads
+	total, maxWorkload := 0, shardWorkloads[0]
+	for _, workload := range shardWorkloads {
+		total += workload
+		maxWorkload = max(maxWorkload, workload)
+	}
+	n := float64(len(shardWorkloads))
+	mean := float64(total) / n
+
+	// Standard deviation of the shard workloads
+	variance := 0.0
+	for _, workload := range shardWorkloads {
+		variance += (float64(workload) - mean) * (float64(workload) - mean)
+	}
+	metrics.WorkloadStdDev = math.Sqrt(variance / n)
+
+	// The ratios are left at 0 when there is no workload at all
+	if mean > 0 {
+		metrics.WorkloadCV = metrics.WorkloadStdDev / mean
+		metrics.MaxMeanLoadRatio = float64(maxWorkload) / mean
+
+		// Gini coefficient, from the workloads sorted in increasing order
+		sorted := append([]int(nil), shardWorkloads...)
+		sort.Ints(sorted)
+		weightedSum := 0.0
+		for i, workload := range sorted {
+			weightedSum += float64(2*(i+1)-len(sorted)-1) * float64(workload)
+		}
+		metrics.Gini = weightedSum / (n * float64(total))
+	}
+
+	return metrics
+}
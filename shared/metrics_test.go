@@ -0,0 +1,136 @@
+package shared
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+/*
+Function to build a graph over three shards, where shard 2 has no vertices:
+a and b are in shard 0 with 2 transactions from a to b, c is in shard 1 with 3 transactions from a to c,
+and c has a self-loop of 4 transactions
+
+Under the cost model of the paper the workloads are [2+3, 3+4, 0] = [5, 7, 0].
+*/
+func metricsTestGraph() *Graph {
+	graph := &Graph{Vertices: make(map[string]*Vertex), NumberOfShards: 3}
+	for id, label := range map[string]int{"a": 0, "b": 0, "c": 1} {
+		graph.Vertices[id] = &Vertex{ID: id, Label: label, Edges: map[string]int{}, Sent: map[string]int{}}
+	}
+	for _, edge := range []struct {
+		from, to string
+		weight   int
+	}{{"a", "b", 2}, {"a", "c", 3}, {"c", "c", 4}} {
+		graph.Vertices[edge.from].Edges[edge.to] = edge.weight
+		graph.Vertices[edge.to].Edges[edge.from] = edge.weight
+		graph.Vertices[edge.from].Sent[edge.to] = edge.weight
+	}
+	graph.ShardWorkloads = CalculateShardWorkloads(graph)
+	return graph
+}
+
+// Function to check that the metrics match the ones worked out by hand for metricsTestGraph with alpha 0.5
+func checkMetricsTestGraph(t *testing.T, metrics *Metrics) {
+	t.Helper()
+
+	// The mean workload is 12/3 = 4, so the deviations are 1, 3 and -4
+	stdDev := math.Sqrt((1.0 + 9 + 16) / 3)
+	expected := &Metrics{
+		WorkloadImbalance:  4,
+		CrossShardWorkload: 3,
+		Fitness:            0.5*3 + 0.5*4,
+
+		TotalWorkload:   9,
+		CrossShardRatio: 3.0 / 9,
+
+		WorkloadStdDev:   stdDev,
+		WorkloadCV:       stdDev / 4,
+		MaxMeanLoadRatio: 7.0 / 4,
+		Gini:             (-2*0 + 0*5 + 2*7) / (3.0 * 12), // Sorted workloads [0, 5, 7]
+
+		ShardIntraWorkloads: []int{2, 4, 0},
+		ShardCrossWorkloads: []int{3, 3, 0},
+	}
+
+	floats := []struct {
+		name          string
+		got, expected float64
+	}{
+		{"workload imbalance", metrics.WorkloadImbalance, expected.WorkloadImbalance},
+		{"fitness", metrics.Fitness, expected.Fitness},
+		{"cross-shard ratio", metrics.CrossShardRatio, expected.CrossShardRatio},
+		{"standard deviation", metrics.WorkloadStdDev, expected.WorkloadStdDev},
+		{"coefficient of variation", metrics.WorkloadCV, expected.WorkloadCV},
+		{"max/mean ratio", metrics.MaxMeanLoadRatio, expected.MaxMeanLoadRatio},
+		{"Gini coefficient", metrics.Gini, expected.Gini},
+	}
+	for _, f := range floats {
+		if math.Abs(f.got-f.expected) > 1e-9 {
+			t.Errorf("The %s is %v, expected %v", f.name, f.got, f.expected)
+		}
+	}
+
+	if metrics.CrossShardWorkload != expected.CrossShardWorkload || metrics.TotalWorkload != expected.TotalWorkload {
+		t.Errorf("Cross-shard workload is %d and total workload %d, expected %d and %d",
+			metrics.CrossShardWorkload, metrics.TotalWorkload, expected.CrossShardWorkload, expected.TotalWorkload)
+	}
+	if !slices.Equal(metrics.ShardIntraWorkloads, expected.ShardIntraWorkloads) ||
+		!slices.Equal(metrics.ShardCrossWorkloads, expected.ShardCrossWorkloads) {
+		t.Errorf("Intra-shard workloads are %v and cross-shard workloads %v, expected %v and %v",
+			metrics.ShardIntraWorkloads, metrics.ShardCrossWorkloads, expected.ShardIntraWorkloads,
+			expected.ShardCrossWorkloads)
+	}
+}
+
+// The metrics of a graph, with a self-loop and a shard with no workload, match the ones worked out by hand
+func TestCalculateMetrics(t *testing.T) {
+
+	graph := metricsTestGraph()
+	if !slices.Equal(graph.ShardWorkloads, []int{5, 7, 0}) {
+		t.Fatalf("Workloads of the test graph are %v, expected [5 7 0]", graph.ShardWorkloads)
+	}
+
+	checkMetricsTestGraph(t, CalculateMetrics(graph, 0.5))
+}
+
+// The metrics of a label state are the metrics of the graph it was built from
+func TestTopologyCalculateMetrics(t *testing.T) {
+
+	topology := NewTopology(metricsTestGraph())
+	state := topology.NewLabelState()
+	state.ShardWorkloads = topology.CalculateShardWorkloads(state)
+
+	checkMetricsTestGraph(t, topology.CalculateMetrics(state, 0.5))
+}
+
+// The workload imbalance, cross-shard workload and fitness of the metrics are the ones returned by CalculateFitness
+func TestMetricsMatchFitness(t *testing.T) {
+
+	graph := metricsTestGraph()
+	topology := NewTopology(graph)
+	state := topology.NewLabelState()
+	state.ShardWorkloads = topology.CalculateShardWorkloads(state)
+
+	for _, alpha := range []float64{0, 0.3, 0.5, 1} {
+		imbalance, cross, fitness := CalculateFitness(graph, alpha)
+
+		for name, metrics := range map[string]*Metrics{
+			"graph":    CalculateMetrics(graph, alpha),
+			"topology": topology.CalculateMetrics(state, alpha),
+		} {
+			if metrics.WorkloadImbalance != imbalance || metrics.CrossShardWorkload != cross ||
+				metrics.Fitness != fitness {
+				t.Errorf("Alpha %v, %s: metrics give imbalance %v, cross-shard %d and fitness %v, but "+
+					"CalculateFitness gives %v, %d and %v", alpha, name, metrics.WorkloadImbalance,
+					metrics.CrossShardWorkload, metrics.Fitness, imbalance, cross, fitness)
+			}
+		}
+
+		if stateImbalance, stateCross, stateFitness := topology.CalculateFitness(state, alpha); stateImbalance !=
+			imbalance || stateCross != cross || stateFitness != fitness {
+			t.Errorf("Alpha %v: fitness of the label state is %v, %d and %v, but %v, %d and %v for the graph", alpha,
+				stateImbalance, stateCross, stateFitness, imbalance, cross, fitness)
+		}
+	}
+}
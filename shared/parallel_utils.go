@@ -1,16 +1,24 @@
 package shared
 
 import (
+	"context"
 	"log"
 	"math"
+	"sync"
 )
 
 // DeepCopyGraph creates a deep copy of the graph structure
 // Used to allow parallel goroutines to work independently on separate graph copies
+// The edge and sent maps are shared with the original, since they are replaced rather than changed at the start of an epoch
 func DeepCopyGraph(original *Graph) *Graph {
 	copy := &Graph{
-		Vertices:       make(map[string]*Vertex),
-		NumberOfShards: original.NumberOfShards,
+		Vertices:        make(map[string]*Vertex),
+		NumberOfShards:  original.NumberOfShards,
+		ShardWorkloads:  append([]int(nil), original.ShardWorkloads...),
+		CostModel:       original.CostModel,
+		Window:          original.Window.Copy(),
+		Placement:       original.Placement,
+		InvariantChecks: original.InvariantChecks,
 	}
 
 	// Copy vertices
@@ -19,15 +27,26 @@ func DeepCopyGraph(original *Graph) *Graph {
 			ID:                 v.ID,
 			Label:              v.Label,
 			Edges:              v.Edges,
+			Sent:               v.Sent,
 			LabelUpdateCounter: v.LabelUpdateCounter,
 			NewLabel:           v.NewLabel,
 		}
+
+		// The votes are changed in place when they are carried over, so they are copied
+		if v.LabelVotes != nil {
+			votes := make(map[int]float64, len(v.LabelVotes))
+			for shard, count := range v.LabelVotes {
+				votes[shard] = count
+			}
+			copy.Vertices[id].LabelVotes = votes
+		}
 	}
 
 	return copy
 }
 
 // Function that finds the best graph in terms of fitness and returns it
+// If there is a consensus of the seeds, its graph is returned instead, whatever its fitness
 // The rest of the graphs are discarded
 func GetBestGraph(seedResults []*EpochResult) *Graph {
 
@@ -45,17 +64,171 @@ func GetBestGraph(seedResults []*EpochResult) *Graph {
 	// Variable to store the graph with the best (lowest) fitness.
 	var bestGraph *Graph
 
+	// Variable to store the result with the best (lowest) fitness.
+	var bestResult *EpochResult
+
 	for _, result := range seedResults {
 
-		// Update the bestFitness and bestGraph if the current result is better
-		if result.Fitness < bestFitness {
+		// Update the bestFitness and bestResult if the current result is better
+		// Seeds that were abandoned during seed racing are never picked
+		if !result.Pruned && result.Fitness < bestFitness {
 			bestFitness = result.Fitness
-			bestGraph = result.Graph
+			bestResult = result
 		}
+	}
 
-		// Free up memory by discarding the reference to the graph
-		result.Graph = nil
+	// In ensemble mode, the consensus of the seeds is picked rather than any single seed
+	for _, result := range seedResults {
+		if result.Consensus && (result.Graph != nil || result.State != nil) {
+			bestResult = result
+		}
+	}
+
+	// Seeds run on a shared topology only hold their labels, which are written back into the shared graph
+	if bestResult != nil {
+		bestGraph = bestResult.Graph
+		if bestGraph == nil && bestResult.State != nil {
+			bestGraph = bestResult.Topology.Apply(bestResult.State)
+		}
+	}
+
+	// Free up memory by discarding the references to the graphs and label states
+	for _, result := range seedResults {
+		result.discardLabelling()
 	}
 
 	return bestGraph
 }
+
+// Function to discard the graph or label state of a result, together with the shared topology it refers to
+func (result *EpochResult) discardLabelling() {
+	result.Graph = nil
+	result.State = nil
+	result.Topology = nil
+}
+
+/*
+Function that works out how many seeds can be run at the same time, given the number of bytes each seed needs
+for its own copy of the graph (or of the label state, when the topology is shared)
+
+The number of seeds run at once is capped by the maximum number of workers in the config (if set).
+If a memory budget is set, the number is also capped by how many copies fit in the budget.
+One copy is always reserved for the best result found so far, which is kept while the other seeds run.
+At least one seed is always allowed to run, even if the budget is too small for it.
+*/
+func ConcurrentSeedLimit(copySize int64, numberOfSeeds int, config AllocationConfig) int {
+
+	limit := numberOfSeeds
+
+	// Cap the number of goroutines by the size of the worker pool
+	if config.MaxWorkers > 0 && config.MaxWorkers < limit {
+		limit = config.MaxWorkers
+	}
+
+	// Cap the number of goroutines by how many copies fit in the memory budget
+	if config.MemoryBudget > 0 {
+		copiesInBudget := int(config.MemoryBudget / max(copySize, 1))
+
+		// Reserve one of the copies for the best graph found so far
+		if copiesInBudget-1 < limit {
+			limit = copiesInBudget - 1
+		}
+		if limit < 1 {
+			log.Printf("Memory budget of %d bytes is too small for copies of %d bytes, running one seed at a time",
+				config.MemoryBudget, copySize)
+			limit = 1
+		}
+	}
+
+	return max(limit, 1)
+}
+
+/*
+Function that runs the given function once for each seed, using a pool of goroutines of the given size
+
+The results are returned in the same order as the seeds.
+If keepOnlyBest is true, the graph (or label state) of a result is discarded as soon as a result with a better
+fitness is found, so that at most one is kept besides the ones still being worked on. Ties are broken in favour of the
+seed that comes first, to pick the same graph as GetBestGraph.
+
+If the context is cancelled, the seeds which have not started yet are skipped, and only the results of the
+seeds that were started are returned. The first seed is always started, so there is at least one result.
+*/
+func RunSeeds(ctx context.Context, seeds []int64, numberOfWorkers int, keepOnlyBest bool,
+	runSeed func(seed int64) *EpochResult) []*EpochResult {
+
+	results := make([]*EpochResult, len(seeds))
+
+	// Channel holding the index of the seeds that still need to be run
+	pending := make(chan int, len(seeds))
+	for i := range seeds {
+		pending <- i
+	}
+	close(pending)
+
+	// Keep track of the best result so far, when only the best graph is being kept
+	var mu sync.Mutex
+	bestIndex := -1
+
+	// Create a WaitGroup to wait for all workers to finish
+	var wg sync.WaitGroup
+
+	for worker := 0; worker < max(numberOfWorkers, 1); worker++ {
+
+		wg.Add(1)
+
+		// Each worker keeps on running seeds until there are none left
+		go func() {
+			defer wg.Done()
+
+			for i := range pending {
+
+				// Skip the seeds that have not started yet once the context is cancelled
+				if i > 0 && Cancelled(ctx) {
+					continue
+				}
+
+				result := runSeed(seeds[i])
+				results[i] = result
+
+				if !keepOnlyBest || result == nil {
+					continue
+				}
+
+				// Seeds that were abandoned during seed racing can never be the best
+				if result.Pruned {
+					result.discardLabelling()
+					continue
+				}
+
+				mu.Lock()
+
+				// Discard the graph of whichever of the two results is worse
+				if bestIndex == -1 {
+					bestIndex = i
+				} else if best := results[bestIndex]; result.Fitness < best.Fitness ||
+					(result.Fitness == best.Fitness && i < bestIndex) {
+					best.discardLabelling()
+					bestIndex = i
+				} else {
+					result.discardLabelling()
+				}
+
+				mu.Unlock()
+			}
+		}()
+	}
+
+	// Wait for all seeds to finish
+	wg.Wait()
+
+	// Remove the results of the seeds that were skipped
+	startedResults := make([]*EpochResult, 0, len(results))
+	for _, result := range results {
+		if result != nil {
+			startedResults = append(startedResults, result)
+		}
+	}
+
+	return startedResults
+}
@@ -0,0 +1,76 @@
+package shared
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// The number of seeds run at once is capped by the worker pool and by the copies that fit in the memory budget, with
+// one copy kept for the best result, and at least one seed always runs
+func TestConcurrentSeedLimit(t *testing.T) {
+
+	cases := []struct {
+		name          string
+		copySize      int64
+		numberOfSeeds int
+		config        AllocationConfig
+		expected      int
+	}{
+		{"no limit", 100, 8, AllocationConfig{}, 8},
+		{"worker pool", 100, 8, AllocationConfig{MaxWorkers: 3}, 3},
+		{"worker pool larger than seeds", 100, 8, AllocationConfig{MaxWorkers: 20}, 8},
+		{"memory budget", 100, 8, AllocationConfig{MemoryBudget: 500}, 4},
+		{"memory budget and worker pool", 100, 8, AllocationConfig{MaxWorkers: 2, MemoryBudget: 500}, 2},
+		{"memory budget larger than seeds", 100, 8, AllocationConfig{MemoryBudget: 10_000}, 8},
+		{"memory budget for two copies", 100, 8, AllocationConfig{MemoryBudget: 299}, 1},
+		{"memory budget too small", 100, 8, AllocationConfig{MemoryBudget: 150}, 1},
+		{"empty copies", 0, 8, AllocationConfig{MemoryBudget: 4}, 3},
+	}
+
+	for _, c := range cases {
+		if limit := ConcurrentSeedLimit(c.copySize, c.numberOfSeeds, c.config); limit != c.expected {
+			t.Errorf("%s: limit is %d, expected %d", c.name, limit, c.expected)
+		}
+	}
+}
+
+// No more seeds run at the same time than there are workers, and the results are in the order of the seeds
+func TestRunSeedsBoundedByWorkers(t *testing.T) {
+
+	seeds := []int64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+
+	for _, numberOfWorkers := range []int{1, 3, 20} {
+		var mu sync.Mutex
+		running, maxRunning := 0, 0
+
+		results := RunSeeds(context.Background(), seeds, numberOfWorkers, false, func(seed int64) *EpochResult {
+			mu.Lock()
+			running++
+			maxRunning = max(maxRunning, running)
+			mu.Unlock()
+
+			// Give the other workers time to start their seeds
+			time.Sleep(2 * time.Millisecond)
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return &EpochResult{Seed: seed}
+		})
+
+		if maxRunning > min(numberOfWorkers, len(seeds)) {
+			t.Errorf("%d workers: %d seeds ran at the same time", numberOfWorkers, maxRunning)
+		}
+		if len(results) != len(seeds) {
+			t.Fatalf("%d workers: got %d results for %d seeds", numberOfWorkers, len(results), len(seeds))
+		}
+		for i, result := range results {
+			if result.Seed != seeds[i] {
+				t.Errorf("%d workers: result %d is for seed %d, expected %d", numberOfWorkers, i, result.Seed,
+					seeds[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package shared
+
+import (
+	"hash/fnv"
+	"math"
+	"math/rand"
+)
+
+/*
+PlacementPolicy picks the shard of an account that has no shard yet
+
+It is given the ID of the account, the weight of its edges with the accounts already in each shard, the current
+workloads of the shards, and a random generator for any random choice. It returns the shard of the account.
+*/
+type PlacementPolicy func(id string, edgeWeightWithShard []int, shardWorkloads []int, randomGen *rand.Rand) int
+
+// Policy that places an account in a random shard, as at the start of CLPA
+func RandomPlacement(id string, edgeWeightWithShard []int, shardWorkloads []int, randomGen *rand.Rand) int {
+	return randomGen.Intn(len(shardWorkloads))
+}
+
+// Policy that places an account in a shard picked from the hash of its address
+// The shard of an account is always the same, without any need for coordination
+func HashPlacement(id string, edgeWeightWithShard []int, shardWorkloads []int, randomGen *rand.Rand) int {
+	hash := fnv.New32a()
+	hash.Write([]byte(id))
+	return int(hash.Sum32() % uint32(len(shardWorkloads)))
+}
+
+// Map of the names of the placement policies, used to select a policy and to label results
+var PlacementPolicies = map[string]PlacementPolicy{
+	"random":       RandomPlacement,
+	"hash":         HashPlacement,
+	"least-loaded": LeastLoadedPlacement,
+	"majority":     MajorityNeighbourPlacement,
+}
+
+// Policy that places an account in the shard with the lowest workload, picking randomly between shards that tie
+func LeastLoadedPlacement(id string, edgeWeightWithShard []int, shardWorkloads []int, randomGen *rand.Rand) int {
+	return pickLowest(shardWorkloads, randomGen)
+}
+
+// Policy that places an account in the shard it has the most edge weight with, which is the shard holding the
+// majority of its transactions with accounts that already have a shard
+// Ties are broken by the lowest workload, and an account with no such neighbours goes to the least loaded shard
+func MajorityNeighbourPlacement(id string, edgeWeightWithShard []int, shardWorkloads []int, randomGen *rand.Rand) int {
+
+	maxWeight := 0
+	for _, weight := range edgeWeightWithShard {
+		maxWeight = max(maxWeight, weight)
+	}
+	if maxWeight == 0 {
+		return pickLowest(shardWorkloads, randomGen)
+	}
+
+	// Only the shards with the most edge weight can be picked, so the others are given the highest workload
+	workloads := make([]int, len(shardWorkloads))
+	for shard, weight := range edgeWeightWithShard {
+		if weight == maxWeight {
+			workloads[shard] = shardWorkloads[shard]
+		} else {
+			workloads[shard] = math.MaxInt
+		}
+	}
+	return pickLowest(workloads, randomGen)
+}
+
+// Function to pick the shard with the lowest value, picking randomly between shards that tie
+func pickLowest(values []int, randomGen *rand.Rand) int {
+
+	var candidates []int
+	for shard, value := range values {
+		if len(candidates) == 0 || value < values[candidates[0]] {
+			candidates = []int{shard}
+		} else if value == values[candidates[0]] {
+			candidates = append(candidates, shard)
+		}
+	}
+
+	if len(candidates) == 1 {
+		return candidates[0]
+	}
+	return candidates[randomGen.Intn(len(candidates))]
+}
+
+/*
+Function to give a shard to the new vertices of the graph (those with a label of -1) with the placement policy,
+in the given order
+
+The policy is given the edge weight of a vertex with the vertices that already have a shard, including the new
+vertices placed before it. The workloads given to the policy are those of the transactions between vertices that
+already have a shard, according to the cost model of the graph, and they go up as each vertex is placed.
+*/
+func PlaceNewVertices(graph *Graph, newVertices []*Vertex, policy PlacementPolicy, randomGen *rand.Rand) {
+
+	costModel := graph.WorkloadCostModel()
+
+	// Work out the workloads of the transactions between the vertices that already have a shard
+	workloads := CalculateShardWorkloads(graph)
+
+	for _, vertex := range newVertices {
+
+		// Work out the edge weight of the vertex with each shard
+		edgeWeightWithShard := make([]int, graph.NumberOfShards)
+		for neighbourID, weight := range vertex.Edges {
+			if neighbour := graph.Vertices[neighbourID]; neighbour != nil && neighbour.Label >= 0 {
+				edgeWeightWithShard[neighbour.Label] += weight
+			}
+		}
+
+		vertex.Label = policy(vertex.ID, edgeWeightWithShard, workloads, randomGen)
+
+		// Add the transactions of the vertex with the vertices that have a shard to the workloads
+		for neighbourID, weight := range vertex.Edges {
+			neighbour := graph.Vertices[neighbourID]
+			if neighbour == nil || neighbour.Label < 0 {
+				continue
+			}
+			sent := vertex.Sent[neighbourID]
+			own, other := costModel.EdgeCost(sent, weight-sent, vertex.Label == neighbour.Label)
+			workloads[vertex.Label] += own
+			workloads[neighbour.Label] += other
+		}
+	}
+}
+
+// Function to give a shard to the new vertices of a label state (those with a label of -1) with the placement
+// policy of the topology, in the order of the vertices in the topology
+// This works in the same way as PlaceNewVertices, on a graph that is shared by the seeds
+func (topology *Topology) PlaceNewVertices(state *LabelState, randomGen *rand.Rand) {
+
+	// Work out the workloads of the transactions between the vertices that already have a shard
+	workloads := topology.CalculateShardWorkloads(state)
+
+	for v, vertex := range topology.Vertices {
+		if state.Labels[v] != -1 {
+			continue
+		}
+
+		// Work out the edge weight of the vertex with each shard
+		edgeWeightWithShard := make([]int, topology.NumberOfShards)
+		for _, neighbour := range topology.Neighbours[v] {
+			if neighbourLabel := state.Labels[neighbour.Index]; neighbourLabel >= 0 {
+				edgeWeightWithShard[neighbourLabel] += neighbour.Weight
+			}
+		}
+
+		label := topology.Placement(vertex.ID, edgeWeightWithShard, workloads, randomGen)
+		state.Labels[v] = label
+
+		// Add the transactions of the vertex with the vertices that have a shard to the workloads
+		for _, neighbour := range topology.Neighbours[v] {
+			neighbourLabel := state.Labels[neighbour.Index]
+			if neighbourLabel < 0 {
+				continue
+			}
+			own, other := topology.CostModel.EdgeCost(neighbour.Sent, neighbour.Weight-neighbour.Sent,
+				label == neighbourLabel)
+			workloads[label] += own
+			workloads[neighbourLabel] += other
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package shared
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// The hash placement of an account only depends on its address and the number of shards
+func TestHashPlacementDeterministic(t *testing.T) {
+
+	used := make(map[int]bool)
+	for i := 0; i < 100; i++ {
+		id := fmt.Sprintf("0x%04x", i)
+		shard := HashPlacement(id, []int{0, 0, 0, 0}, []int{0, 0, 0, 0}, rand.New(rand.NewSource(1)))
+		if shard < 0 || shard >= 4 {
+			t.Fatalf("Account %s was placed in shard %d of 4", id, shard)
+		}
+		used[shard] = true
+
+		// Other edge weights, workloads and random generators give the same shard
+		other := HashPlacement(id, []int{9, 0, 0, 0}, []int{0, 5, 5, 5}, rand.New(rand.NewSource(2)))
+		if other != shard {
+			t.Fatalf("Account %s was placed in shard %d, then in shard %d", id, shard, other)
+		}
+	}
+
+	if len(used) != 4 {
+		t.Errorf("100 accounts were only placed in %d of 4 shards", len(used))
+	}
+}
+
+// The least loaded and majority-neighbour policies pick the shards expected, whatever the random generator
+func TestPlacementPolicies(t *testing.T) {
+
+	cases := []struct {
+		name                string
+		policy              PlacementPolicy
+		edgeWeightWithShard []int
+		shardWorkloads      []int
+		expected            []int // The shards that can be picked
+	}{
+		{"least loaded", LeastLoadedPlacement, []int{5, 0, 0}, []int{3, 1, 2}, []int{1}},
+		{"least loaded tie", LeastLoadedPlacement, []int{0, 0, 0}, []int{1, 4, 1}, []int{0, 2}},
+		{"majority", MajorityNeighbourPlacement, []int{1, 5, 2}, []int{0, 9, 0}, []int{1}},
+		{"majority tie broken by workload", MajorityNeighbourPlacement, []int{3, 0, 3}, []int{10, 0, 4}, []int{2}},
+		{"majority tie with the same workload", MajorityNeighbourPlacement, []int{3, 3, 1}, []int{2, 2, 0},
+			[]int{0, 1}},
+		{"majority without neighbours", MajorityNeighbourPlacement, []int{0, 0, 0}, []int{5, 2, 7}, []int{1}},
+	}
+
+	for _, c := range cases {
+		picked := make(map[int]bool)
+		for seed := int64(0); seed < 50; seed++ {
+			picked[c.policy("a", c.edgeWeightWithShard, c.shardWorkloads, rand.New(rand.NewSource(seed)))] = true
+		}
+
+		if len(picked) != len(c.expected) {
+			t.Errorf("%s: picked shards %v, expected %v", c.name, picked, c.expected)
+			continue
+		}
+		for _, shard := range c.expected {
+			if !picked[shard] {
+				t.Errorf("%s: picked shards %v, expected %v", c.name, picked, c.expected)
+			}
+		}
+	}
+}
+
+// Function to build a graph where a is in shard 1, the new vertex b transacts with a, and the new vertex c only
+// transacts with b, with the majority-neighbour policy
+func placementTestGraph() *Graph {
+	graph := &Graph{Vertices: make(map[string]*Vertex), NumberOfShards: 3, Placement: MajorityNeighbourPlacement}
+	for id, label := range map[string]int{"a": 1, "b": -1, "c": -1} {
+		graph.Vertices[id] = &Vertex{ID: id, Label: label, Edges: map[string]int{}, Sent: map[string]int{}}
+	}
+	for _, pair := range [][2]string{{"a", "b"}, {"b", "c"}} {
+		graph.Vertices[pair[0]].Edges[pair[1]] = 1
+		graph.Vertices[pair[1]].Edges[pair[0]] = 1
+		graph.Vertices[pair[0]].Sent[pair[1]] = 1
+	}
+	return graph
+}
+
+// A new vertex is placed with the new vertices placed before it, on a graph and on a label state alike
+func TestPlaceNewVerticesFollowsEarlierPlacements(t *testing.T) {
+
+	graph := placementTestGraph()
+	PlaceNewVertices(graph, []*Vertex{graph.Vertices["b"], graph.Vertices["c"]}, graph.Placement,
+		rand.New(rand.NewSource(1)))
+	if graph.Vertices["b"].Label != 1 || graph.Vertices["c"].Label != 1 {
+		t.Errorf("Graph: b and c were placed in shards %d and %d, expected shard 1 of a", graph.Vertices["b"].Label,
+			graph.Vertices["c"].Label)
+	}
+
+	topology := NewTopology(placementTestGraph())
+	state := topology.NewLabelState()
+	topology.PlaceNewVertices(state, rand.New(rand.NewSource(1)))
+	for v, vertex := range topology.Vertices {
+		if state.Labels[v] != 1 {
+			t.Errorf("Label state: %s was placed in shard %d, expected shard 1 of a", vertex.ID, state.Labels[v])
+		}
+	}
+}
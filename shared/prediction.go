@@ -0,0 +1,102 @@
+package shared
+
+import (
+	"errors"
+	"math/rand"
+)
+
+/*
+Predictive evaluation scores the allocation found at an epoch on the transactions of the next epoch, which is what
+the allocation would face once deployed, rather than on the transactions it was optimised for.
+
+The accounts keep the shards they had at the end of the epoch. Accounts first seen in the next epoch are given a
+shard by the placement policy, in the order in which they first appear in the transactions. As when new vertices are
+placed at the start of an epoch, the policy sees the workloads of the transactions of the next epoch between the
+accounts that already have a shard, which go up as each new account is placed.
+*/
+
+// The outcome of a predictive evaluation
+type PredictiveResult struct {
+	NewAccounts int // The number of accounts of the next epoch which had no shard, and were placed by the policy
+
+	// The out-of-sample metrics of the allocation on the transactions of the next epoch
+	Metrics *Metrics
+}
+
+// Function to evaluate the allocation in graph on the transactions in rows (of the next epoch)
+// The first row is the header, which must have a "from" and a "to" column. The graph is not changed.
+func EvaluateOnNextEpoch(graph *Graph, rows [][]string, alpha float64, policy PlacementPolicy,
+	randomGen *rand.Rand) (*PredictiveResult, error) {
+
+	if len(rows) == 0 {
+		return nil, errors.New("no transactions to evaluate on")
+	}
+
+	// Parse header row to find "from" and "to" indices
+	fromIdx, toIdx := -1, -1
+	for i, col := range rows[0] {
+		if col == "from" {
+			fromIdx = i
+		}
+		if col == "to" {
+			toIdx = i
+		}
+	}
+	if fromIdx == -1 || toIdx == -1 {
+		return nil, errors.New("'from' or 'to' column not found in header")
+	}
+
+	// Build a separate graph of the transactions of the next epoch, so the graph being evaluated is not changed
+	evaluation := &Graph{
+		Vertices:       make(map[string]*Vertex),
+		NumberOfShards: graph.NumberOfShards,
+		CostModel:      graph.CostModel,
+	}
+
+	// The accounts without a shard, in the order in which they first appear
+	var newAccounts []*Vertex
+
+	addVertex := func(id string) {
+		if _, exists := evaluation.Vertices[id]; exists {
+			return
+		}
+		vertex := &Vertex{ID: id, Label: -1, Edges: make(map[string]int), Sent: make(map[string]int)}
+		if known, exists := graph.Vertices[id]; exists {
+			vertex.Label = known.Label
+		} else {
+			newAccounts = append(newAccounts, vertex)
+		}
+		evaluation.Vertices[id] = vertex
+	}
+
+	for i, row := range rows {
+		// Skip the header
+		if i == 0 {
+			continue
+		}
+		if len(row) <= max(fromIdx, toIdx) {
+			continue // Skip invalid/malformed rows
+		}
+		from, to := row[fromIdx], row[toIdx]
+
+		addVertex(from)
+		addVertex(to)
+
+		// Add the edge in the same way as when the graph of an epoch is built
+		evaluation.Vertices[from].Edges[to]++
+		if from != to {
+			evaluation.Vertices[to].Edges[from]++
+		}
+		evaluation.Vertices[from].Sent[to]++
+	}
+
+	// Place the new accounts in the same way as at the start of an epoch, so each sees the accounts placed before it
+	PlaceNewVertices(evaluation, newAccounts, policy, randomGen)
+
+	evaluation.ShardWorkloads = CalculateShardWorkloads(evaluation)
+
+	return &PredictiveResult{
+		NewAccounts: len(newAccounts),
+		Metrics:     CalculateMetrics(evaluation, alpha),
+	}, nil
+}
@@ -0,0 +1,42 @@
+package shared
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+// Policies that look at the workloads see them go up as the new accounts are placed, so the new accounts of the next
+// epoch are spread over the shards rather than all going to the shard that was least loaded at the end of the epoch
+func TestEvaluateOnNextEpochSpreadsNewAccounts(t *testing.T) {
+
+	graph := &Graph{
+		Vertices:       make(map[string]*Vertex),
+		NumberOfShards: 4,
+		ShardWorkloads: []int{100, 101, 101, 101},
+	}
+	for shard := 0; shard < 4; shard++ {
+		id := fmt.Sprintf("known%d", shard)
+		graph.Vertices[id] = &Vertex{ID: id, Label: shard}
+	}
+
+	rows := [][]string{{"from", "to"}}
+	for i := 0; i < 40; i++ {
+		rows = append(rows, []string{fmt.Sprintf("new%02da", i), fmt.Sprintf("new%02db", i)})
+	}
+
+	for _, name := range []string{"least-loaded", "majority"} {
+		result, err := EvaluateOnNextEpoch(graph, rows, 0.5, PlacementPolicies[name], rand.New(rand.NewSource(1)))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if result.NewAccounts != 80 {
+			t.Fatalf("%s: %d new accounts, expected 80", name, result.NewAccounts)
+		}
+		if result.Metrics.WorkloadImbalance > 2 {
+			t.Fatalf("%s: imbalance is %v, with intra-shard workloads %v and cross-shard workloads %v", name,
+				result.Metrics.WorkloadImbalance, result.Metrics.ShardIntraWorkloads,
+				result.Metrics.ShardCrossWorkloads)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package shared
+
+import (
+	"sync"
+	"time"
+)
+
+// Struct to hold the settings of seed racing
+type RaceConfig struct {
+	ReportInterval int     // Number of iterations between two reports of the fitness of a seed
+	Margin         float64 // A seed is abandoned if its fitness is worse than the leader's by more than this fraction
+}
+
+// Struct to hold the outcome of a race between the seeds of an epoch
+type RaceSummary struct {
+	PrunedSeeds   []int64       // The seeds that were abandoned
+	TimeSaved     time.Duration // Estimate of the time the abandoned seeds would have taken to run to the end
+	EarlyLeader   int64         // The seed that was leading when the first seed was abandoned
+	Winner        int64         // The seed with the best fitness out of the seeds that were not abandoned
+	WinnerChanged bool          // true if the winner is not the seed that was leading when the first seed was abandoned
+}
+
+/*
+SeedRace is the coordinator of a race between the seeds of an epoch.
+Every few iterations, each seed reports its fitness to the coordinator, which compares it to the best fitness
+reported by any seed after the same number of iterations. Seeds that are clearly behind the leader are told to
+stop, so that their CPU time goes to the other seeds.
+
+Since seeds are compared with the seeds that reached the same iteration before them, the seeds that are
+abandoned depend on the timing of the goroutines, and are not deterministic.
+*/
+type SeedRace struct {
+	config RaceConfig
+
+	mu          sync.Mutex
+	leaders     map[int]int64   // The seed with the best fitness reported after each number of iterations
+	bestFitness map[int]float64 // The best fitness reported after each number of iterations
+	summary     RaceSummary
+	anyPruned   bool
+}
+
+// Function to create the coordinator of a seed race
+func NewSeedRace(config RaceConfig) *SeedRace {
+
+	// Seeds need to report at least once every iteration
+	if config.ReportInterval < 1 {
+		config.ReportInterval = 1
+	}
+
+	race := &SeedRace{config: config}
+	race.Start()
+
+	return race
+}
+
+// Function to clear the state of the race, so that the coordinator can be used for a new epoch
+func (r *SeedRace) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.leaders = make(map[int]int64)
+	r.bestFitness = make(map[int]float64)
+	r.summary = RaceSummary{}
+	r.anyPruned = false
+}
+
+// Function that reports whether a seed should report its fitness after the given number of iterations
+func (r *SeedRace) IsCheckpoint(iterations int) bool {
+	return iterations%r.config.ReportInterval == 0
+}
+
+/*
+Function used by a seed to report its fitness after a number of iterations.
+elapsed is the time the seed has been running for, and remainingIterations is the number of iterations it
+would still run. The function returns false if the seed is too far behind the leader and should be abandoned.
+*/
+func (r *SeedRace) Checkpoint(seed int64, iterations int, fitness float64, elapsed time.Duration,
+	remainingIterations int) bool {
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	best, reported := r.bestFitness[iterations]
+
+	// The first seed to reach this number of iterations becomes the leader
+	if !reported || fitness < best {
+		r.bestFitness[iterations] = fitness
+		r.leaders[iterations] = seed
+		return true
+	}
+
+	// Keep the seed running if it is within the margin of the leader
+	// The absolute value is taken since the fitness can be negative
+	if fitness-best <= r.config.Margin*max(best, -best) {
+		return true
+	}
+
+	// Abandon the seed, and estimate the time saved from the average time of its iterations so far
+	if !r.anyPruned {
+		r.anyPruned = true
+		r.summary.EarlyLeader = r.leaders[iterations]
+	}
+	r.summary.PrunedSeeds = append(r.summary.PrunedSeeds, seed)
+	r.summary.TimeSaved += elapsed / time.Duration(iterations) * time.Duration(remainingIterations)
+
+	return false
+}
+
+// Function to work out the outcome of the race from the results of the seeds, once all seeds are done
+func (r *SeedRace) Finish(results []*EpochResult) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Find the winner, ignoring the seeds that were abandoned
+	var winner *EpochResult
+	for _, result := range results {
+		if result.Pruned {
+			continue
+		}
+		if winner == nil || result.Fitness < winner.Fitness {
+			winner = result
+		}
+	}
+
+	if winner == nil {
+		return
+	}
+
+	r.summary.Winner = winner.Seed
+	r.summary.WinnerChanged = r.anyPruned && r.summary.EarlyLeader != winner.Seed
+}
+
+// Function that returns the outcome of the last race
+func (r *SeedRace) Summary() RaceSummary {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.summary
+}
@@ -0,0 +1,80 @@
+package shared
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+// Seeds clearly behind the leader after the same number of iterations are abandoned, but the first seed to reach a
+// number of iterations and any seed that beats the leader always keep running
+func TestSeedRaceCheckpoint(t *testing.T) {
+
+	race := NewSeedRace(RaceConfig{ReportInterval: 3, Margin: 0.1})
+	if !race.IsCheckpoint(3) || !race.IsCheckpoint(6) || race.IsCheckpoint(4) {
+		t.Errorf("Checkpoints are not every 3 iterations")
+	}
+
+	reports := []struct {
+		seed       int64
+		iterations int
+		fitness    float64
+		keep       bool
+	}{
+		{1, 3, 10, true},   // The first seed after 3 iterations leads
+		{2, 3, 10.9, true}, // Within 10% of the leader
+		{3, 3, 12, false},  // More than 10% behind the leader
+		{4, 3, 8, true},    // Beats the leader, and leads from now on
+		{2, 3, 9, false},   // More than 10% behind the new leader
+		{3, 6, 1000, true}, // The first seed after 6 iterations leads, however bad its fitness
+		{5, 6, -10, true},  // Negative fitness, so the margin is taken from its absolute value
+		{1, 6, -9.5, true},
+		{4, 6, -8, false},
+	}
+	for _, report := range reports {
+		if keep := race.Checkpoint(report.seed, report.iterations, report.fitness, 30*time.Millisecond,
+			10); keep != report.keep {
+			t.Errorf("Seed %d with fitness %v after %d iterations: keep is %v, expected %v", report.seed,
+				report.fitness, report.iterations, keep, report.keep)
+		}
+	}
+
+	// Seed 1 led when seed 3 was abandoned, and each abandoned seed would have run 10 more iterations, at the average
+	// time of the iterations it ran
+	summary := race.Summary()
+	if !slices.Equal(summary.PrunedSeeds, []int64{3, 2, 4}) || summary.EarlyLeader != 1 {
+		t.Errorf("Pruned seeds %v with early leader %d, expected [3 2 4] and 1", summary.PrunedSeeds,
+			summary.EarlyLeader)
+	}
+	if expected := 2*100*time.Millisecond + 50*time.Millisecond; summary.TimeSaved != expected {
+		t.Errorf("Time saved is %v, expected %v", summary.TimeSaved, expected)
+	}
+
+	// The winner is the best seed that was not abandoned, which changed if it is not the early leader
+	race.Finish([]*EpochResult{{Seed: 1, Fitness: 7}, {Seed: 5, Fitness: 6.5}})
+	if summary = race.Summary(); summary.Winner != 5 || !summary.WinnerChanged {
+		t.Errorf("Winner is %d and changed is %v, expected seed 5 instead of the early leader", summary.Winner,
+			summary.WinnerChanged)
+	}
+
+	// An abandoned seed never wins, even with a better fitness
+	race.Finish([]*EpochResult{
+		{Seed: 1, Fitness: 7},
+		{Seed: 2, Fitness: 6, Pruned: true},
+		{Seed: 5, Fitness: 7.5},
+	})
+	if summary = race.Summary(); summary.Winner != 1 || summary.WinnerChanged {
+		t.Errorf("Winner is %d and changed is %v, expected seed 1 which led early", summary.Winner,
+			summary.WinnerChanged)
+	}
+
+	// A new race starts afresh
+	race.Start()
+	if !race.Checkpoint(9, 3, 50, time.Millisecond, 1) {
+		t.Errorf("First seed of a new race was abandoned")
+	}
+	race.Finish([]*EpochResult{{Seed: 9, Fitness: 50}})
+	if summary = race.Summary(); len(summary.PrunedSeeds) != 0 || summary.Winner != 9 || summary.WinnerChanged {
+		t.Errorf("New race has summary %+v, expected only seed 9 as the winner", summary)
+	}
+}
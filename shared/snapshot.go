@@ -0,0 +1,562 @@
+package shared
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+/*
+Graph snapshots are saved in a versioned binary format, so that the graph carried over between epochs can be
+saved to disk and an allocation can be resumed from any saved epoch.
+
+The format starts with the magic bytes and the version, followed by the number of shards, the shard workloads
+and the vertices sorted by ID. Each vertex holds its ID, label, number of label updates, new label, votes and
+edges, where the neighbours of a vertex are referred to by their position in the sorted list of vertices.
+From version 2 of the format, the edges are followed by the weight sent by the vertex to each neighbour, and
+the vertices are followed by the sliding window of the graph, if it has one, which holds the transactions of each
+epoch in the window, referring to the accounts by their position in the same way.
+Integers are written as varints, and votes as the bits of their float64 value, so everything round-trips exactly.
+Maps and slices that are nil are told apart from empty ones.
+
+The cost model and placement policy of the graph are not saved, since they are settings rather than data, so they
+have to be set again on the loaded graph if they are not the ones of the paper.
+
+A snapshot can also be gzip-compressed, which makes it smaller and more portable. LoadGraph detects this by itself.
+*/
+
+// Magic bytes at the start of every graph snapshot
+const snapshotMagic = "SLPAGRPH"
+
+// Version of the snapshot format written by SaveGraph
+// Version 1 had no sent weights and no sliding window, and can still be loaded
+const snapshotVersion = 2
+
+// Longest vertex ID accepted when loading a snapshot, so a corrupt file cannot cause a huge allocation
+const maxSnapshotString = 1 << 20
+
+// Largest count (of vertices, edges, votes, workloads or window epochs) and position of a vertex accepted when
+// loading a snapshot, so a corrupt file cannot make a count overflow or wrap around to a negative int
+const maxSnapshotCount = 1 << 31
+
+// Most elements allocated up front for a count read from a snapshot
+// Anything beyond it is appended as it is read, so a corrupt count runs into the end of the input instead of
+// allocating memory the input could never fill
+const maxSnapshotPrealloc = 1 << 12
+
+// Magic bytes at the start of any gzip stream
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// Function to save the graph to a file, compressing it with gzip if compress is true
+// The file is written to a temporary file first and then renamed, so a crash never leaves a partial snapshot
+func SaveGraph(path string, graph *Graph, compress bool) error {
+
+	// Write to a temporary file in the same directory, so that the rename does not cross file systems
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("error creating snapshot file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	var w io.Writer = tmp
+	var zw *gzip.Writer
+	if compress {
+		zw = gzip.NewWriter(tmp)
+		w = zw
+	}
+
+	if err := WriteGraph(w, graph); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if zw != nil {
+		if err := zw.Close(); err != nil {
+			tmp.Close()
+			return fmt.Errorf("error compressing snapshot: %w", err)
+		}
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error closing snapshot file: %w", err)
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// Function to load a graph saved by SaveGraph, whether it was compressed or not
+func LoadGraph(path string) (*Graph, error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening snapshot file: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+
+	// Check whether the snapshot was compressed, by looking at its first bytes
+	start, err := reader.Peek(len(gzipMagic))
+	if err != nil {
+		return nil, fmt.Errorf("error reading snapshot file: %w", err)
+	}
+
+	var r io.Reader = reader
+	if bytes.Equal(start, gzipMagic) {
+		zr, err := gzip.NewReader(reader)
+		if err != nil {
+			return nil, fmt.Errorf("error decompressing snapshot: %w", err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	return ReadGraph(r)
+}
+
+// Function to write the graph to w in the snapshot format, without compression
+func WriteGraph(w io.Writer, graph *Graph) error {
+	return writeGraphVersion(w, graph, snapshotVersion)
+}
+
+// Function to write the graph to w in the given version of the snapshot format, leaving out what the version cannot
+// hold, so that loading older snapshots can be tested
+func writeGraphVersion(w io.Writer, graph *Graph, version uint64) error {
+
+	sw := &snapshotWriter{w: bufio.NewWriter(w)}
+
+	// Sort the vertex IDs, so that the same graph is always written in the same way
+	ids := make([]string, 0, len(graph.Vertices))
+	for id := range graph.Vertices {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	index := make(map[string]int, len(ids))
+	for i, id := range ids {
+		index[id] = i
+	}
+
+	// Header
+	sw.bytes([]byte(snapshotMagic))
+	sw.uvarint(version)
+	sw.varint(int64(graph.NumberOfShards))
+
+	// Shard workloads
+	sw.length(len(graph.ShardWorkloads), graph.ShardWorkloads == nil)
+	for _, workload := range graph.ShardWorkloads {
+		sw.varint(int64(workload))
+	}
+
+	// Vertices
+	sw.uvarint(uint64(len(ids)))
+	for _, id := range ids {
+		vertex := graph.Vertices[id]
+
+		sw.string(vertex.ID)
+		sw.varint(int64(vertex.Label))
+		sw.varint(int64(vertex.LabelUpdateCounter))
+		sw.varint(int64(vertex.NewLabel))
+
+		// Votes, sorted by shard
+		shards := make([]int, 0, len(vertex.LabelVotes))
+		for shard := range vertex.LabelVotes {
+			shards = append(shards, shard)
+		}
+		sort.Ints(shards)
+
+		sw.length(len(shards), vertex.LabelVotes == nil)
+		for _, shard := range shards {
+			sw.varint(int64(shard))
+			sw.uint64(math.Float64bits(vertex.LabelVotes[shard]))
+		}
+
+		// Edges, sorted by the position of the neighbour
+		neighbours := make([]int, 0, len(vertex.Edges))
+		for neighbourID := range vertex.Edges {
+			neighbour, exists := index[neighbourID]
+			if !exists {
+				return fmt.Errorf("vertex %s has an edge to %s, which is not in the graph", id, neighbourID)
+			}
+			neighbours = append(neighbours, neighbour)
+		}
+		sort.Ints(neighbours)
+
+		sw.length(len(neighbours), vertex.Edges == nil)
+		for _, neighbour := range neighbours {
+			sw.uvarint(uint64(neighbour))
+			sw.varint(int64(vertex.Edges[ids[neighbour]]))
+		}
+
+		// Sent weights, sorted by the position of the neighbour, from version 2
+		if version < 2 {
+			continue
+		}
+		receivers := make([]int, 0, len(vertex.Sent))
+		for neighbourID := range vertex.Sent {
+			neighbour, exists := index[neighbourID]
+			if !exists {
+				return fmt.Errorf("vertex %s has sent to %s, which is not in the graph", id, neighbourID)
+			}
+			receivers = append(receivers, neighbour)
+		}
+		sort.Ints(receivers)
+
+		sw.length(len(receivers), vertex.Sent == nil)
+		for _, neighbour := range receivers {
+			sw.uvarint(uint64(neighbour))
+			sw.varint(int64(vertex.Sent[ids[neighbour]]))
+		}
+	}
+
+	// Sliding window, from version 2
+	if version >= 2 {
+		if err := writeWindow(sw, graph.Window, index); err != nil {
+			return err
+		}
+	}
+
+	if sw.err != nil {
+		return fmt.Errorf("error writing snapshot: %w", sw.err)
+	}
+
+	if err := sw.w.Flush(); err != nil {
+		return fmt.Errorf("error writing snapshot: %w", err)
+	}
+
+	return nil
+}
+
+// Function to read a graph in the snapshot format from r, which must not be compressed
+func ReadGraph(r io.Reader) (*Graph, error) {
+
+	sr := &snapshotReader{r: bufio.NewReader(r)}
+
+	// Header
+	if magic := sr.bytes(len(snapshotMagic)); sr.err == nil && string(magic) != snapshotMagic {
+		return nil, errors.New("not a graph snapshot")
+	}
+	version := sr.uvarint()
+	if sr.err == nil && (version < 1 || version > snapshotVersion) {
+		return nil, fmt.Errorf("unsupported graph snapshot version %d", version)
+	}
+
+	graph := &Graph{
+		NumberOfShards: int(sr.varint()),
+	}
+	if sr.err == nil && (graph.NumberOfShards < 0 || graph.NumberOfShards > maxSnapshotCount) {
+		return nil, fmt.Errorf("invalid number of shards %d in snapshot", graph.NumberOfShards)
+	}
+
+	// Shard workloads
+	if count, isNil := sr.length(); !isNil {
+		graph.ShardWorkloads = make([]int, 0, min(count, maxSnapshotPrealloc))
+		for i := 0; i < count && sr.err == nil; i++ {
+			graph.ShardWorkloads = append(graph.ShardWorkloads, int(sr.varint()))
+		}
+	}
+
+	// Vertices
+	numberOfVertices := sr.count()
+	if sr.err != nil {
+		return nil, fmt.Errorf("error reading snapshot: %w", sr.err)
+	}
+
+	vertices := make([]*Vertex, 0, min(numberOfVertices, maxSnapshotPrealloc))
+	graph.Vertices = make(map[string]*Vertex, min(numberOfVertices, maxSnapshotPrealloc))
+
+	// The edges refer to vertices by position, so they can only be filled in once all vertices are read
+	var edgeNeighbours, edgeWeights, sentNeighbours, sentWeights [][]int
+	var edgesNil, sentNil []bool
+
+	for i := 0; i < numberOfVertices && sr.err == nil; i++ {
+		vertex := &Vertex{
+			ID:                 sr.string(),
+			Label:              int(sr.varint()),
+			LabelUpdateCounter: int(sr.varint()),
+			NewLabel:           int(sr.varint()),
+		}
+
+		if count, isNil := sr.length(); !isNil {
+			vertex.LabelVotes = make(map[int]float64, min(count, maxSnapshotPrealloc))
+			for j := 0; j < count && sr.err == nil; j++ {
+				shard := int(sr.varint())
+				vertex.LabelVotes[shard] = math.Float64frombits(sr.uint64())
+			}
+		}
+
+		neighbours, weights, isNil := sr.neighbours()
+		edgeNeighbours = append(edgeNeighbours, neighbours)
+		edgeWeights = append(edgeWeights, weights)
+		edgesNil = append(edgesNil, isNil)
+
+		// Snapshots before version 2 have no sent weights
+		neighbours, weights, isNil = nil, nil, true
+		if version >= 2 {
+			neighbours, weights, isNil = sr.neighbours()
+		}
+		sentNeighbours = append(sentNeighbours, neighbours)
+		sentWeights = append(sentWeights, weights)
+		sentNil = append(sentNil, isNil)
+
+		vertices = append(vertices, vertex)
+		graph.Vertices[vertex.ID] = vertex
+	}
+
+	if sr.err != nil {
+		return nil, fmt.Errorf("error reading snapshot: %w", sr.err)
+	}
+
+	for i, vertex := range vertices {
+		var err error
+		if vertex.Edges, err = neighbourMap(vertices, edgeNeighbours[i], edgeWeights[i], edgesNil[i]); err != nil {
+			return nil, fmt.Errorf("vertex %s: %w", vertex.ID, err)
+		}
+		if vertex.Sent, err = neighbourMap(vertices, sentNeighbours[i], sentWeights[i], sentNil[i]); err != nil {
+			return nil, fmt.Errorf("vertex %s: %w", vertex.ID, err)
+		}
+	}
+
+	// Snapshots before version 2 have no sliding window
+	if version >= 2 {
+		window, err := readWindow(sr, vertices)
+		if err != nil {
+			return nil, err
+		}
+		graph.Window = window
+	}
+
+	return graph, nil
+}
+
+// Function to write the sliding window of a graph, with the transactions of each epoch sorted by sender and receiver
+func writeWindow(sw *snapshotWriter, window *EdgeWindow, index map[string]int) error {
+
+	if window == nil {
+		sw.length(0, true)
+		return nil
+	}
+
+	// The epochs beyond the size are only dropped at the start of the next epoch, so they cannot be saved yet
+	if len(window.Epochs) > window.Size {
+		return fmt.Errorf("the window of size %d holds %d epochs", window.Size, len(window.Epochs))
+	}
+
+	sw.length(len(window.Epochs), false)
+	sw.varint(int64(window.Size))
+
+	for _, transactions := range window.Epochs {
+		edges := make([][3]int, 0, len(transactions))
+		for edge, count := range transactions {
+			from, fromExists := index[edge.From]
+			to, toExists := index[edge.To]
+			if !fromExists || !toExists {
+				return fmt.Errorf("the window has a transaction from %s to %s, which is not in the graph",
+					edge.From, edge.To)
+			}
+			edges = append(edges, [3]int{from, to, count})
+		}
+		sort.Slice(edges, func(i, j int) bool {
+			if edges[i][0] != edges[j][0] {
+				return edges[i][0] < edges[j][0]
+			}
+			return edges[i][1] < edges[j][1]
+		})
+
+		sw.uvarint(uint64(len(edges)))
+		for _, edge := range edges {
+			sw.uvarint(uint64(edge[0]))
+			sw.uvarint(uint64(edge[1]))
+			sw.varint(int64(edge[2]))
+		}
+	}
+
+	return nil
+}
+
+// Function to read the sliding window of a graph, which is nil if the graph had none
+func readWindow(sr *snapshotReader, vertices []*Vertex) (*EdgeWindow, error) {
+
+	numberOfEpochs, isNil := sr.length()
+	if isNil {
+		if sr.err != nil {
+			return nil, fmt.Errorf("error reading snapshot: %w", sr.err)
+		}
+		return nil, nil
+	}
+
+	// A window keeps at least one epoch, and never more epochs than its size
+	window := &EdgeWindow{Size: int(sr.varint())}
+	if sr.err == nil && (window.Size < 1 || window.Size > maxSnapshotCount) {
+		return nil, fmt.Errorf("invalid window size %d in snapshot", window.Size)
+	}
+	if sr.err == nil && numberOfEpochs > window.Size {
+		return nil, fmt.Errorf("window of size %d holds %d epochs in snapshot", window.Size, numberOfEpochs)
+	}
+
+	for e := 0; e < numberOfEpochs && sr.err == nil; e++ {
+		count := sr.count()
+		transactions := make(map[EdgeKey]int)
+		for j := 0; j < count && sr.err == nil; j++ {
+			from, to := sr.uvarint(), sr.uvarint()
+			weight := int(sr.varint())
+			if from >= uint64(len(vertices)) || to >= uint64(len(vertices)) {
+				return nil, errors.New("window transaction out of range")
+			}
+			if sr.err == nil && weight < 1 {
+				return nil, fmt.Errorf("invalid number of window transactions %d in snapshot", weight)
+			}
+			transactions[EdgeKey{From: vertices[from].ID, To: vertices[to].ID}] = weight
+		}
+		window.Epochs = append(window.Epochs, transactions)
+	}
+
+	if sr.err != nil {
+		return nil, fmt.Errorf("error reading snapshot: %w", sr.err)
+	}
+
+	return window, nil
+}
+
+// Function to turn the positions of neighbours and their weights back into a map of neighbour ID to weight
+func neighbourMap(vertices []*Vertex, neighbours []int, weights []int, isNil bool) (map[string]int, error) {
+	if isNil {
+		return nil, nil
+	}
+	weightsByID := make(map[string]int, len(neighbours))
+	for j, neighbour := range neighbours {
+		if neighbour < 0 || neighbour >= len(vertices) {
+			return nil, errors.New("neighbour out of range")
+		}
+		weightsByID[vertices[neighbour].ID] = weights[j]
+	}
+	return weightsByID, nil
+}
+
+// snapshotWriter writes the parts of a snapshot, keeping the first error so it only needs to be checked at the end
+type snapshotWriter struct {
+	w   *bufio.Writer
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+func (sw *snapshotWriter) bytes(b []byte) {
+	if sw.err == nil {
+		_, sw.err = sw.w.Write(b)
+	}
+}
+
+func (sw *snapshotWriter) uvarint(x uint64) {
+	sw.bytes(sw.buf[:binary.PutUvarint(sw.buf[:], x)])
+}
+
+func (sw *snapshotWriter) varint(x int64) {
+	sw.bytes(sw.buf[:binary.PutVarint(sw.buf[:], x)])
+}
+
+func (sw *snapshotWriter) uint64(x uint64) {
+	binary.LittleEndian.PutUint64(sw.buf[:8], x)
+	sw.bytes(sw.buf[:8])
+}
+
+func (sw *snapshotWriter) string(s string) {
+	sw.uvarint(uint64(len(s)))
+	sw.bytes([]byte(s))
+}
+
+// The length of a map or slice is written plus one, so that 0 can mean nil
+func (sw *snapshotWriter) length(n int, isNil bool) {
+	if isNil {
+		sw.uvarint(0)
+	} else {
+		sw.uvarint(uint64(n) + 1)
+	}
+}
+
+// snapshotReader reads the parts of a snapshot, keeping the first error so it only needs to be checked at the end
+type snapshotReader struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (sr *snapshotReader) bytes(n int) []byte {
+	if sr.err != nil {
+		return nil
+	}
+	b := make([]byte, n)
+	_, sr.err = io.ReadFull(sr.r, b)
+	return b
+}
+
+func (sr *snapshotReader) uvarint() uint64 {
+	if sr.err != nil {
+		return 0
+	}
+	var x uint64
+	x, sr.err = binary.ReadUvarint(sr.r)
+	return x
+}
+
+func (sr *snapshotReader) varint() int64 {
+	if sr.err != nil {
+		return 0
+	}
+	var x int64
+	x, sr.err = binary.ReadVarint(sr.r)
+	return x
+}
+
+func (sr *snapshotReader) uint64() uint64 {
+	b := sr.bytes(8)
+	if sr.err != nil {
+		return 0
+	}
+	return binary.LittleEndian.Uint64(b)
+}
+
+func (sr *snapshotReader) string() string {
+	n := sr.uvarint()
+	if sr.err == nil && n > maxSnapshotString {
+		sr.err = errors.New("string too long")
+	}
+	return string(sr.bytes(int(n)))
+}
+
+// A count is rejected if it is above maxSnapshotCount, so that it always fits in a non-negative int
+func (sr *snapshotReader) count() int {
+	n := sr.uvarint()
+	if sr.err == nil && n > maxSnapshotCount {
+		sr.err = fmt.Errorf("count %d too large", n)
+	}
+	if sr.err != nil {
+		return 0
+	}
+	return int(n)
+}
+
+func (sr *snapshotReader) length() (int, bool) {
+	n := sr.count()
+	if n == 0 || sr.err != nil {
+		return 0, true
+	}
+	return n - 1, false
+}
+
+// Function to read the positions of the neighbours of a vertex and their weights, which are nil if the map was nil
+func (sr *snapshotReader) neighbours() ([]int, []int, bool) {
+	count, isNil := sr.length()
+	var neighbours, weights []int
+	for j := 0; j < count && sr.err == nil; j++ {
+		neighbours = append(neighbours, sr.count())
+		weights = append(weights, int(sr.varint()))
+	}
+	return neighbours, weights, isNil
+}
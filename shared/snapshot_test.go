@@ -0,0 +1,148 @@
+package shared
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Function to build a small graph that uses every part of the snapshot format: nil and empty maps, votes,
+// self-loops, sent weights and a sliding window
+func snapshotTestGraph() *Graph {
+	return &Graph{
+		NumberOfShards: 3,
+		ShardWorkloads: []int{4, 0, 7},
+		Vertices: map[string]*Vertex{
+			"a": {ID: "a", Label: 0, LabelUpdateCounter: 2, NewLabel: 1,
+				LabelVotes: map[int]float64{0: 0.25, 2: math.Pi},
+				Edges:      map[string]int{"a": 2, "b": 3},
+				Sent:       map[string]int{"a": 2, "b": 1}},
+			"b": {ID: "b", Label: 2, NewLabel: -1,
+				LabelVotes: map[int]float64{},
+				Edges:      map[string]int{"a": 3},
+				Sent:       map[string]int{"a": 2}},
+			"c": {ID: "c", Label: 1, Edges: map[string]int{}, Sent: map[string]int{}},
+		},
+		Window: &EdgeWindow{Size: 2, Epochs: []map[EdgeKey]int{
+			{{From: "a", To: "b"}: 1, {From: "a", To: "a"}: 2},
+			{{From: "b", To: "a"}: 2},
+		}},
+	}
+}
+
+// Saving and loading a graph gives back the same graph, in every version of the format, where version 1 leaves out
+// the sent weights and the sliding window
+func TestSnapshotRoundTrip(t *testing.T) {
+
+	for version := uint64(1); version <= snapshotVersion; version++ {
+		graph := snapshotTestGraph()
+
+		var buf bytes.Buffer
+		if err := writeGraphVersion(&buf, graph, version); err != nil {
+			t.Fatalf("Version %d: failed to write graph: %v", version, err)
+		}
+		loaded, err := ReadGraph(&buf)
+		if err != nil {
+			t.Fatalf("Version %d: failed to read graph: %v", version, err)
+		}
+
+		expected := snapshotTestGraph()
+		if version < 2 {
+			for _, vertex := range expected.Vertices {
+				vertex.Sent = nil
+			}
+			expected.Window = nil
+		}
+		if !reflect.DeepEqual(loaded, expected) {
+			t.Fatalf("Version %d: loaded graph differs from the saved one:\n  saved:  %+v\n  loaded: %+v", version,
+				expected, loaded)
+		}
+	}
+}
+
+// Saving a graph to a file and loading it back gives the same graph, whether it is compressed or not
+func TestSaveLoadGraph(t *testing.T) {
+
+	for _, compress := range []bool{false, true} {
+		path := filepath.Join(t.TempDir(), "graph.snapshot")
+		if err := SaveGraph(path, snapshotTestGraph(), compress); err != nil {
+			t.Fatalf("Compress %v: failed to save graph: %v", compress, err)
+		}
+		loaded, err := LoadGraph(path)
+		if err != nil {
+			t.Fatalf("Compress %v: failed to load graph: %v", compress, err)
+		}
+		if !reflect.DeepEqual(loaded, snapshotTestGraph()) {
+			t.Fatalf("Compress %v: loaded graph differs from the saved one", compress)
+		}
+	}
+}
+
+// Corrupt snapshots are rejected with an error, instead of panicking or allocating what the input cannot hold
+func TestReadGraphCorrupt(t *testing.T) {
+
+	var valid bytes.Buffer
+	if err := WriteGraph(&valid, snapshotTestGraph()); err != nil {
+		t.Fatalf("Failed to write graph: %v", err)
+	}
+
+	// Function to build the start of a version 2 snapshot, followed by the given varints
+	header := func(values ...uint64) []byte {
+		b := append([]byte(snapshotMagic), 2)
+		for _, value := range values {
+			b = binary.AppendUvarint(b, value)
+		}
+		return b
+	}
+
+	cases := []struct {
+		name  string
+		input []byte
+	}{
+		{"empty", nil},
+		{"bad magic", []byte("NOTAGRPH\x02")},
+		{"unsupported version", append([]byte(snapshotMagic), 9)},
+		{"negative shards", header(1)}, // The varint 1 is -1
+		{"huge workloads", header(6, 1<<62)},
+		{"huge vertices", header(6, 0, 1<<62)},
+		{"many vertices", header(6, 0, 1<<30)},
+		{"negative neighbour", header(6, 0, 1, 1, 'a', 0, 0, 0, 0, 2, math.MaxUint64, 2, 0, 0)},
+		{"neighbour out of range", header(6, 0, 1, 1, 'a', 0, 0, 0, 0, 2, 5, 2, 0, 0)},
+		{"huge votes", header(6, 0, 1, 1, 'a', 0, 0, 0, 1<<62)},
+		{"huge window", header(6, 0, 0, 1<<62)},
+		{"huge window epoch", header(6, 0, 0, 2, 2, 1<<62)},
+		{"zero window size", header(6, 0, 0, 1, 0)},
+		{"negative window size", header(6, 0, 0, 1, 1)},
+		{"more window epochs than size", header(6, 0, 0, 3, 2, 0, 0)},
+		{"negative window transactions", header(6, 0, 1, 1, 'a', 0, 0, 0, 0, 0, 0, 2, 2, 1, 0, 0, 1)},
+		{"zero window transactions", header(6, 0, 1, 1, 'a', 0, 0, 0, 0, 0, 0, 2, 2, 1, 0, 0, 0)},
+	}
+	for i := 1; i < valid.Len(); i += 7 {
+		cases = append(cases, struct {
+			name  string
+			input []byte
+		}{"truncated", valid.Bytes()[:i]})
+	}
+
+	for _, c := range cases {
+		graph, err := ReadGraph(bytes.NewReader(c.input))
+		if err == nil {
+			t.Errorf("%s (%d bytes): expected an error, but read %+v", c.name, len(c.input), graph)
+		}
+	}
+}
+
+// A window that holds more epochs than its size, once it is made smaller and before the next epoch drops the extra
+// epochs, cannot be saved, since it could not be loaded back
+func TestWriteGraphRejectsOverfullWindow(t *testing.T) {
+
+	graph := snapshotTestGraph()
+	graph.SetEdgeWindow(1)
+
+	if err := WriteGraph(&bytes.Buffer{}, graph); err == nil {
+		t.Fatalf("Wrote a window of size %d holding %d epochs", graph.Window.Size, len(graph.Window.Epochs))
+	}
+}
@@ -0,0 +1,36 @@
+package shared
+
+// Function to take a copy of the labels of all vertices in the graph
+// Used to measure how stable the allocation is from one epoch to the next
+func SnapshotLabels(graph *Graph) map[string]int {
+
+	labels := make(map[string]int, len(graph.Vertices))
+	for id, vertex := range graph.Vertices {
+		labels[id] = vertex.Label
+	}
+
+	return labels
+}
+
+// Function that counts how many of the vertices in the snapshot are now in a different shard
+// It returns the number of vertices that moved, and the number of vertices that were compared
+func CountMovedVertices(before map[string]int, graph *Graph) (int, int) {
+
+	moved, compared := 0, 0
+
+	for id, label := range before {
+
+		// Vertices which are no longer in the graph cannot be compared
+		vertex, exists := graph.Vertices[id]
+		if !exists {
+			continue
+		}
+
+		compared++
+		if vertex.Label != label {
+			moved++
+		}
+	}
+
+	return moved, compared
+}
@@ -0,0 +1,132 @@
+package shared
+
+import "math"
+
+/*
+Stopping rules decide when the CLPA is taken to have converged.
+
+Originally, the CLPA converges only once not a single vertex changes its label in an iteration. On large epochs, a few
+vertices can keep moving back and forth between shards, so that the CLPA never converges. The rules below can be
+turned on to stop earlier, and whichever fires first is recorded in the results:
+- MovedFraction: the fraction of the vertices that changed their label in an iteration falls below ε
+- Plateau: the best fitness has not improved by more than a relative tolerance over the last N iterations
+- Oscillation: every vertex that changed its label went back to a label it had in the last W iterations
+
+No rule can fire before MinIterations iterations have run, including the original rule that no label changed.
+Runners that carry on for all iterations irrespective of convergence (as in the paper) only record the first rule
+that fired, and the iteration it fired in.
+*/
+
+// The reasons the CLPA can stop for, recorded in the results
+// An empty reason means that no rule fired within the iterations
+const (
+	StopConverged     = "converged"      // Not a single label changed in an iteration
+	StopMovedFraction = "moved-fraction" // The fraction of vertices that changed their label fell below ε
+	StopPlateau       = "plateau"        // The best fitness did not improve enough over a number of iterations
+	StopOscillation   = "oscillation"    // The only vertices that changed their label went back to a recent label
+)
+
+// Struct to hold the stopping rules of the CLPA, where the zero value only stops once no label changes
+type StoppingRules struct {
+	MinIterations     int     // Number of iterations run before any rule can fire
+	MovedFraction     float64 // ε, the fraction of moved vertices below which the CLPA stops, 0 means off
+	PlateauIterations int     // Number of iterations without enough improvement of the best fitness, 0 means off
+	PlateauTolerance  float64 // Relative improvement of the best fitness that counts as enough for the plateau rule
+	OscillationWindow int     // Number of past labels of a vertex it can go back to and be oscillating, 0 means off
+}
+
+// Function to return the stopping rules of the paper, where the CLPA stops once no label changes
+func DefaultStoppingRules() StoppingRules {
+	return StoppingRules{}
+}
+
+// Struct to keep track of the labels and fitness of the iterations of a CLPA run, to find when a stopping rule fires
+type ConvergenceMonitor struct {
+	rules       StoppingRules
+	iterations  int     // Number of iterations observed so far
+	labels      []int   // Labels after the last iteration observed
+	history     [][]int // Labels after the previous iterations, newest first, kept only for the oscillation rule
+	bestFitness float64 // Best fitness at the last improvement that counted, kept only for the plateau rule
+	improvedAt  int     // Iteration in which the best fitness last improved by more than the tolerance
+}
+
+// Function to start keeping track of a CLPA run, given the labels of the vertices before the first iteration
+// The labels are copied, so the slice can keep being changed by the CLPA
+func (rules StoppingRules) NewMonitor(labels []int) *ConvergenceMonitor {
+	return &ConvergenceMonitor{
+		rules:       rules,
+		labels:      append([]int(nil), labels...),
+		bestFitness: math.Inf(1),
+	}
+}
+
+// Function to find whether the fitness of each iteration is needed, which is only the case for the plateau rule
+func (monitor *ConvergenceMonitor) NeedsFitness() bool {
+	return monitor.rules.PlateauIterations > 0
+}
+
+/*
+Function to record the labels (in the same order of vertices as before) and fitness after an iteration, and return
+the stopping rule that fired, or an empty string if the CLPA should carry on
+
+The fitness is only used by the plateau rule, so any value can be passed if NeedsFitness is false.
+*/
+func (monitor *ConvergenceMonitor) Observe(labels []int, fitness float64) string {
+
+	rules := monitor.rules
+	monitor.iterations++
+
+	// Count the vertices that changed their label, and the ones among them that went back to a recent label
+	moved, oscillating := 0, 0
+	for v, label := range labels {
+		if monitor.labels[v] == label {
+			continue
+		}
+		moved++
+		if rules.OscillationWindow > 0 {
+			for _, past := range monitor.history {
+				if past[v] == label {
+					oscillating++
+					break
+				}
+			}
+		}
+	}
+
+	// Keep the labels of the last iterations for the oscillation rule, reusing the oldest slice once it falls out
+	if rules.OscillationWindow > 0 {
+		var previous []int
+		if len(monitor.history) >= rules.OscillationWindow {
+			previous = monitor.history[len(monitor.history)-1]
+			monitor.history = monitor.history[:len(monitor.history)-1]
+		}
+		previous = append(previous[:0], monitor.labels...)
+		monitor.history = append([][]int{previous}, monitor.history...)
+	}
+	monitor.labels = append(monitor.labels[:0], labels...)
+
+	// Keep track of when the best fitness last improved by more than the tolerance
+	// Small improvements add up, since they are measured from the best fitness at the last improvement that counted
+	if rules.PlateauIterations > 0 && (math.IsInf(monitor.bestFitness, 1) ||
+		monitor.bestFitness-fitness > rules.PlateauTolerance*math.Abs(monitor.bestFitness)) {
+		monitor.bestFitness = fitness
+		monitor.improvedAt = monitor.iterations
+	}
+
+	if monitor.iterations < rules.MinIterations {
+		return ""
+	}
+
+	switch {
+	case moved == 0:
+		return StopConverged
+	case rules.MovedFraction > 0 && float64(moved) < rules.MovedFraction*float64(len(labels)):
+		return StopMovedFraction
+	case rules.OscillationWindow > 0 && oscillating == moved:
+		return StopOscillation
+	case rules.PlateauIterations > 0 && monitor.iterations-monitor.improvedAt >= rules.PlateauIterations:
+		return StopPlateau
+	}
+
+	return ""
+}
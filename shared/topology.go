@@ -0,0 +1,220 @@
+package shared
+
+import (
+	"sort"
+	"unsafe"
+)
+
+// Struct to hold an edge of a vertex in the shared topology
+type Neighbour struct {
+	Index  int // Index of the neighbouring vertex in the topology
+	Weight int // Weight of the edge
+	Sent   int // Part of the weight of the edge sent by the vertex to the neighbour
+}
+
+/*
+Topology is the part of a graph that stays the same for every seed within an epoch: the vertices and their edges.
+It is built once per epoch and shared by all seeds, each of which only keeps its own LabelState.
+Vertices are sorted by ID, so a vertex is referred to by its index, and the neighbours of a vertex are sorted
+by index as well.
+*/
+type Topology struct {
+	Vertices       []*Vertex       // The vertices of the graph, sorted by ID
+	Index          map[string]int  // Map of vertex ID to the index of the vertex
+	Neighbours     [][]Neighbour   // Edges of each vertex, with neighbours referred to by index
+	NumberOfShards int             // Total number of shards
+	CostModel      CostModel       // The cost model of the graph, never nil
+	Placement      PlacementPolicy // The placement policy of the graph, nil means a random shard
+	graph          *Graph          // The graph the topology was built from
+}
+
+// LabelState is the part of a graph that differs between seeds, indexed in the same way as the topology
+type LabelState struct {
+	Labels             []int             // Current shard ID of each vertex
+	LabelUpdateCounter []int             // Number of times each vertex has updated its label
+	LabelVotes         []map[int]float64 // Used for memory voting mechanism, nil if the variant does not vote
+	ShardWorkloads     []int             // Current workloads of shards
+	VoteHistory        [][]int           // Shards each vertex voted for in the last iterations, nil without a vote window
+	NeighbourWeights   [][]int           // Weight of the edges of each vertex to each shard, nil outside of the CLPA
+	Checker            *InvariantChecker // Invariant checks of the CLPA, nil outside of the CLPA or if they are off
+}
+
+// Function to build the shared topology of a graph
+// The graph must not be changed while the topology is in use, except through Apply
+func NewTopology(graph *Graph) *Topology {
+
+	// Sort the vertex IDs, so that the index of a vertex does not depend on the order of the map
+	ids := make([]string, 0, len(graph.Vertices))
+	for id := range graph.Vertices {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	topology := &Topology{
+		Vertices:       make([]*Vertex, len(ids)),
+		Index:          make(map[string]int, len(ids)),
+		Neighbours:     make([][]Neighbour, len(ids)),
+		NumberOfShards: graph.NumberOfShards,
+		CostModel:      graph.WorkloadCostModel(),
+		Placement:      graph.Placement,
+		graph:          graph,
+	}
+
+	for i, id := range ids {
+		topology.Vertices[i] = graph.Vertices[id]
+		topology.Index[id] = i
+	}
+
+	// Convert the edge maps to slices of neighbours, sorted by index
+	for i, vertex := range topology.Vertices {
+		neighbours := make([]Neighbour, 0, len(vertex.Edges))
+		for neighbourID, weight := range vertex.Edges {
+			neighbours = append(neighbours, Neighbour{
+				Index:  topology.Index[neighbourID],
+				Weight: weight,
+				Sent:   vertex.Sent[neighbourID],
+			})
+		}
+		sort.Slice(neighbours, func(a, b int) bool {
+			return neighbours[a].Index < neighbours[b].Index
+		})
+		topology.Neighbours[i] = neighbours
+	}
+
+	return topology
+}
+
+// Function to create the label state of a seed, starting from the labels of the graph the topology was built from
+func (t *Topology) NewLabelState() *LabelState {
+
+	state := &LabelState{
+		Labels:             make([]int, len(t.Vertices)),
+		LabelUpdateCounter: make([]int, len(t.Vertices)),
+	}
+
+	for i, vertex := range t.Vertices {
+		state.Labels[i] = vertex.Label
+		state.LabelUpdateCounter[i] = vertex.LabelUpdateCounter
+	}
+
+	return state
+}
+
+// Function that estimates the number of bytes taken up by the label state of a seed
+// If withVotes is true, the estimate includes a small vote map for each vertex
+func (t *Topology) EstimateStateSize(withVotes bool) int64 {
+
+	// The labels and update counters, and the cached weight of the edges to each shard while the CLPA runs
+	perVertex := 2*int64(unsafe.Sizeof(0)) + int64(unsafe.Sizeof([]int(nil))) +
+		int64(t.NumberOfShards)*int64(unsafe.Sizeof(0))
+	if withVotes {
+		// A map header plus a single bucket holding a few votes
+		perVertex += int64(unsafe.Sizeof(map[int]float64{})) + 160
+	}
+
+	return int64(len(t.Vertices))*perVertex + int64(t.NumberOfShards)*int64(unsafe.Sizeof(0))
+}
+
+/*
+Function to work out from scratch the weight of the edges of each vertex to each shard (a self-loop counts towards
+the shard of the vertex itself)
+
+The weights are kept up to date as vertices move during the CLPA, so that the score of a shard can be looked up in
+O(1) instead of scanning all the edges of the vertex for every shard. Since the edges are symmetric, moving a vertex
+only changes the weights of its neighbours.
+*/
+func (t *Topology) CalculateNeighbourWeights(state *LabelState) [][]int {
+
+	// The weights of all vertices are kept in a single slice, so that they sit next to each other in memory
+	backing := make([]int, len(t.Vertices)*t.NumberOfShards)
+	weights := make([][]int, len(t.Vertices))
+
+	for v, neighbours := range t.Neighbours {
+		start, end := v*t.NumberOfShards, (v+1)*t.NumberOfShards
+		weights[v] = backing[start:end:end]
+		for _, neighbour := range neighbours {
+			weights[v][state.Labels[neighbour.Index]] += neighbour.Weight
+		}
+	}
+
+	return weights
+}
+
+/*
+Function that writes the label state of a seed into the vertices of the graph the topology was built from,
+and returns that graph. This is used to turn the label state of the winning seed into a whole graph,
+without having to copy the graph.
+*/
+func (t *Topology) Apply(state *LabelState) *Graph {
+
+	for i, vertex := range t.Vertices {
+		vertex.Label = state.Labels[i]
+		vertex.LabelUpdateCounter = state.LabelUpdateCounter[i]
+		if state.LabelVotes != nil {
+			vertex.LabelVotes = state.LabelVotes[i]
+		}
+	}
+
+	t.graph.ShardWorkloads = state.ShardWorkloads
+
+	return t.graph
+}
+
+// Function to calculate from scratch the workload of each shard, according to the cost model of the topology
+// As for a graph, only the transactions between vertices that have a shard are counted
+func (t *Topology) CalculateShardWorkloads(state *LabelState) []int {
+
+	workloads := make([]int, t.NumberOfShards)
+
+	for v, neighbours := range t.Neighbours { // Iterate through all vertices
+		label := state.Labels[v]
+		if label < 0 {
+			continue
+		}
+		for _, neighbour := range neighbours { // Iterate through all neighbours
+
+			// Process undirected edge only once to avoid double counting (a self-loop is only stored once)
+			neighbourLabel := state.Labels[neighbour.Index]
+			if neighbourLabel < 0 || neighbour.Index < v {
+				continue
+			}
+
+			own, other := t.CostModel.EdgeCost(neighbour.Sent, neighbour.Weight-neighbour.Sent,
+				label == neighbourLabel)
+			workloads[label] += own
+			workloads[neighbourLabel] += other
+		}
+	}
+	return workloads
+}
+
+// Returns the total cross shard workload of a label state, which is the total weight of edges crossing shard boundaries
+func (t *Topology) calculateCrossShardWorkload(state *LabelState) int {
+	crossShardWorkload := 0
+
+	for v, neighbours := range t.Neighbours {
+		for _, neighbour := range neighbours {
+
+			// Only process each edge once (to avoid double counting)
+			if neighbour.Index > v && state.Labels[neighbour.Index] != state.Labels[v] {
+				crossShardWorkload += neighbour.Weight
+			}
+		}
+	}
+
+	return crossShardWorkload
+}
+
+// Returns the main metrics of a label state: workload imbalance, cross-shard workload, and combined fitness score
+func (t *Topology) CalculateFitness(state *LabelState, alpha float64) (float64, int, float64) {
+	// Calculate workload imbalance
+	workloadImbalance := calculateWorkloadImbalance(state.ShardWorkloads)
+
+	// Calculate cross-shard workload
+	crossShardWorkload := t.calculateCrossShardWorkload(state)
+
+	// Compute fitness
+	fitness := alpha*float64(crossShardWorkload) + (1-alpha)*workloadImbalance
+
+	return workloadImbalance, crossShardWorkload, fitness
+}
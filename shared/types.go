@@ -2,12 +2,13 @@ package shared
 
 // The Vertex struct represents an account
 type Vertex struct {
-	ID                 string         // Address of the vertex used as unique identifier
-	Label              int            // Current shard ID of where the vertex resides
-	Edges              map[string]int // Map of neighbour vertex IDs to edge weights
-	LabelUpdateCounter int            // Number of times the vertex has updated its label
-	NewLabel           int            // Used only for synchronous updating mode
-	LabelVotes         map[int]int    // Map used for memory voting mechanism
+	ID                 string          // Address of the vertex used as unique identifier
+	Label              int             // Current shard ID of where the vertex resides
+	Edges              map[string]int  // Map of neighbour vertex IDs to edge weights
+	Sent               map[string]int  // Map of neighbour vertex IDs to the part of the edge weight sent by this vertex
+	LabelUpdateCounter int             // Number of times the vertex has updated its label
+	NewLabel           int             // Used only for synchronous updating mode
+	LabelVotes         map[int]float64 // Map used for memory voting mechanism
 }
 
 // The Graph struct
@@ -15,6 +16,13 @@ type Graph struct {
 	Vertices       map[string]*Vertex // Map of vertex ID to Vertex struct
 	NumberOfShards int                // Total number of shards
 	ShardWorkloads []int              // Current workloads of shards
+	CostModel      CostModel          // How transactions add to the workloads of shards, nil means PaperCostModel
+	Window         *EdgeWindow        // Sliding window of the epochs whose edges are kept, nil means only the current epoch
+	Placement      PlacementPolicy    // How new vertices are given their first shard, nil means a random shard
+	Checker        *InvariantChecker  // Invariant checks of the CLPA, nil outside of the CLPA or if they are off
+
+	// Level of the invariant checks started by the CLPA of the paper on this graph, kept for the following epochs
+	InvariantChecks InvariantCheckLevel
 }
 
 // Struct to hold results of a single epoch
@@ -23,8 +31,18 @@ type EpochResult struct {
 	Fitness            float64 // The fitness score
 	WorkloadImbalance  float64
 	CrossShardWorkload int
-	ConvergenceIter    int // -1 means no convergence, else set to the iteration number of convergence
+	ConvergenceIter    int      // -1 means no convergence, else set to the iteration number of convergence
+	StopReason         string   // The stopping rule that fired in the convergence iteration, empty if none did
+	InitialFitness     float64  // The fitness after the new vertices are placed, before the first iteration
+	FirstIterFitness   float64  // The fitness after the first iteration, or the initial fitness if none was run
+	Interrupted        bool     // true if the allocation was cut short by cancellation or a deadline
+	Pruned             bool     // true if the seed was abandoned during seed racing
+	Consensus          bool     // true if the result is the consensus of the seeds rather than a seed, its Seed is -1
+	VotePolicy         string   // Description of the vote policy used (only by mylpa), empty for the other variants
+	Metrics            *Metrics // Further metrics of the partitioning, beyond the fitness
 	Graph              *Graph
+	State              *LabelState     // Labels of a seed run on a shared topology, used instead of Graph
+	Topology           *Topology       // The shared topology the State belongs to
 	IterationsInfo     *IterationsInfo // Used only in convergence test
 }
 
@@ -33,3 +51,60 @@ type IterationsInfo struct {
 	LabelChanged []bool    // indicates whether any label changed during an iteration
 	Fitness      []float64 // the fitness of the partitioning in an iteration
 }
+
+// Struct to hold the optional settings of a shard allocation that runs multiple seeds
+// The zero value runs every seed in its own goroutine at the same time, without any limit
+type AllocationConfig struct {
+	MaxWorkers   int       // Maximum number of seeds run at the same time, 0 means no limit
+	MemoryBudget int64     // Maximum number of bytes to be taken up by per-seed copies at once, 0 means no limit
+	Race         *SeedRace // Coordinator used to abandon seeds that fall behind, nil means no seed racing
+
+	// Settings of the vote memory carried over between epochs (used only by mylpa)
+	// nil means that the votes of every vertex start afresh in each epoch
+	VoteMemory *VoteMemoryConfig
+
+	// How transactions add to the workloads of shards, which is kept in the graph for the following epochs
+	// nil keeps the cost model of the graph (PaperCostModel for a new graph)
+	CostModel CostModel
+
+	// Number of epochs whose edges are kept in the graph as a sliding window, which is kept for the following epochs
+	// 0 keeps the window of the graph (only the edges of the current epoch for a new graph)
+	EdgeWindow int
+
+	// How new vertices are given their first shard, which is kept in the graph for the following epochs
+	// nil keeps the placement policy of the graph (a random shard for a new graph)
+	Placement PlacementPolicy
+
+	// Settings of the consensus allocation built from all the seeds, which is picked instead of the best seed
+	// nil means that the seed with the best fitness is picked. The label states of all seeds are kept until the
+	// consensus is built, so a memory budget only limits how many seeds run at once.
+	Consensus *ConsensusConfig
+
+	// Temperature schedule of the simulated annealing used to pick the shard each vertex votes for (used only by mylpa)
+	// nil means that each vertex always votes for the shard with the highest score
+	Annealing *AnnealingSchedule
+
+	// Vote policy deciding how the votes of a vertex add up and when it moves (used only by mylpa)
+	// nil means the policy of the original My LPA, where a shard needs one more vote than the current one
+	VotePolicy *VotePolicy
+
+	// Rules deciding when the CLPA has converged, and the iterations stop (in mylpa) or only the iteration is recorded
+	// nil means that it converges once no label changes
+	// mylpa always runs at least 5 iterations before checking convergence, unless MinIterations is set
+	Stopping *StoppingRules
+
+	// If true, the score of each shard is worked out by scanning the edges of the vertex, instead of looking up the
+	// cached weight of its edges to the shard (used only by mylpa and clpaparallel)
+	// The results are the same either way, so this is only used to measure how much faster the cache is
+	NoNeighbourWeightCache bool
+
+	// Level of the invariant checks of the bookkeeping of the CLPA, which is only meant to be set for debugging
+	// The checks are off by default (NoInvariantChecks). paperclpa keeps the level in the graph made by NewGraph
+	InvariantChecks InvariantCheckLevel
+}
+
+// Struct to hold the settings of the vote memory that is carried over from one epoch to the next
+type VoteMemoryConfig struct {
+	Decay    float64 // Factor the carried over votes are multiplied by at the start of each epoch
+	MaxVotes float64 // Maximum number of votes a single shard can carry over, 0 means no cap
+}
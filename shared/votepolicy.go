@@ -0,0 +1,123 @@
+package shared
+
+import (
+	"fmt"
+	"strings"
+)
+
+/*
+A vote policy decides how the votes that a vertex casts for shards in My LPA add up, and when the vertex moves.
+
+In every iteration, a vertex votes for the shard with the best score, and it moves to the shard with the most votes
+once that shard is far enough ahead of its current shard. The policy can change this in a few ways, which can be
+combined:
+- Margin: the number of votes the winning shard needs over the current shard (1 in the original My LPA)
+- MajorityFraction: the winning shard needs this fraction of all the votes of the vertex instead of a margin
+- Window: only the votes cast in the last W iterations count, so older votes are taken away again
+- Decay: all the votes of a vertex are multiplied by this factor every iteration, so older votes count for less
+
+Without a window or decay, the votes of a vertex grow without bound within an epoch, so the longer the CLPA runs,
+the harder it gets for a vertex to move. The votes given to a vertex before the CLPA starts (its initial self-vote or
+the votes carried over from the previous epoch) are not part of the window, but they do decay.
+*/
+
+// Struct to hold the settings of the vote policy of My LPA
+type VotePolicy struct {
+	Margin           float64 // Votes the winning shard needs over the current shard, used if there is no majority fraction
+	MajorityFraction float64 // Fraction of all votes the winning shard needs, 0 means that the margin is used instead
+	Window           int     // Number of iterations whose votes count, 0 means that all votes count
+	Decay            float64 // Factor the votes are multiplied by every iteration, 0 means no decay (the same as 1)
+}
+
+// Function to return the vote policy of the original My LPA, where a shard needs one more vote than the current one
+func DefaultVotePolicy() VotePolicy {
+	return VotePolicy{Margin: 1}
+}
+
+// Function to describe the vote policy, which is recorded in the results
+func (policy VotePolicy) String() string {
+
+	var parts []string
+	if policy.MajorityFraction > 0 {
+		parts = append(parts, fmt.Sprintf("majority=%g", policy.MajorityFraction))
+	} else {
+		parts = append(parts, fmt.Sprintf("margin=%g", policy.Margin))
+	}
+	if policy.Window > 0 {
+		parts = append(parts, fmt.Sprintf("window=%d", policy.Window))
+	}
+	if policy.Decay > 0 && policy.Decay != 1 {
+		parts = append(parts, fmt.Sprintf("decay=%g", policy.Decay))
+	}
+
+	return strings.Join(parts, ";")
+}
+
+// Smallest number of votes a shard can have, below which its votes are removed
+const minVotes = 1e-9
+
+/*
+Function to add the vote of a vertex for a shard to its votes, in the iteration the vertex is visited in
+
+The history holds the shards the vertex voted for in the last iterations, oldest first, and is only needed if the
+policy has a window. Since a vertex is visited once every iteration, the votes are decayed once per visit.
+*/
+func (policy VotePolicy) CastVote(votes map[int]float64, history *[]int, shard int) {
+
+	decays := policy.Decay > 0 && policy.Decay != 1
+
+	// Older votes count for less than the vote of this iteration
+	if decays {
+		for s, count := range votes {
+			votes[s] = count * policy.Decay
+		}
+	}
+
+	// Take away the vote that falls out of the window, which has decayed once for every iteration since it was cast
+	if policy.Window > 0 && len(*history) >= policy.Window {
+		oldest := (*history)[0]
+		*history = append((*history)[:0], (*history)[1:]...)
+
+		value := 1.0
+		if decays {
+			for i := 0; i < policy.Window; i++ {
+				value *= policy.Decay
+			}
+		}
+		votes[oldest] -= value
+		if votes[oldest] < minVotes {
+			delete(votes, oldest)
+		}
+	}
+
+	votes[shard]++
+	if policy.Window > 0 {
+		*history = append(*history, shard)
+	}
+}
+
+// Function to find whether a vertex in the current shard should move, given its votes
+// It returns the shard with the most votes, and whether it is far enough ahead for the vertex to move to it
+func (policy VotePolicy) Winner(votes map[int]float64, currentShard int) (int, bool) {
+
+	// Find the label with the most votes
+	winningShard, maxVotes := currentShard, votes[currentShard]
+	totalVotes := 0.0
+	for shard, count := range votes {
+		totalVotes += count
+		if count > maxVotes {
+			winningShard = shard
+			maxVotes = count
+		}
+	}
+
+	if winningShard == currentShard {
+		return winningShard, false
+	}
+
+	// The winning shard either needs a majority of all the votes, or enough of a margin over the current shard
+	if policy.MajorityFraction > 0 {
+		return winningShard, maxVotes >= policy.MajorityFraction*totalVotes
+	}
+	return winningShard, maxVotes-votes[currentShard] >= policy.Margin
+}
@@ -0,0 +1,78 @@
+package shared
+
+import (
+	"maps"
+	"slices"
+	"testing"
+)
+
+// Function to cast the votes for the shards one after the other, starting from the votes given
+func castVotes(policy VotePolicy, votes map[int]float64, shards ...int) []int {
+	var history []int
+	for _, shard := range shards {
+		policy.CastVote(votes, &history, shard)
+	}
+	return history
+}
+
+// The votes add up without a window or decay, and a vote is taken away once it falls out of the window
+func TestCastVoteWindow(t *testing.T) {
+
+	votes := map[int]float64{}
+	castVotes(DefaultVotePolicy(), votes, 0, 1, 1, 0, 1)
+	if expected := map[int]float64{0: 2, 1: 3}; !maps.Equal(votes, expected) {
+		t.Errorf("Votes without a window are %v, expected %v", votes, expected)
+	}
+
+	// The vote for shard 0 falls out of a window of 2 iterations, and the shard is removed from the votes
+	votes = map[int]float64{}
+	history := castVotes(VotePolicy{Margin: 1, Window: 2}, votes, 0, 1, 1)
+	if expected := map[int]float64{1: 2}; !maps.Equal(votes, expected) || !slices.Equal(history, []int{1, 1}) {
+		t.Errorf("Votes with a window are %v with history %v, expected %v with history [1 1]", votes, history,
+			expected)
+	}
+}
+
+// With a window and decay, the vote taken away has decayed as much as the votes still counted, and the initial vote
+// of the vertex only decays
+func TestCastVoteWindowWithDecay(t *testing.T) {
+
+	// The initial vote for shard 2 halves with each vote: 1, 0.5, 0.25, 0.125
+	// The vote for shard 0 is cast first (1), halves twice (0.25) and is then taken away by its decayed value
+	votes := map[int]float64{2: 1}
+	history := castVotes(VotePolicy{Margin: 1, Window: 2, Decay: 0.5}, votes, 0, 1, 1)
+
+	if expected := map[int]float64{1: 1.5, 2: 0.125}; !maps.Equal(votes, expected) ||
+		!slices.Equal(history, []int{1, 1}) {
+		t.Errorf("Votes are %v with history %v, expected %v with history [1 1]", votes, history, expected)
+	}
+}
+
+// The winning shard needs a margin over the current shard, or a fraction of all the votes if one is set
+func TestVotePolicyWinner(t *testing.T) {
+
+	cases := []struct {
+		name         string
+		policy       VotePolicy
+		votes        map[int]float64
+		currentShard int
+		winner       int
+		move         bool
+	}{
+		{"margin reached", VotePolicy{Margin: 1}, map[int]float64{0: 2, 1: 3}, 0, 1, true},
+		{"margin not reached", VotePolicy{Margin: 2}, map[int]float64{0: 2, 1: 3}, 0, 1, false},
+		{"current shard wins", VotePolicy{Margin: 1}, map[int]float64{0: 3, 1: 2}, 0, 0, false},
+		{"current shard ties", VotePolicy{Margin: 0}, map[int]float64{0: 3, 1: 3}, 0, 0, false},
+		{"majority reached", VotePolicy{MajorityFraction: 0.5}, map[int]float64{0: 1, 1: 2, 2: 1}, 0, 1, true},
+		{"majority not reached", VotePolicy{MajorityFraction: 0.6}, map[int]float64{0: 1, 1: 2, 2: 1}, 0, 1, false},
+		{"majority instead of margin", VotePolicy{Margin: 10, MajorityFraction: 0.5},
+			map[int]float64{0: 1, 1: 2, 2: 1}, 0, 1, true},
+		{"no votes for current shard", VotePolicy{MajorityFraction: 0.9}, map[int]float64{1: 1}, 0, 1, true},
+	}
+
+	for _, c := range cases {
+		if winner, move := c.policy.Winner(c.votes, c.currentShard); winner != c.winner || move != c.move {
+			t.Errorf("%s: got shard %d and move %v, expected %d and %v", c.name, winner, move, c.winner, c.move)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package shared
+
+/*
+A sliding window keeps the edges of the last few epochs in the graph, instead of only the edges of the current epoch.
+This gives the CLPA a view of which accounts transact together that is bounded by how recent the transactions are.
+
+The transactions of each epoch in the window are recorded, so that when an epoch falls out of the window its edges
+are subtracted exactly from the graph, and the edges left are the sum of the epochs still in the window.
+*/
+
+// Struct to identify the transactions sent from one account to another
+type EdgeKey struct {
+	From string
+	To   string
+}
+
+// The EdgeWindow struct holds the transactions of the epochs in the sliding window of a graph
+type EdgeWindow struct {
+	Size   int               // Number of epochs whose edges are kept in the graph
+	Epochs []map[EdgeKey]int // Number of transactions of each epoch in the window, from the oldest to the newest
+}
+
+// Function to create a sliding window that keeps the edges of the given number of epochs
+func NewEdgeWindow(size int) *EdgeWindow {
+	return &EdgeWindow{Size: max(size, 1)}
+}
+
+// Function to set the number of epochs whose edges are kept in the graph, adding a sliding window if it has none
+// If the window is made smaller, the extra epochs are dropped at the start of the next epoch
+func (graph *Graph) SetEdgeWindow(size int) {
+	if graph.Window == nil {
+		graph.Window = NewEdgeWindow(size)
+		return
+	}
+	graph.Window.Size = max(size, 1)
+}
+
+/*
+Function to start a new epoch in the sliding window of the graph, before the transactions of the epoch are added
+
+The epochs that fall out of the window have their edges subtracted from the graph, and a new epoch is started
+for Record to add to. If no epoch has been recorded yet, then any edges in the graph did not come from the window,
+so they are all cleared, as they would be without a window.
+
+The edge and sent maps of the vertices are replaced rather than changed, so that copies of the graph made
+by DeepCopyGraph, which share these maps, are not affected.
+*/
+func (window *EdgeWindow) StartEpoch(graph *Graph) {
+
+	for _, vertex := range graph.Vertices {
+		if len(window.Epochs) == 0 {
+			vertex.Edges = make(map[string]int)
+			vertex.Sent = make(map[string]int)
+		} else {
+			vertex.Edges = copyWeights(vertex.Edges)
+			vertex.Sent = copyWeights(vertex.Sent)
+		}
+	}
+
+	// Drop the oldest epochs until there is room for the new one
+	for len(window.Epochs) >= window.Size {
+		subtractEdges(graph, window.Epochs[0])
+		window.Epochs[0] = nil
+		window.Epochs = window.Epochs[1:]
+	}
+
+	window.Epochs = append(window.Epochs, make(map[EdgeKey]int))
+}
+
+// Function to record a transaction of the current epoch in the sliding window, once it is added to the graph
+func (window *EdgeWindow) Record(from string, to string) {
+	window.Epochs[len(window.Epochs)-1][EdgeKey{From: from, To: to}]++
+}
+
+// Function to create a copy of the window, which shares the recorded epochs since they are never changed once
+// the next epoch starts
+func (window *EdgeWindow) Copy() *EdgeWindow {
+	if window == nil {
+		return nil
+	}
+	return &EdgeWindow{
+		Size:   window.Size,
+		Epochs: append([]map[EdgeKey]int(nil), window.Epochs...),
+	}
+}
+
+// Function to subtract the transactions of an epoch from the edges of the graph
+// Edges whose weight drops to zero are removed, so that vertices with no edges left become inactive
+func subtractEdges(graph *Graph, transactions map[EdgeKey]int) {
+
+	for edge, count := range transactions {
+
+		// Vertices are never removed from the graph between epochs, but a vertex that is missing has no edges to remove
+		if from, exists := graph.Vertices[edge.From]; exists {
+			subtractWeight(from.Edges, edge.To, count)
+			subtractWeight(from.Sent, edge.To, count)
+		}
+
+		// A self-loop is only stored once
+		if edge.From == edge.To {
+			continue
+		}
+		if to, exists := graph.Vertices[edge.To]; exists {
+			subtractWeight(to.Edges, edge.From, count)
+		}
+	}
+}
+
+// Function to subtract from the weight of an edge, removing the edge if its weight drops to zero
+func subtractWeight(weights map[string]int, neighbourID string, count int) {
+	if weights[neighbourID] <= count {
+		delete(weights, neighbourID)
+	} else {
+		weights[neighbourID] -= count
+	}
+}
+
+// Function to copy a map of neighbour IDs to weights
+func copyWeights(weights map[string]int) map[string]int {
+	copy := make(map[string]int, len(weights))
+	for neighbourID, weight := range weights {
+		copy[neighbourID] = weight
+	}
+	return copy
+}
@@ -0,0 +1,497 @@
+package simulator
+
+import (
+	"container/heap"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+
+	"example.com/shardinglpa/shared"
+)
+
+/*
+The simulator replays the transactions of an epoch against an allocation, to see the throughput and latency a
+sharded chain would have with that allocation, rather than only its fitness.
+
+Each shard has a queue of transactions and produces a block every BlockInterval seconds, which holds at most
+BlockCapacity transactions taken from the front of its queue. A transaction arrives at its timestamp (counted
+from the first transaction of the epoch) in the queue of the shard of its sender.
+
+A transaction between two accounts in the same shard is confirmed once it is in a block of that shard.
+A cross-shard transaction uses a two-phase relay: once it is in a block of the sender's shard, a relay
+transaction arrives in the queue of the receiver's shard after RelayDelay seconds, and the transaction is only
+confirmed once the relay transaction is in a block of the receiver's shard.
+
+The simulation is event-driven: arrivals, relays and blocks are events, processed in order of time.
+*/
+
+// The settings of the simulated chain
+type Config struct {
+	BlockCapacity int     // The maximum number of transactions in a block
+	BlockInterval float64 // The number of seconds between two blocks of a shard
+	RelayDelay    float64 // The number of seconds for a relay transaction to reach the receiver's shard
+
+	// The number of transactions arriving each second, used when the transactions have no timestamp
+	ArrivalRate float64
+
+	// The simulation stops after this many seconds, even if some transactions are still queued (0 means no limit)
+	MaxTime float64
+
+	// The number of shards of the chain, where 0 means the number of shards of the allocation
+	// An allocation loaded from CSV only knows the highest shard in use, so this gives the real number of shards
+	NumberOfShards int
+}
+
+// Function to get settings similar to Ethereum, with 12 second blocks of about 150 transactions per shard
+func DefaultConfig() Config {
+	return Config{
+		BlockCapacity: 150,
+		BlockInterval: 12,
+		RelayDelay:    1,
+		ArrivalRate:   100,
+	}
+}
+
+// Summary of the confirmation latencies of transactions, in seconds
+type LatencyStats struct {
+	Mean float64
+	P50  float64
+	P90  float64
+	P99  float64
+	Max  float64
+}
+
+// The outcome of the simulation for a shard
+type ShardStats struct {
+	Shard int
+
+	IntraShard         int // Transactions with both accounts in this shard
+	CrossShardSent     int // Cross-shard transactions with the sender in this shard
+	CrossShardReceived int // Cross-shard transactions with the receiver in this shard
+
+	Confirmed  int     // Transactions confirmed by a block of this shard (their last phase)
+	Included   int     // Transactions and relay transactions included in the blocks of this shard
+	Throughput float64 // Transactions and relay transactions included per second
+
+	MeanQueueLength float64 // Length of the queue when a block is produced, averaged over the blocks
+	MaxQueueLength  int
+
+	Latency LatencyStats // Latency of the transactions confirmed by this shard
+}
+
+// The outcome of the simulation
+type Result struct {
+	Shards []ShardStats
+
+	Transactions int     // The number of transactions replayed
+	Confirmed    int     // The number of transactions confirmed before the simulation stopped
+	Unallocated  int     // The number of accounts which were not in the allocation
+	Duration     float64 // The number of seconds simulated
+	Throughput   float64 // Transactions confirmed per second, over all shards
+	Latency      LatencyStats
+}
+
+// A transaction being simulated
+type transaction struct {
+	arrival   float64
+	fromShard int
+	toShard   int
+}
+
+// The kinds of events, in the order they are processed when they happen at the same time
+const (
+	arrivalEvent = iota // A transaction arrives in the queue of a shard
+	relayEvent          // A relay transaction arrives in the queue of the receiver's shard
+	blockEvent          // A shard produces a block
+)
+
+type event struct {
+	time  float64
+	kind  int
+	shard int
+	tx    int // The index of the transaction, for arrivals and relays
+	seq   int // Keeps events at the same time and of the same kind in the order they were added
+}
+
+// eventQueue is a min-heap of events ordered by time, then kind, then the order they were added
+type eventQueue []event
+
+func (q eventQueue) Len() int { return len(q) }
+func (q eventQueue) Less(i, j int) bool {
+	if q[i].time != q[j].time {
+		return q[i].time < q[j].time
+	}
+	if q[i].kind != q[j].kind {
+		return q[i].kind < q[j].kind
+	}
+	return q[i].seq < q[j].seq
+}
+func (q eventQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q *eventQueue) Push(x any)   { *q = append(*q, x.(event)) }
+func (q *eventQueue) Pop() any {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
+
+// A queued phase of a transaction, where relay is true for the second phase of a cross-shard transaction
+type queued struct {
+	tx    int
+	relay bool
+}
+
+/*
+Function to replay the transactions in rows against the allocation
+
+The first row is the header, which must have a "from" and a "to" column, and can have a "timestamp" column.
+Accounts which are not in the allocation are put in a shard picked from the hash of the account.
+The allocation is checked first, and an error is returned if any account is in a shard the chain does not have.
+*/
+func Simulate(rows [][]string, allocation *shared.Allocation, config Config) (*Result, error) {
+
+	if config.BlockCapacity <= 0 || config.BlockInterval <= 0 || config.RelayDelay < 0 {
+		return nil, errors.New("block capacity and block interval must be positive, and relay delay not negative")
+	}
+
+	numberOfShards, err := checkAllocation(allocation, config)
+	if err != nil {
+		return nil, err
+	}
+
+	transactions, unallocated, err := readTransactions(rows, allocation, numberOfShards, config)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{
+		Shards:       make([]ShardStats, numberOfShards),
+		Transactions: len(transactions),
+		Unallocated:  unallocated,
+	}
+	for shard := range result.Shards {
+		result.Shards[shard].Shard = shard
+	}
+
+	// Schedule the arrival of every transaction, and the first block of every shard
+	events := &eventQueue{}
+	seq := 0
+	push := func(e event) {
+		e.seq = seq
+		seq++
+		heap.Push(events, e)
+	}
+	for i, tx := range transactions {
+		push(event{time: tx.arrival, kind: arrivalEvent, shard: tx.fromShard, tx: i})
+
+		if tx.fromShard == tx.toShard {
+			result.Shards[tx.fromShard].IntraShard++
+		} else {
+			result.Shards[tx.fromShard].CrossShardSent++
+			result.Shards[tx.toShard].CrossShardReceived++
+		}
+	}
+	for shard := 0; shard < numberOfShards; shard++ {
+		push(event{time: config.BlockInterval, kind: blockEvent, shard: shard})
+	}
+
+	queues := make([][]queued, numberOfShards)
+	queueLengthSums := make([]int, numberOfShards)
+	blocks := make([]int, numberOfShards)
+	latencies := make([][]float64, numberOfShards)
+
+	pending := len(transactions)
+	now := 0.0
+
+	for events.Len() > 0 && pending > 0 {
+		e := heap.Pop(events).(event)
+		if config.MaxTime > 0 && e.time > config.MaxTime {
+			break
+		}
+		now = e.time
+
+		switch e.kind {
+
+		case arrivalEvent:
+			queues[e.shard] = append(queues[e.shard], queued{tx: e.tx})
+
+		case relayEvent:
+			queues[e.shard] = append(queues[e.shard], queued{tx: e.tx, relay: true})
+
+		case blockEvent:
+			stats := &result.Shards[e.shard]
+
+			queueLengthSums[e.shard] += len(queues[e.shard])
+			blocks[e.shard]++
+			stats.MaxQueueLength = max(stats.MaxQueueLength, len(queues[e.shard]))
+
+			// Take as many transactions as fit in the block from the front of the queue
+			included := min(config.BlockCapacity, len(queues[e.shard]))
+			for _, q := range queues[e.shard][:included] {
+				tx := transactions[q.tx]
+
+				if tx.fromShard != tx.toShard && !q.relay {
+					// First phase of a cross-shard transaction, so relay it to the receiver's shard
+					push(event{time: now + config.RelayDelay, kind: relayEvent, shard: tx.toShard, tx: q.tx})
+					continue
+				}
+
+				stats.Confirmed++
+				latencies[e.shard] = append(latencies[e.shard], now-tx.arrival)
+				pending--
+			}
+			stats.Included += included
+			queues[e.shard] = queues[e.shard][included:]
+
+			push(event{time: now + config.BlockInterval, kind: blockEvent, shard: e.shard})
+		}
+	}
+
+	// Work out the statistics of each shard, and of the whole chain
+	result.Duration = now
+	var allLatencies []float64
+	for shard := range result.Shards {
+		stats := &result.Shards[shard]
+		if now > 0 {
+			stats.Throughput = float64(stats.Included) / now
+		}
+		if blocks[shard] > 0 {
+			stats.MeanQueueLength = float64(queueLengthSums[shard]) / float64(blocks[shard])
+		}
+		stats.Latency = summariseLatencies(latencies[shard])
+
+		result.Confirmed += stats.Confirmed
+		allLatencies = append(allLatencies, latencies[shard]...)
+	}
+	if now > 0 {
+		result.Throughput = float64(result.Confirmed) / now
+	}
+	result.Latency = summariseLatencies(allLatencies)
+
+	if pending > 0 {
+		log.Printf("Simulation stopped with %d of %d transactions not confirmed", pending, len(transactions))
+	}
+
+	return result, nil
+}
+
+// Function to check that the allocation can be replayed, and return the number of shards of the chain
+// Every account must be in one of the shards, and the chain cannot have fewer shards than the allocation
+func checkAllocation(allocation *shared.Allocation, config Config) (int, error) {
+
+	if allocation == nil {
+		return 0, errors.New("no allocation")
+	}
+
+	numberOfShards := allocation.NumberOfShards
+	if config.NumberOfShards > 0 {
+		if config.NumberOfShards < allocation.NumberOfShards {
+			return 0, fmt.Errorf("the chain has %d shards, but the allocation has %d", config.NumberOfShards,
+				allocation.NumberOfShards)
+		}
+		numberOfShards = config.NumberOfShards
+	}
+	if numberOfShards <= 0 {
+		return 0, errors.New("allocation has no shards")
+	}
+
+	// Check the accounts in order, so that the same account is reported every time
+	accounts := make([]string, 0, len(allocation.Accounts))
+	for account := range allocation.Accounts {
+		accounts = append(accounts, account)
+	}
+	sort.Strings(accounts)
+	for _, account := range accounts {
+		if shard := allocation.Accounts[account]; shard < 0 || shard >= numberOfShards {
+			return 0, fmt.Errorf("account %s is in shard %d, but the chain has %d shards", account, shard,
+				numberOfShards)
+		}
+	}
+
+	return numberOfShards, nil
+}
+
+// Function to read the transactions from the rows, with their arrival time and the shards of their accounts
+// It also returns the number of accounts which were not in the allocation
+func readTransactions(rows [][]string, allocation *shared.Allocation, numberOfShards int,
+	config Config) ([]transaction, int, error) {
+
+	if len(rows) == 0 {
+		return nil, 0, nil
+	}
+
+	// Parse header row to find "from", "to" and "timestamp" indices
+	fromIdx, toIdx, timestampIdx := -1, -1, -1
+	for i, col := range rows[0] {
+		switch col {
+		case "from":
+			fromIdx = i
+		case "to":
+			toIdx = i
+		case "timestamp":
+			timestampIdx = i
+		}
+	}
+	if fromIdx == -1 || toIdx == -1 {
+		return nil, 0, errors.New("'from' or 'to' column not found in header")
+	}
+	if timestampIdx == -1 && config.ArrivalRate <= 0 {
+		return nil, 0, errors.New("the transactions have no timestamp, so the arrival rate must be positive")
+	}
+
+	// Accounts that are not in the allocation are given a shard from their hash, and counted once each
+	unallocated := make(map[string]bool)
+	shardOf := func(account string) int {
+		if shard, exists := allocation.Accounts[account]; exists {
+			return shard
+		}
+		unallocated[account] = true
+		hash := fnv.New32a()
+		hash.Write([]byte(account))
+		return int(hash.Sum32() % uint32(numberOfShards))
+	}
+
+	transactions := make([]transaction, 0, len(rows)-1)
+	firstTimestamp := math.Inf(1)
+	for i, row := range rows {
+		// Skip the header
+		if i == 0 {
+			continue
+		}
+		if len(row) <= max(fromIdx, toIdx, timestampIdx) {
+			continue // Skip invalid/malformed rows
+		}
+
+		tx := transaction{
+			fromShard: shardOf(row[fromIdx]),
+			toShard:   shardOf(row[toIdx]),
+		}
+
+		if timestampIdx == -1 {
+			tx.arrival = float64(len(transactions)) / config.ArrivalRate
+		} else {
+			timestamp, err := strconv.ParseFloat(row[timestampIdx], 64)
+			if err != nil {
+				return nil, 0, fmt.Errorf("invalid timestamp at row %d: %v", i+1, err)
+			}
+			tx.arrival = timestamp
+			firstTimestamp = math.Min(firstTimestamp, timestamp)
+		}
+
+		transactions = append(transactions, tx)
+	}
+
+	// Count the time from the first transaction
+	if timestampIdx != -1 {
+		for i := range transactions {
+			transactions[i].arrival -= firstTimestamp
+		}
+	}
+
+	return transactions, len(unallocated), nil
+}
+
+// Function to work out the mean, percentiles and maximum of the latencies
+func summariseLatencies(latencies []float64) LatencyStats {
+
+	if len(latencies) == 0 {
+		return LatencyStats{}
+	}
+
+	sorted := append([]float64(nil), latencies...)
+	sort.Float64s(sorted)
+
+	total := 0.0
+	for _, latency := range sorted {
+		total += latency
+	}
+
+	// Nearest-rank percentile
+	percentile := func(p float64) float64 {
+		rank := int(math.Ceil(p/100*float64(len(sorted)))) - 1
+		return sorted[max(rank, 0)]
+	}
+
+	return LatencyStats{
+		Mean: total / float64(len(sorted)),
+		P50:  percentile(50),
+		P90:  percentile(90),
+		P99:  percentile(99),
+		Max:  sorted[len(sorted)-1],
+	}
+}
+
+// Function to write the statistics of each shard to a CSV file, followed by a row for the whole chain (shard "all")
+func WriteResult(filename string, result *Result) error {
+
+	file, err := os.Create(filename)
+	if err != nil {
+		return fmt.Errorf("error creating output CSV file: %w", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+
+	header := []string{"shard", "intraShard", "crossShardSent", "crossShardReceived", "confirmed", "included",
+		"throughput", "meanQueueLength", "maxQueueLength",
+		"meanLatency", "p50Latency", "p90Latency", "p99Latency", "maxLatency"}
+	writer.Write(header)
+
+	latencyColumns := func(latency LatencyStats) []string {
+		return []string{
+			fmt.Sprintf("%.3f", latency.Mean),
+			fmt.Sprintf("%.3f", latency.P50),
+			fmt.Sprintf("%.3f", latency.P90),
+			fmt.Sprintf("%.3f", latency.P99),
+			fmt.Sprintf("%.3f", latency.Max),
+		}
+	}
+
+	for _, stats := range result.Shards {
+		record := []string{
+			strconv.Itoa(stats.Shard),
+			strconv.Itoa(stats.IntraShard),
+			strconv.Itoa(stats.CrossShardSent),
+			strconv.Itoa(stats.CrossShardReceived),
+			strconv.Itoa(stats.Confirmed),
+			strconv.Itoa(stats.Included),
+			fmt.Sprintf("%.3f", stats.Throughput),
+			fmt.Sprintf("%.3f", stats.MeanQueueLength),
+			strconv.Itoa(stats.MaxQueueLength),
+		}
+		writer.Write(append(record, latencyColumns(stats.Latency)...))
+	}
+
+	// The counts of the whole chain are the totals of the shards
+	intraShard, crossShard, included := 0, 0, 0
+	for _, stats := range result.Shards {
+		intraShard += stats.IntraShard
+		crossShard += stats.CrossShardSent
+		included += stats.Included
+	}
+	record := []string{
+		"all",
+		strconv.Itoa(intraShard),
+		strconv.Itoa(crossShard),
+		strconv.Itoa(crossShard),
+		strconv.Itoa(result.Confirmed),
+		strconv.Itoa(included),
+		fmt.Sprintf("%.3f", result.Throughput),
+		"",
+		"",
+	}
+	writer.Write(append(record, latencyColumns(result.Latency)...))
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("error writing output CSV file: %w", err)
+	}
+
+	return file.Close()
+}
@@ -0,0 +1,135 @@
+package simulator
+
+import (
+	"testing"
+
+	"example.com/shardinglpa/shared"
+)
+
+// The transactions replayed by the tests, between accounts a, b and c, and an account d that is not allocated
+var rows = [][]string{
+	{"from", "to"},
+	{"a", "b"},
+	{"b", "c"},
+	{"c", "d"},
+}
+
+// Allocations with accounts in shards the chain does not have are rejected, instead of panicking
+func TestSimulateRejectsInvalidAllocations(t *testing.T) {
+
+	cases := []struct {
+		name           string
+		allocation     *shared.Allocation
+		numberOfShards int
+	}{
+		{"no allocation", nil, 0},
+		{"no shards", &shared.Allocation{Accounts: map[string]int{}}, 0},
+		{"shard too high", &shared.Allocation{NumberOfShards: 2, Accounts: map[string]int{"a": 0, "b": 2}}, 0},
+		{"negative shard", &shared.Allocation{NumberOfShards: 2, Accounts: map[string]int{"a": -1}}, 0},
+		{"fewer shards than the allocation", &shared.Allocation{NumberOfShards: 4,
+			Accounts: map[string]int{"a": 0}}, 2},
+		{"shard too high for the chain", &shared.Allocation{NumberOfShards: 2,
+			Accounts: map[string]int{"a": 0, "b": 3}}, 3},
+	}
+
+	for _, c := range cases {
+		config := DefaultConfig()
+		config.NumberOfShards = c.numberOfShards
+		if result, err := Simulate(rows, c.allocation, config); err == nil {
+			t.Errorf("%s: expected an error, but got %+v", c.name, result)
+		}
+	}
+}
+
+// The chain can have more shards than an allocation loaded from CSV shows, and every shard is simulated
+func TestSimulateWithMoreShards(t *testing.T) {
+
+	allocation := &shared.Allocation{NumberOfShards: 2, Accounts: map[string]int{"a": 0, "b": 1, "c": 1}}
+
+	config := DefaultConfig()
+	config.NumberOfShards = 4
+	result, err := Simulate(rows, allocation, config)
+	if err != nil {
+		t.Fatalf("Failed to simulate: %v", err)
+	}
+	if len(result.Shards) != 4 || result.Transactions != 3 || result.Unallocated != 1 {
+		t.Fatalf("Got %d shards, %d transactions and %d unallocated accounts, expected 4, 3 and 1",
+			len(result.Shards), result.Transactions, result.Unallocated)
+	}
+}
+
+// Function to simulate the rows on two shards, where a and b are in shard 0 and c is in shard 1
+func simulateTwoShards(t *testing.T, rows [][]string, blockCapacity int) *Result {
+	t.Helper()
+
+	allocation := &shared.Allocation{NumberOfShards: 2, Accounts: map[string]int{"a": 0, "b": 0, "c": 1}}
+
+	config := DefaultConfig()
+	config.BlockCapacity = blockCapacity
+	result, err := Simulate(rows, allocation, config)
+	if err != nil {
+		t.Fatalf("Failed to simulate: %v", err)
+	}
+	return result
+}
+
+// An intra-shard transaction is confirmed by the first block of its shard, and a cross-shard transaction by the
+// first block of the receiver's shard after the relay
+func TestSimulateConfirmationTimes(t *testing.T) {
+
+	result := simulateTwoShards(t, [][]string{
+		{"from", "to", "timestamp"},
+		{"a", "b", "100"},
+		{"a", "c", "100"},
+	}, 150)
+
+	// Sent at t=0, the intra-shard transaction is in the block at 12s. The cross-shard transaction is in the same
+	// block, its relay reaches shard 1 at 13s, and it is confirmed by the next block of shard 1, at 24s
+	expected := []ShardStats{
+		{Shard: 0, IntraShard: 1, CrossShardSent: 1, Confirmed: 1, Included: 2, Throughput: 2.0 / 24,
+			MeanQueueLength: 1, MaxQueueLength: 2,
+			Latency: LatencyStats{Mean: 12, P50: 12, P90: 12, P99: 12, Max: 12}},
+		{Shard: 1, CrossShardReceived: 1, Confirmed: 1, Included: 1, Throughput: 1.0 / 24,
+			MeanQueueLength: 0.5, MaxQueueLength: 1,
+			Latency: LatencyStats{Mean: 24, P50: 24, P90: 24, P99: 24, Max: 24}},
+	}
+	for shard, stats := range result.Shards {
+		if stats != expected[shard] {
+			t.Errorf("Shard %d: got %+v, expected %+v", shard, stats, expected[shard])
+		}
+	}
+
+	if result.Confirmed != 2 || result.Duration != 24 || result.Throughput != 2.0/24 {
+		t.Errorf("Got %d confirmed in %vs at %v per second, expected 2 in 24s at %v", result.Confirmed,
+			result.Duration, result.Throughput, 2.0/24)
+	}
+	if expectedLatency := (LatencyStats{Mean: 18, P50: 12, P90: 24, P99: 24, Max: 24}); result.Latency !=
+		expectedLatency {
+		t.Errorf("Latency is %+v, expected %+v", result.Latency, expectedLatency)
+	}
+}
+
+// Transactions that do not fit in a block wait in the queue for the next block of their shard
+func TestSimulateSpillsIntoNextBlock(t *testing.T) {
+
+	result := simulateTwoShards(t, [][]string{
+		{"from", "to", "timestamp"},
+		{"a", "b", "0"},
+		{"b", "a", "0"},
+		{"a", "b", "0"},
+	}, 2)
+
+	// Two of the three transactions fit in the block at 12s, and the third is in the block at 24s
+	expected := ShardStats{Shard: 0, IntraShard: 3, Confirmed: 3, Included: 3, Throughput: 3.0 / 24,
+		MeanQueueLength: 2, MaxQueueLength: 3, Latency: LatencyStats{Mean: 16, P50: 12, P90: 24, P99: 24, Max: 24}}
+	if result.Shards[0] != expected {
+		t.Errorf("Shard 0: got %+v, expected %+v", result.Shards[0], expected)
+	}
+	if result.Shards[1].Included != 0 || result.Shards[1].MaxQueueLength != 0 {
+		t.Errorf("Shard 1 included %d transactions with a queue of up to %d, expected none",
+			result.Shards[1].Included, result.Shards[1].MaxQueueLength)
+	}
+	if result.Confirmed != 3 || result.Duration != 24 {
+		t.Errorf("Got %d confirmed in %vs, expected 3 in 24s", result.Confirmed, result.Duration)
+	}
+}
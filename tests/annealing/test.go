@@ -0,0 +1,153 @@
+package annealing
+
+import (
+	"encoding/csv"
+	"log"
+	"runtime"
+
+	"example.com/shardinglpa/mylpa"
+	"example.com/shardinglpa/paperclpa"
+	"example.com/shardinglpa/shared"
+	"example.com/shardinglpa/tests"
+)
+
+func RunTestSuite(runs int) {
+
+	totalTests := 3
+
+	log.Printf("*********** TEST SUITE 'Greedy vs Simulated Annealing Label Selection' STARTED (%d Tests in total) ***********", totalTests)
+
+	writerPaper, filePaper := tests.CreateResultsWriter("annealing/CLPA")
+	defer writerPaper.Flush()
+	defer filePaper.Close()
+
+	writerPaperAnnealing, filePaperAnnealing := tests.CreateResultsWriter("annealing/CLPA_annealing")
+	defer writerPaperAnnealing.Flush()
+	defer filePaperAnnealing.Close()
+
+	writerMyLpa, fileMyLpa := tests.CreateResultsWriter("annealing/my_LPA")
+	defer writerMyLpa.Flush()
+	defer fileMyLpa.Close()
+
+	writerMyLpaAnnealing, fileMyLpaAnnealing := tests.CreateResultsWriter("annealing/my_LPA_annealing")
+	defer writerMyLpaAnnealing.Flush()
+	defer fileMyLpaAnnealing.Close()
+
+	// The number of epochs to be run
+	numberOfEpochs := 30
+
+	// The number of times/threshold each vertex is allowed to update its label (rho)
+	rho := 50
+
+	// The weight of cross-shard vs workload imbalance in fitness calculation
+	alpha := 0.5
+
+	// The weight of cross-shard vs workload imbalance in score function
+	beta := 0.5
+
+	// The number of iterations of CLPA
+	tau := 100
+
+	// The number of shards
+	numberOfShards := 8
+
+	// The transaction arrival rate
+	arrivalRate := "low"
+
+	// Set number of parallel runs to half the number of cores available
+	numberOfParallelRuns := max(int(runtime.NumCPU()/2), 1)
+
+	// END OF SETUP
+
+	// NOW FOR THE TESTS:
+
+	/* 3 tests are run in total, each starting simulated annealing at a different temperature:
+	a cool start that only rarely picks a worse shard, the default start, and a hot start */
+	for i, initialTemperature := range []float64{0.2, 0.5, 1} {
+		test := i + 1
+
+		schedule := shared.DefaultAnnealingSchedule()
+		schedule.InitialTemperature = initialTemperature
+
+		log.Printf("Started Test %d/%d - initial temperature = %.1f, decay = %.2f", test, totalTests,
+			schedule.InitialTemperature, schedule.Decay)
+
+		runTest(test, runs, numberOfShards, arrivalRate, numberOfEpochs, numberOfParallelRuns, alpha, beta, tau, rho,
+			schedule, writerPaper, writerPaperAnnealing, writerMyLpa, writerMyLpaAnnealing)
+	}
+
+	log.Println("*********** TEST SUITE 'Greedy vs Simulated Annealing Label Selection' FINISHED ***********")
+}
+
+func runTest(test int, runs int, shards int, arrivalRate string, numberOfEpochs int, parallelRuns int,
+	alpha float64, beta float64, tau int, rho int, schedule shared.AnnealingSchedule, writerPaper *csv.Writer,
+	writerPaperAnnealing *csv.Writer, writerMyLpa *csv.Writer, writerMyLpaAnnealing *csv.Writer) {
+
+	datasetDir := "shared/epochs/" + arrivalRate + "_arrival_rate/"
+
+	// Counter to store the index of the next unused seed
+	nextSeedIndex := 0
+
+	for run := 1; run <= runs; run++ {
+
+		var graphPaper *shared.Graph = nil
+		var graphPaperAnnealing *shared.Graph = nil
+		var graphMyLpa *shared.Graph = nil
+		var graphMyLpaAnnealing *shared.Graph = nil
+
+		var paperResults []*shared.EpochResult
+		var paperAnnealingResults []*shared.EpochResult
+		var myLpaResults [][]*shared.EpochResult
+		var myLpaAnnealingResults [][]*shared.EpochResult
+
+		// Iterate over the epochs
+		for epoch := 1; epoch <= numberOfEpochs; epoch++ {
+
+			// CLPA as in paper, greedy and with simulated annealing
+
+			epochResult := paperclpa.ShardAllocation(datasetDir, shards, epoch, graphPaper, alpha, beta, tau, rho,
+				paperclpa.ClpaIterationAsync, paperclpa.RunClpaPaper, paperclpa.CalculateScoresPaper)
+
+			// Check if result is nil, which can happen when epoch file is not found. If so, continue to next iteration
+			if epochResult == nil {
+				continue
+			}
+			graphPaper = epochResult.Graph
+			epochResult.Graph = nil
+			paperResults = append(paperResults, epochResult)
+
+			// The annealing iteration mode counts its iterations, so a new one is used for every epoch
+			epochResult = paperclpa.ShardAllocation(datasetDir, shards, epoch, graphPaperAnnealing, alpha, beta,
+				tau, rho, paperclpa.NewClpaIterationAsyncAnnealing(schedule), paperclpa.RunClpaPaper,
+				paperclpa.CalculateScoresPaper)
+			graphPaperAnnealing = epochResult.Graph
+			epochResult.Graph = nil
+			paperAnnealingResults = append(paperAnnealingResults, epochResult)
+
+			// My LPA, greedy and with simulated annealing
+
+			// Get the random seeds, which are the same for both variants
+			seeds, err := mylpa.GetSeeds("mylpa/seeds.csv", parallelRuns, nextSeedIndex)
+			if err != nil {
+				log.Fatalf("Failed to load seeds: %v", err)
+			}
+			nextSeedIndex += parallelRuns
+
+			seedsResults, graph := tests.RunSeedsEpoch(mylpa.ShardAllocationWithConfig, datasetDir, shards, epoch,
+				graphMyLpa, alpha, beta, tau, rho, seeds, shared.AllocationConfig{})
+			graphMyLpa = graph
+			myLpaResults = append(myLpaResults, seedsResults)
+
+			seedsResults, graph = tests.RunSeedsEpoch(mylpa.ShardAllocationWithConfig, datasetDir, shards, epoch,
+				graphMyLpaAnnealing, alpha, beta, tau, rho, seeds, shared.AllocationConfig{Annealing: &schedule})
+			graphMyLpaAnnealing = graph
+			myLpaAnnealingResults = append(myLpaAnnealingResults, seedsResults)
+		}
+
+		tests.WriteSingleResults(paperResults, writerPaper, test, run)
+		tests.WriteSingleResults(paperAnnealingResults, writerPaperAnnealing, test, run)
+		tests.WriteResults(myLpaResults, writerMyLpa, test, run)
+		tests.WriteResults(myLpaAnnealingResults, writerMyLpaAnnealing, test, run)
+	}
+	log.Printf("Test finished")
+}
@@ -0,0 +1,196 @@
+package tests
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+)
+
+/*
+A checkpoint records the (test, run) pairs of a test suite that have finished, so that a suite that was stopped
+part of the way through can be resumed. Each row holds the test, the run and the index of the next unused seed
+in mylpa/seeds.csv after the run, so that a resumed test keeps using the same seeds as if it was never stopped.
+
+A run is only recorded in the checkpoint once its results were written, so at most the run that was running
+when the suite was stopped is repeated. Each row also holds the size of every result file tracked by the checkpoint
+once the results of the run were flushed. When the suite is resumed, the result files are truncated back to the
+sizes in the last row, so the rows of a run that was written but not recorded are not written twice.
+The checkpoint file is removed once the whole suite finishes, so the next time the suite is run it starts from
+the beginning.
+
+All methods can be called on a nil checkpoint, in which case nothing is skipped and nothing is recorded.
+*/
+type Checkpoint struct {
+	filePath string
+	file     *os.File
+	writer   *csv.Writer
+
+	// Index of the next unused seed after each finished run, for each test and run
+	finished map[[2]int]int
+
+	// Result files tracked by the checkpoint, and their sizes in the last row of the checkpoint, by path
+	files []*os.File
+	sizes map[string]int64
+}
+
+// Function to open the checkpoint of a test suite, loading the runs that were already finished
+func OpenCheckpoint(filename string) *Checkpoint {
+
+	filePath := fmt.Sprintf("tests/%s.csv", filename)
+
+	checkpoint := &Checkpoint{
+		filePath: filePath,
+		finished: make(map[[2]int]int),
+		sizes:    make(map[string]int64),
+	}
+
+	// Load the runs that were finished before the suite was stopped, if any
+	if file, err := os.Open(filePath); err == nil {
+		reader := csv.NewReader(file)
+		reader.FieldsPerRecord = -1
+		for {
+			record, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				// A row that was only partly written when the suite was stopped is ignored
+				log.Printf("Ignoring rest of checkpoint '%s': %v\n", filename, err)
+				break
+			}
+			if len(record) < 3 || len(record)%2 == 0 {
+				log.Printf("Ignoring invalid checkpoint row in '%s': %v\n", filename, record)
+				continue
+			}
+			test, errTest := strconv.Atoi(record[0])
+			run, errRun := strconv.Atoi(record[1])
+			nextSeedIndex, errSeed := strconv.Atoi(record[2])
+			if errTest != nil || errRun != nil || errSeed != nil {
+				log.Printf("Ignoring invalid checkpoint row in '%s': %v\n", filename, record)
+				continue
+			}
+			checkpoint.finished[[2]int{test, run}] = nextSeedIndex
+
+			// The sizes of the result files after the run, as path and size pairs
+			for i := 3; i+1 < len(record); i += 2 {
+				if size, err := strconv.ParseInt(record[i+1], 10, 64); err == nil {
+					checkpoint.sizes[record[i]] = size
+				}
+			}
+		}
+		file.Close()
+	} else if !errors.Is(err, os.ErrNotExist) {
+		log.Fatalf("Failed to open checkpoint '%s': %v\n", filename, err)
+	}
+
+	// Open the checkpoint for appending the runs that finish from now on
+	file, err := os.OpenFile(filePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		log.Fatalf("Failed to open checkpoint '%s': %v\n", filename, err)
+	}
+	checkpoint.file = file
+	checkpoint.writer = csv.NewWriter(file)
+
+	if checkpoint.Resuming() {
+		log.Printf("Resuming from checkpoint '%s' (%d runs already finished)", filename, len(checkpoint.finished))
+	}
+
+	return checkpoint
+}
+
+// Function to check whether any runs were finished before the suite was stopped
+// If so, the result files of the suite are appended to instead of being created from scratch
+func (checkpoint *Checkpoint) Resuming() bool {
+	return checkpoint != nil && len(checkpoint.finished) > 0
+}
+
+/*
+Function to track a result file, so that its size is recorded with every finished run
+
+If the suite is resuming, the file is first truncated back to its size when the last run was recorded, which drops
+the rows of any run that was written but not recorded before the suite was stopped. Files written before their
+sizes were recorded are left as they are.
+*/
+func (checkpoint *Checkpoint) Track(file *os.File) {
+	if checkpoint == nil {
+		return
+	}
+
+	checkpoint.files = append(checkpoint.files, file)
+
+	size, recorded := checkpoint.sizes[file.Name()]
+	if !checkpoint.Resuming() || !recorded {
+		return
+	}
+	info, err := file.Stat()
+	if err != nil {
+		log.Fatalf("Failed to read result file '%s': %v\n", file.Name(), err)
+	}
+	if info.Size() > size {
+		log.Printf("Dropping %d bytes of unrecorded results from '%s'", info.Size()-size, file.Name())
+		if err := file.Truncate(size); err != nil {
+			log.Fatalf("Failed to truncate result file '%s': %v\n", file.Name(), err)
+		}
+	}
+}
+
+// Function to check whether a run of a test was already finished
+// If it was, the index of the next unused seed after the run is also returned
+func (checkpoint *Checkpoint) Finished(test int, run int) (int, bool) {
+	if checkpoint == nil {
+		return 0, false
+	}
+	nextSeedIndex, finished := checkpoint.finished[[2]int{test, run}]
+	return nextSeedIndex, finished
+}
+
+// Function to record that a run of a test has finished, once its results were written and flushed
+// The result files are synced to disk before the checkpoint, and the checkpoint is synced straight away, so the run
+// is not lost if the suite is stopped
+func (checkpoint *Checkpoint) Record(test int, run int, nextSeedIndex int) {
+	if checkpoint == nil {
+		return
+	}
+
+	checkpoint.finished[[2]int{test, run}] = nextSeedIndex
+
+	record := []string{strconv.Itoa(test), strconv.Itoa(run), strconv.Itoa(nextSeedIndex)}
+	for _, file := range checkpoint.files {
+		if err := file.Sync(); err != nil {
+			log.Printf("Error syncing result file '%s': %v", file.Name(), err)
+		}
+		info, err := file.Stat()
+		if err != nil {
+			log.Printf("Error reading result file '%s': %v", file.Name(), err)
+			continue
+		}
+		checkpoint.sizes[file.Name()] = info.Size()
+		record = append(record, file.Name(), strconv.FormatInt(info.Size(), 10))
+	}
+	if err := checkpoint.writer.Write(record); err != nil {
+		log.Printf("Error writing checkpoint: %v", err)
+	}
+	checkpoint.writer.Flush()
+	if err := checkpoint.writer.Error(); err != nil {
+		log.Printf("Error flushing checkpoint: %v", err)
+	}
+	if err := checkpoint.file.Sync(); err != nil {
+		log.Printf("Error syncing checkpoint: %v", err)
+	}
+}
+
+// Function to close the checkpoint once the whole suite has finished, removing its file
+func (checkpoint *Checkpoint) Finish() {
+	if checkpoint == nil {
+		return
+	}
+
+	checkpoint.file.Close()
+	if err := os.Remove(checkpoint.filePath); err != nil {
+		log.Printf("Error removing checkpoint: %v", err)
+	}
+}
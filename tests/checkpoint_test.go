@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// Rows written after the last recorded run are dropped when the suite resumes, so a run that was written but not
+// recorded before the suite was stopped is not written twice
+func TestCheckpointDropsUnrecordedRows(t *testing.T) {
+
+	// The suites write under tests/, relative to the working directory
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "tests"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	wd, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	// Run 1 is recorded, and run 2 is written but the suite stops before it is recorded
+	checkpoint := OpenCheckpoint("checkpoint")
+	writer, file := OpenTimesWriter("times", false)
+	checkpoint.Track(file)
+	WriteTimes(writer, 1, 1, []float64{1}, []float64{2})
+	checkpoint.Record(1, 1, 0)
+	WriteTimes(writer, 1, 2, []float64{1}, []float64{2})
+	file.Close()
+	checkpoint.file.Close()
+
+	// The resumed suite skips run 1 and writes run 2 again
+	checkpoint = OpenCheckpoint("checkpoint")
+	if !checkpoint.Resuming() {
+		t.Fatal("Checkpoint is not resuming")
+	}
+	if _, finished := checkpoint.Finished(1, 2); finished {
+		t.Fatal("Run 2 is finished, but it was never recorded")
+	}
+	writer, file = OpenTimesWriter("times", true)
+	checkpoint.Track(file)
+	WriteTimes(writer, 1, 2, []float64{1}, []float64{2})
+	checkpoint.Record(1, 2, 0)
+	file.Close()
+	checkpoint.Finish()
+
+	data, err := os.ReadFile("tests/times.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "1,1,") || !strings.HasPrefix(lines[2], "1,2,") {
+		t.Fatalf("Expected the header and one row for each run, got:\n%s", data)
+	}
+	if _, err := os.Stat("tests/checkpoint.csv"); !os.IsNotExist(err) {
+		t.Fatalf("Checkpoint file was not removed: %v", err)
+	}
+}
@@ -0,0 +1,150 @@
+package consensus
+
+import (
+	"encoding/csv"
+	"log"
+	"runtime"
+
+	"example.com/shardinglpa/mylpa"
+	"example.com/shardinglpa/shared"
+	"example.com/shardinglpa/tests"
+)
+
+func RunTestSuite(runs int) {
+
+	totalTests := 3
+
+	log.Printf("*********** TEST SUITE 'My LPA vs My LPA with Consensus of Seeds' STARTED (%d Tests in total) ***********", totalTests)
+
+	writerBaseline, fileBaseline := tests.CreateResultsWriter("consensus/my_LPA")
+	defer writerBaseline.Flush()
+	defer fileBaseline.Close()
+
+	writerConsensus, fileConsensus := tests.CreateResultsWriter("consensus/my_LPA_consensus")
+	defer writerConsensus.Flush()
+	defer fileConsensus.Close()
+
+	writerStabilityBaseline, fileStabilityBaseline := tests.CreateStabilityWriter("consensus/my_LPA_stability")
+	defer writerStabilityBaseline.Flush()
+	defer fileStabilityBaseline.Close()
+
+	writerStabilityConsensus, fileStabilityConsensus := tests.CreateStabilityWriter("consensus/my_LPA_consensus_stability")
+	defer writerStabilityConsensus.Flush()
+	defer fileStabilityConsensus.Close()
+
+	// The number of epochs to be run
+	numberOfEpochs := 30
+
+	// The number of times/threshold each vertex is allowed to update its label (rho)
+	rho := 50
+
+	// The weight of cross-shard vs workload imbalance in fitness calculation
+	alpha := 0.5
+
+	// The weight of cross-shard vs workload imbalance in score function
+	beta := 0.5
+
+	// The number of iterations of CLPA
+	tau := 100
+
+	// The number of shards
+	numberOfShards := 8
+
+	// The transaction arrival rate
+	arrivalRate := "low"
+
+	// Set number of parallel runs to half the number of cores available
+	numberOfParallelRuns := max(int(runtime.NumCPU()/2), 1)
+
+	// END OF SETUP
+
+	// NOW FOR THE TESTS:
+
+	/* 3 tests are run in total, each with a different fraction of seeds in which two neighbours must share a shard
+	to be merged in the consensus: a loose agreement, an almost certain agreement, and a full agreement */
+	consensusConfigs := []*shared.ConsensusConfig{
+		{Agreement: 0.75},
+		{Agreement: 0.9},
+		{Agreement: 1},
+	}
+
+	for i, consensusConfig := range consensusConfigs {
+		test := i + 1
+
+		log.Printf("Started Test %d/%d - agreement = %.2f", test, totalTests, consensusConfig.Agreement)
+
+		runTest(test, runs, numberOfShards, arrivalRate, numberOfEpochs, numberOfParallelRuns, alpha, beta, tau, rho,
+			consensusConfig, writerBaseline, writerConsensus, writerStabilityBaseline, writerStabilityConsensus)
+	}
+
+	log.Println("*********** TEST SUITE 'My LPA vs My LPA with Consensus of Seeds' FINISHED ***********")
+}
+
+func runTest(test int, runs int, shards int, arrivalRate string, numberOfEpochs int, parallelRuns int,
+	alpha float64, beta float64, tau int, rho int, consensusConfig *shared.ConsensusConfig,
+	writerBaseline *csv.Writer, writerConsensus *csv.Writer, writerStabilityBaseline *csv.Writer,
+	writerStabilityConsensus *csv.Writer) {
+
+	datasetDir := "shared/epochs/" + arrivalRate + "_arrival_rate/"
+
+	// Counter to store the index of the next unused seed
+	nextSeedIndex := 0
+
+	for run := 1; run <= runs; run++ {
+
+		var graphBaseline *shared.Graph = nil
+		var graphConsensus *shared.Graph = nil
+
+		var baselineResults [][]*shared.EpochResult
+		var consensusResults [][]*shared.EpochResult
+
+		// The number of vertices that moved shard since the previous epoch, and the number compared
+		var movedBaseline, comparedBaseline []int
+		var movedConsensus, comparedConsensus []int
+
+		// Iterate over the epochs
+		for epoch := 1; epoch <= numberOfEpochs; epoch++ {
+
+			// Get the random seeds, which are the same for both variants
+			seeds, err := mylpa.GetSeeds("mylpa/seeds.csv", parallelRuns, nextSeedIndex)
+			if err != nil {
+				log.Fatalf("Failed to load seeds: %v", err)
+			}
+			nextSeedIndex += parallelRuns
+
+			// My LPA picking the best seed
+
+			seedsResults, graph, moved, compared := tests.RunSeedsEpochCountingMoves(
+				mylpa.ShardAllocationWithConfig, datasetDir, shards, epoch, graphBaseline, alpha, beta, tau, rho, seeds,
+				shared.AllocationConfig{})
+
+			// Check if results are nil, which can happen when epoch file is not found
+			if seedsResults == nil {
+				continue
+			}
+
+			graphBaseline = graph
+			baselineResults = append(baselineResults, seedsResults)
+			movedBaseline = append(movedBaseline, moved)
+			comparedBaseline = append(comparedBaseline, compared)
+
+			// My LPA picking the consensus of the seeds
+
+			seedsResults, graph, moved, compared = tests.RunSeedsEpochCountingMoves(
+				mylpa.ShardAllocationWithConfig, datasetDir, shards, epoch, graphConsensus, alpha, beta, tau, rho, seeds,
+				shared.AllocationConfig{Consensus: consensusConfig})
+
+			graphConsensus = graph
+			consensusResults = append(consensusResults, seedsResults)
+			movedConsensus = append(movedConsensus, moved)
+			comparedConsensus = append(comparedConsensus, compared)
+		}
+
+		tests.WriteResults(baselineResults, writerBaseline, test, run)
+		tests.WriteResults(consensusResults, writerConsensus, test, run)
+
+		tests.WriteStability(writerStabilityBaseline, test, run, movedBaseline, comparedBaseline)
+		tests.WriteStability(writerStabilityConsensus, test, run, movedConsensus, comparedConsensus)
+	}
+	log.Printf("Test finished")
+}
@@ -0,0 +1,123 @@
+package memetic
+
+import (
+	"context"
+	"encoding/csv"
+	"log"
+	"runtime"
+
+	"example.com/shardinglpa/mylpa"
+	"example.com/shardinglpa/shared"
+	"example.com/shardinglpa/tests"
+)
+
+func RunTestSuite(runs int) {
+
+	totalTests := 3
+
+	log.Printf("*********** TEST SUITE 'Memetic Optimiser seeded by My LPA' STARTED (%d Tests in total) ***********", totalTests)
+
+	writerResults, fileResults := tests.CreateResultsWriter("memetic/my_LPA")
+	defer writerResults.Flush()
+	defer fileResults.Close()
+
+	writerGenerations, fileGenerations := tests.CreateGenerationsWriter("memetic/my_LPA_memetic_generations")
+	defer writerGenerations.Flush()
+	defer fileGenerations.Close()
+
+	// The number of epochs to be run
+	numberOfEpochs := 30
+
+	// The number of times/threshold each vertex is allowed to update its label (rho)
+	rho := 50
+
+	// The weight of cross-shard vs workload imbalance in fitness calculation
+	alpha := 0.5
+
+	// The weight of cross-shard vs workload imbalance in score function
+	beta := 0.5
+
+	// The number of iterations of CLPA
+	tau := 100
+
+	// The number of shards
+	numberOfShards := 8
+
+	// The transaction arrival rate
+	arrivalRate := "low"
+
+	// Set number of parallel runs to half the number of cores available
+	numberOfParallelRuns := max(int(runtime.NumCPU()/2), 1)
+
+	// END OF SETUP
+
+	// NOW FOR THE TESTS:
+
+	/* 3 tests are run in total, each with a different mutation rate of the memetic optimiser:
+	no mutation (crossover and local search only), a low mutation rate, and a high mutation rate */
+	for i, mutationRate := range []float64{0, 0.05, 0.2} {
+		test := i + 1
+
+		config := mylpa.DefaultMemeticConfig()
+		config.MutationRate = mutationRate
+
+		log.Printf("Started Test %d/%d - mutation rate = %.2f", test, totalTests, mutationRate)
+
+		runTest(test, runs, numberOfShards, arrivalRate, numberOfEpochs, numberOfParallelRuns, alpha, beta, tau, rho,
+			config, writerResults, writerGenerations)
+	}
+
+	log.Println("*********** TEST SUITE 'Memetic Optimiser seeded by My LPA' FINISHED ***********")
+}
+
+func runTest(test int, runs int, shards int, arrivalRate string, numberOfEpochs int, parallelRuns int,
+	alpha float64, beta float64, tau int, rho int, config mylpa.MemeticConfig, writerResults *csv.Writer,
+	writerGenerations *csv.Writer) {
+
+	// Counter to store the index of the next unused seed
+	nextSeedIndex := 0
+
+	for run := 1; run <= runs; run++ {
+
+		var graph *shared.Graph = nil
+		var myLpaResults [][]*shared.EpochResult
+
+		// Iterate over the epochs
+		for epoch := 1; epoch <= numberOfEpochs; epoch++ {
+
+			// Get the random seeds
+			seeds, err := mylpa.GetSeeds("mylpa/seeds.csv", parallelRuns, nextSeedIndex)
+			if err != nil {
+				log.Fatalf("Failed to load seeds: %v", err)
+			}
+			nextSeedIndex += parallelRuns
+
+			// The label states of all seeds are kept, since they make up the first generation
+			seedsResults, inactiveVertices := mylpa.ShardAllocation("shared/epochs/"+arrivalRate+"_arrival_rate/",
+				shards, epoch, graph, alpha, beta, tau, rho, seeds)
+
+			// Check if results are nil, which can happen when epoch file is not found
+			if seedsResults == nil {
+				continue
+			}
+
+			// Run the memetic optimiser, with a seed of its own for each epoch
+			config.Seed = seeds[0]
+			memeticResult, bestFitness := mylpa.OptimiseMemetic(context.Background(), seedsResults, alpha, beta,
+				rho, config)
+			tests.WriteGenerations(writerGenerations, test, run, epoch, bestFitness)
+
+			// The labelling found by the memetic optimiser is carried over to the next epoch
+			// Add inactive vertices back to graph for the next epoch
+			if memeticResult != nil {
+				seedsResults = append(seedsResults, memeticResult)
+			}
+			graph = tests.BestGraph(seedsResults, inactiveVertices)
+
+			myLpaResults = append(myLpaResults, seedsResults)
+		}
+
+		tests.WriteResults(myLpaResults, writerResults, test, run)
+	}
+	log.Printf("Test finished")
+}
@@ -16,15 +16,22 @@ func RunTestSuite(runs int) {
 
 	log.Printf("*********** TEST SUITE 'Paper Penalty vs New Penalty' STARTED (%d Tests in total) ***********", totalTests)
 
-	writerPaperPen, filePaperPen := tests.CreateResultsWriter("penalty/paper_penalty")
+	// Load the runs finished before the suite was last stopped, so that they are skipped
+	checkpoint := tests.OpenCheckpoint("penalty/checkpoint")
+	resume := checkpoint.Resuming()
+
+	writerPaperPen, filePaperPen := tests.OpenResultsWriter("penalty/paper_penalty", resume)
+	checkpoint.Track(filePaperPen)
 	defer writerPaperPen.Flush()
 	defer filePaperPen.Close()
 
-	writerNewPen, fileNewPen := tests.CreateResultsWriter("penalty/new_penalty")
+	writerNewPen, fileNewPen := tests.OpenResultsWriter("penalty/new_penalty", resume)
+	checkpoint.Track(fileNewPen)
 	defer writerNewPen.Flush()
 	defer fileNewPen.Close()
 
-	writerTimes, fileTimes := tests.CreateTimesWriter("penalty/test_times")
+	writerTimes, fileTimes := tests.OpenTimesWriter("penalty/test_times", resume)
+	checkpoint.Track(fileTimes)
 	defer writerTimes.Flush()
 	defer fileTimes.Close()
 
@@ -67,7 +74,7 @@ func RunTestSuite(runs int) {
 	//TEST 1
 	log.Printf("Started Test %d/%d - beta = %.1f, shards = 8", test, totalTests, beta)
 	runTest(test, runs, numberOfShards, arrivalRate, numberOfEpochs, alpha, beta,
-		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, newPenaltyClpaCall)
+		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, newPenaltyClpaCall, checkpoint)
 	test++
 
 	beta = 0.3
@@ -75,7 +82,7 @@ func RunTestSuite(runs int) {
 	//TEST 2
 	log.Printf("Started Test %d/%d- beta = %.1f, shards = 8", test, totalTests, beta)
 	runTest(test, runs, numberOfShards, arrivalRate, numberOfEpochs, alpha, beta,
-		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, newPenaltyClpaCall)
+		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, newPenaltyClpaCall, checkpoint)
 	test++
 
 	beta = 0.5
@@ -83,7 +90,7 @@ func RunTestSuite(runs int) {
 	//TEST 3
 	log.Printf("Started Test %d/%d - beta = %.1f, shards = 8", test, totalTests, beta)
 	runTest(test, runs, numberOfShards, arrivalRate, numberOfEpochs, alpha, beta,
-		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, newPenaltyClpaCall)
+		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, newPenaltyClpaCall, checkpoint)
 	test++
 
 	beta = 0.7
@@ -91,7 +98,7 @@ func RunTestSuite(runs int) {
 	//TEST 4
 	log.Printf("Started Test %d/%d - beta = %.1f, shards = 8", test, totalTests, beta)
 	runTest(test, runs, numberOfShards, arrivalRate, numberOfEpochs, alpha, beta,
-		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, newPenaltyClpaCall)
+		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, newPenaltyClpaCall, checkpoint)
 	test++
 
 	beta = 0.9
@@ -99,7 +106,7 @@ func RunTestSuite(runs int) {
 	//TEST 5
 	log.Printf("Started Test %d/%d - beta = %.1f, shards = 8", test, totalTests, beta)
 	runTest(test, runs, numberOfShards, arrivalRate, numberOfEpochs, alpha, beta,
-		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, newPenaltyClpaCall)
+		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, newPenaltyClpaCall, checkpoint)
 	test++
 
 	numberOfShards = 16
@@ -108,7 +115,7 @@ func RunTestSuite(runs int) {
 	//TEST 6
 	log.Printf("Started Test %d/%d - beta = %.1f, shards = 16", test, totalTests, beta)
 	runTest(test, runs, numberOfShards, arrivalRate, numberOfEpochs, alpha, beta,
-		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, newPenaltyClpaCall)
+		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, newPenaltyClpaCall, checkpoint)
 	test++
 
 	beta = 0.3
@@ -116,7 +123,7 @@ func RunTestSuite(runs int) {
 	//TEST 7
 	log.Printf("Started Test %d/%d - beta = %.1f, shards = 16", test, totalTests, beta)
 	runTest(test, runs, numberOfShards, arrivalRate, numberOfEpochs, alpha, beta,
-		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, newPenaltyClpaCall)
+		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, newPenaltyClpaCall, checkpoint)
 	test++
 
 	beta = 0.5
@@ -124,7 +131,7 @@ func RunTestSuite(runs int) {
 	//TEST 8
 	log.Printf("Started Test %d/%d - beta = %.1f, shards = 16", test, totalTests, beta)
 	runTest(test, runs, numberOfShards, arrivalRate, numberOfEpochs, alpha, beta,
-		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, newPenaltyClpaCall)
+		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, newPenaltyClpaCall, checkpoint)
 	test++
 
 	beta = 0.7
@@ -132,7 +139,7 @@ func RunTestSuite(runs int) {
 	//TEST 9
 	log.Printf("Started Test %d/%d - beta = %.1f, shards = 16", test, totalTests, beta)
 	runTest(test, runs, numberOfShards, arrivalRate, numberOfEpochs, alpha, beta,
-		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, newPenaltyClpaCall)
+		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, newPenaltyClpaCall, checkpoint)
 	test++
 
 	beta = 0.9
@@ -140,7 +147,7 @@ func RunTestSuite(runs int) {
 	//TEST 10
 	log.Printf("Started Test %d/%d - beta = %.1f, shards = 16", test, totalTests, beta)
 	runTest(test, runs, numberOfShards, arrivalRate, numberOfEpochs, alpha, beta,
-		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, newPenaltyClpaCall)
+		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, newPenaltyClpaCall, checkpoint)
 	test++
 
 	numberOfShards = 24
@@ -149,7 +156,7 @@ func RunTestSuite(runs int) {
 	//TEST 11
 	log.Printf("Started Test %d/%d - beta = %.1f, shards = 24", test, totalTests, beta)
 	runTest(test, runs, numberOfShards, arrivalRate, numberOfEpochs, alpha, beta,
-		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, newPenaltyClpaCall)
+		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, newPenaltyClpaCall, checkpoint)
 	test++
 
 	beta = 0.3
@@ -157,7 +164,7 @@ func RunTestSuite(runs int) {
 	//TEST 12
 	log.Printf("Started Test %d/%d - beta = %.1f, shards = 24", test, totalTests, beta)
 	runTest(test, runs, numberOfShards, arrivalRate, numberOfEpochs, alpha, beta,
-		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, newPenaltyClpaCall)
+		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, newPenaltyClpaCall, checkpoint)
 	test++
 
 	beta = 0.5
@@ -165,7 +172,7 @@ func RunTestSuite(runs int) {
 	//TEST 13
 	log.Printf("Started Test %d/%d - beta = %.1f, shards = 24", test, totalTests, beta)
 	runTest(test, runs, numberOfShards, arrivalRate, numberOfEpochs, alpha, beta,
-		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, newPenaltyClpaCall)
+		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, newPenaltyClpaCall, checkpoint)
 	test++
 
 	beta = 0.7
@@ -173,7 +180,7 @@ func RunTestSuite(runs int) {
 	//TEST 14
 	log.Printf("Started Test %d/%d - beta = %.1f, shards = 24", test, totalTests, beta)
 	runTest(test, runs, numberOfShards, arrivalRate, numberOfEpochs, alpha, beta,
-		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, newPenaltyClpaCall)
+		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, newPenaltyClpaCall, checkpoint)
 	test++
 
 	beta = 0.9
@@ -181,9 +188,12 @@ func RunTestSuite(runs int) {
 	//TEST 15
 	log.Printf("Started Test %d/%d - beta = %.1f, shards = 24", test, totalTests, beta)
 	runTest(test, runs, numberOfShards, arrivalRate, numberOfEpochs, alpha, beta,
-		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, newPenaltyClpaCall)
+		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, newPenaltyClpaCall, checkpoint)
 	test++
 
+	// The whole suite finished, so the next time it is run it starts from the beginning
+	checkpoint.Finish()
+
 	log.Println("*********** TEST SUITE 'Paper Penalty vs New Penalty' FINISHED ***********")
 }
 
@@ -243,7 +253,7 @@ func RunMiniTestSuite(runs int) {
 	//TEST 1
 	log.Printf("Started Test %d/%d - shards = 8", test, totalTests)
 	runTest(test, runs, numberOfShards, arrivalRate, numberOfEpochs, alpha, beta,
-		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, clpaCall)
+		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, clpaCall, nil)
 	test++
 
 	numberOfShards = 16
@@ -251,7 +261,7 @@ func RunMiniTestSuite(runs int) {
 	//TEST 2
 	log.Printf("Started Test %d/%d - shards = 16", test, totalTests)
 	runTest(test, runs, numberOfShards, arrivalRate, numberOfEpochs, alpha, beta,
-		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, clpaCall)
+		tau, rho, runClpaIter, writerPaperPen, writerNewPen, writerTimes, clpaCall, nil)
 	test++
 
 	log.Println("*********** MINI TEST SUITE 'Paper Penalty vs New Penalty (mini)' FINISHED ***********")
@@ -259,10 +269,15 @@ func RunMiniTestSuite(runs int) {
 
 func runTest(test int, runs int, shards int, arrivalRate string, numberOfEpochs int, alpha float64,
 	beta float64, tau int, rho int, runClpaIter paperclpa.ClpaIterationMode, writerPaperPen *csv.Writer,
-	writerNewPen *csv.Writer, writerTimes *csv.Writer, newPenaltyClpaCall paperclpa.ClpaCall) {
+	writerNewPen *csv.Writer, writerTimes *csv.Writer, newPenaltyClpaCall paperclpa.ClpaCall, checkpoint *tests.Checkpoint) {
 
 	for run := 1; run <= runs; run++ {
 
+		// Skip the runs that finished before the suite was last stopped
+		if _, finished := checkpoint.Finished(test, run); finished {
+			continue
+		}
+
 		var graphPaperPen *shared.Graph = nil
 		var graphNewPen *shared.Graph = nil
 
@@ -322,6 +337,9 @@ func runTest(test int, runs int, shards int, arrivalRate string, numberOfEpochs
 		tests.WriteSingleResults(newPenResults, writerNewPen, test, run)
 
 		tests.WriteTimes(writerTimes, test, run, timePaperPen, timePaperNew)
+
+		// Record that the run finished, now that its results were written
+		checkpoint.Record(test, run, 0)
 	}
 	log.Printf("Test finished")
 }
@@ -0,0 +1,160 @@
+package placement
+
+import (
+	"context"
+	"encoding/csv"
+	"log"
+	"runtime"
+	"sort"
+
+	"example.com/shardinglpa/mylpa"
+	"example.com/shardinglpa/paperclpa"
+	"example.com/shardinglpa/shared"
+	"example.com/shardinglpa/tests"
+)
+
+func RunTestSuite(runs int) {
+
+	// The placement policies are sorted by name, so they are always run in the same order
+	policies := make([]string, 0, len(shared.PlacementPolicies))
+	for name := range shared.PlacementPolicies {
+		policies = append(policies, name)
+	}
+	sort.Strings(policies)
+
+	totalTests := 2 * len(policies)
+
+	log.Printf("*********** TEST SUITE 'Initial Placement of New Accounts' STARTED (%d Tests in total) ***********", totalTests)
+
+	// The number of epochs to be run
+	numberOfEpochs := 30
+
+	// The number of times/threshold each vertex is allowed to update its label (rho)
+	rho := 50
+
+	// The weight of cross-shard vs workload imbalance in fitness calculation
+	alpha := 0.5
+
+	// The weight of cross-shard vs workload imbalance in score function
+	beta := 0.5
+
+	// The number of iterations of CLPA
+	tau := 100
+
+	// The number of shards
+	numberOfShards := 8
+
+	// The transaction arrival rate
+	arrivalRate := "low"
+
+	// Set number of parallel runs to half the number of cores available
+	numberOfParallelRuns := max(int(runtime.NumCPU()/2), 1)
+
+	// END OF SETUP
+
+	// NOW FOR THE TESTS:
+
+	/* A test is run for each placement policy with CLPA as in paper, and another with My LPA
+	The results hold the fitness after the new accounts are placed and after the first iteration, besides the final
+	fitness and the iteration of convergence, to measure how the placement affects the speed of convergence */
+	test := 0
+	for _, name := range policies {
+		test++
+
+		log.Printf("Started Test %d/%d - CLPA, placement = %s", test, totalTests, name)
+
+		writer, file := tests.CreateResultsWriter("placement/CLPA_" + name)
+		runPaperTest(test, runs, numberOfShards, arrivalRate, numberOfEpochs, alpha, beta, tau, rho,
+			shared.PlacementPolicies[name], writer)
+		writer.Flush()
+		file.Close()
+	}
+
+	for _, name := range policies {
+		test++
+
+		log.Printf("Started Test %d/%d - My LPA, placement = %s", test, totalTests, name)
+
+		writer, file := tests.CreateResultsWriter("placement/my_LPA_" + name)
+		runMyLpaTest(test, runs, numberOfShards, arrivalRate, numberOfEpochs, numberOfParallelRuns, alpha, beta,
+			tau, rho, shared.PlacementPolicies[name], writer)
+		writer.Flush()
+		file.Close()
+	}
+
+	log.Println("*********** TEST SUITE 'Initial Placement of New Accounts' FINISHED ***********")
+}
+
+func runPaperTest(test int, runs int, shards int, arrivalRate string, numberOfEpochs int, alpha float64,
+	beta float64, tau int, rho int, policy shared.PlacementPolicy, writer *csv.Writer) {
+
+	for run := 1; run <= runs; run++ {
+
+		// The graph is created before the first epoch, so that it holds the placement policy
+		graph := paperclpa.NewGraph(shards, shared.AllocationConfig{Placement: policy})
+
+		var paperClpaResults [][]*shared.EpochResult
+
+		// Iterate over the epochs
+		for epoch := 1; epoch <= numberOfEpochs; epoch++ {
+
+			epochResult := paperclpa.ShardAllocation("shared/epochs/"+arrivalRate+"_arrival_rate/", shards, epoch,
+				graph, alpha, beta, tau, rho, paperclpa.ClpaIterationAsync, paperclpa.RunClpaPaper,
+				paperclpa.CalculateScoresPaper)
+
+			// Check if result is nil, which can happen when epoch file is not found
+			if epochResult == nil {
+				continue
+			}
+
+			graph = epochResult.Graph
+			epochResult.Graph = nil
+			paperClpaResults = append(paperClpaResults, []*shared.EpochResult{epochResult})
+		}
+
+		tests.WriteResults(paperClpaResults, writer, test, run)
+	}
+	log.Printf("Test finished")
+}
+
+func runMyLpaTest(test int, runs int, shards int, arrivalRate string, numberOfEpochs int, parallelRuns int,
+	alpha float64, beta float64, tau int, rho int, policy shared.PlacementPolicy, writer *csv.Writer) {
+
+	// Counter to store the index of the next unused seed
+	// Every policy uses the same seeds, so that they are compared fairly
+	nextSeedIndex := 0
+
+	for run := 1; run <= runs; run++ {
+
+		var graph *shared.Graph = nil
+		var myLpaResults [][]*shared.EpochResult
+
+		// Iterate over the epochs
+		for epoch := 1; epoch <= numberOfEpochs; epoch++ {
+
+			// Get the random seeds
+			seeds, err := mylpa.GetSeeds("mylpa/seeds.csv", parallelRuns, nextSeedIndex)
+			if err != nil {
+				log.Fatalf("Failed to load seeds: %v", err)
+			}
+			nextSeedIndex += parallelRuns
+
+			seedsResults, inactiveVertices := mylpa.ShardAllocationWithConfig(context.Background(),
+				"shared/epochs/"+arrivalRate+"_arrival_rate/", shards, epoch, graph, alpha, beta, tau, rho, seeds,
+				shared.AllocationConfig{Placement: policy})
+
+			// Check if results are nil, which can happen when epoch file is not found
+			if seedsResults == nil {
+				continue
+			}
+
+			// Get the best graph of the parallel runs, with the inactive vertices added back for the next epoch
+			graph = tests.BestGraph(seedsResults, inactiveVertices)
+
+			myLpaResults = append(myLpaResults, seedsResults)
+		}
+
+		tests.WriteResults(myLpaResults, writer, test, run)
+	}
+	log.Printf("Test finished")
+}
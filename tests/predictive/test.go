@@ -0,0 +1,150 @@
+package predictive
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"math/rand"
+	"runtime"
+	"sort"
+
+	"example.com/shardinglpa/mylpa"
+	"example.com/shardinglpa/shared"
+	"example.com/shardinglpa/tests"
+)
+
+func RunTestSuite(runs int) {
+
+	totalTests := 3
+
+	log.Printf("*********** TEST SUITE 'Predictive Evaluation of My LPA' STARTED (%d Tests in total) ***********", totalTests)
+
+	writerResults, fileResults := tests.CreateResultsWriter("predictive/my_LPA")
+	defer writerResults.Flush()
+	defer fileResults.Close()
+
+	writerPredictive, filePredictive := tests.CreatePredictiveWriter("predictive/my_LPA_predictive")
+	defer writerPredictive.Flush()
+	defer filePredictive.Close()
+
+	// The number of epochs to be run
+	numberOfEpochs := 30
+
+	// The number of times/threshold each vertex is allowed to update its label (rho)
+	rho := 50
+
+	// The weight of cross-shard vs workload imbalance in fitness calculation
+	alpha := 0.5
+
+	// The weight of cross-shard vs workload imbalance in score function
+	beta := 0.5
+
+	// The number of iterations of CLPA
+	tau := 100
+
+	// The transaction arrival rate
+	arrivalRate := "low"
+
+	// Set number of parallel runs to half the number of cores available
+	numberOfParallelRuns := max(int(runtime.NumCPU()/2), 1)
+
+	// END OF SETUP
+
+	// NOW FOR THE TESTS:
+
+	/* 3 tests are run in total, one for each number of shards
+	In each test, the allocation of every epoch is evaluated on the next epoch with every placement policy */
+	for i, shards := range []int{8, 16, 24} {
+		test := i + 1
+
+		log.Printf("Started Test %d/%d - shards = %d", test, totalTests, shards)
+
+		runTest(test, runs, shards, arrivalRate, numberOfEpochs, numberOfParallelRuns, alpha, beta, tau, rho,
+			writerResults, writerPredictive)
+	}
+
+	log.Println("*********** TEST SUITE 'Predictive Evaluation of My LPA' FINISHED ***********")
+}
+
+func runTest(test int, runs int, shards int, arrivalRate string, numberOfEpochs int, parallelRuns int,
+	alpha float64, beta float64, tau int, rho int, writerResults *csv.Writer, writerPredictive *csv.Writer) {
+
+	datasetDir := "shared/epochs/" + arrivalRate + "_arrival_rate/"
+
+	// The placement policies are sorted by name, so they are always evaluated in the same order
+	policies := make([]string, 0, len(shared.PlacementPolicies))
+	for name := range shared.PlacementPolicies {
+		policies = append(policies, name)
+	}
+	sort.Strings(policies)
+
+	// Counter to store the index of the next unused seed
+	nextSeedIndex := 0
+
+	for run := 1; run <= runs; run++ {
+
+		var graph *shared.Graph = nil
+		var myLpaResults [][]*shared.EpochResult
+
+		// Iterate over the epochs
+		for epoch := 1; epoch <= numberOfEpochs; epoch++ {
+
+			// Get the random seeds
+			seeds, err := mylpa.GetSeeds("mylpa/seeds.csv", parallelRuns, nextSeedIndex)
+			if err != nil {
+				log.Fatalf("Failed to load seeds: %v", err)
+			}
+			nextSeedIndex += parallelRuns
+
+			seedsResults, inactiveVertices := mylpa.ShardAllocation(datasetDir, shards, epoch, graph,
+				alpha, beta, tau, rho, seeds)
+
+			// Check if results are nil, which can happen when epoch file is not found
+			if seedsResults == nil {
+				continue
+			}
+
+			// Find the in-sample metrics of the best result, before GetBestGraph discards the other results
+			var bestResult *shared.EpochResult
+			for _, result := range seedsResults {
+				if bestResult == nil || result.Fitness < bestResult.Fitness {
+					bestResult = result
+				}
+			}
+
+			// Get the best graph of the parallel runs, with the inactive vertices added back for the next epoch
+			graph = tests.BestGraph(seedsResults, inactiveVertices)
+
+			myLpaResults = append(myLpaResults, seedsResults)
+
+			// Evaluate the allocation on the transactions of the next epoch, if there is one
+			if epoch == numberOfEpochs {
+				continue
+			}
+			nextFilename := fmt.Sprintf("%sepoch_%d.csv", datasetDir, epoch+1)
+			nextRows, err := shared.ReadCSV(nextFilename)
+			if err != nil {
+				log.Printf("Error reading CSV %s: %v\n", nextFilename, err)
+				continue
+			}
+
+			for _, name := range policies {
+
+				// Use the same random generator for every policy, so that they are compared fairly
+				randomGen := rand.New(rand.NewSource(seeds[0]))
+
+				outOfSample, err := shared.EvaluateOnNextEpoch(graph, nextRows, alpha, shared.PlacementPolicies[name],
+					randomGen)
+				if err != nil {
+					log.Printf("Error evaluating epoch %d on the next epoch: %v\n", epoch, err)
+					continue
+				}
+
+				tests.WritePredictive(writerPredictive, test, run, epoch, name, bestResult.Metrics, outOfSample)
+			}
+		}
+
+		tests.WriteResults(myLpaResults, writerResults, test, run)
+	}
+	log.Printf("Test finished")
+}
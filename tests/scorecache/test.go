@@ -0,0 +1,181 @@
+package scorecache
+
+import (
+	"encoding/csv"
+	"log"
+	"runtime"
+	"time"
+
+	"example.com/shardinglpa/clpaparallel"
+	"example.com/shardinglpa/mylpa"
+	"example.com/shardinglpa/shared"
+	"example.com/shardinglpa/tests"
+)
+
+func RunTestSuite(runs int) {
+
+	/* A test is run for each number of shards, since scanning the edges of a vertex for every shard costs more the
+	more shards there are. In each test, CLPA in parallel and My LPA are run with the edges scanned (the baseline)
+	and with the cached weight of the edges to each shard, which give the same results
+	The times of the baseline are recorded as timeBaseline, and the times with the cache as timeNew1 */
+	shardsForTests := []int{16, 24}
+
+	totalTests := len(shardsForTests)
+
+	log.Printf("*********** TEST SUITE 'Scanned vs Cached Neighbour Weights in Scoring' STARTED (%d Tests in total) ***********", totalTests)
+
+	writerParallel, fileParallel := tests.CreateResultsWriter("scorecache/CLPA_parallel")
+	defer writerParallel.Flush()
+	defer fileParallel.Close()
+
+	writerParallelCache, fileParallelCache := tests.CreateResultsWriter("scorecache/CLPA_parallel_cache")
+	defer writerParallelCache.Flush()
+	defer fileParallelCache.Close()
+
+	writerMyLpa, fileMyLpa := tests.CreateResultsWriter("scorecache/my_LPA")
+	defer writerMyLpa.Flush()
+	defer fileMyLpa.Close()
+
+	writerMyLpaCache, fileMyLpaCache := tests.CreateResultsWriter("scorecache/my_LPA_cache")
+	defer writerMyLpaCache.Flush()
+	defer fileMyLpaCache.Close()
+
+	writerTimesParallel, fileTimesParallel := tests.CreateTimesWriter("scorecache/CLPA_parallel_times")
+	defer writerTimesParallel.Flush()
+	defer fileTimesParallel.Close()
+
+	writerTimesMyLpa, fileTimesMyLpa := tests.CreateTimesWriter("scorecache/my_LPA_times")
+	defer writerTimesMyLpa.Flush()
+	defer fileTimesMyLpa.Close()
+
+	// The number of epochs to be run
+	numberOfEpochs := 30
+
+	// The number of times/threshold each vertex is allowed to update its label (rho)
+	rho := 50
+
+	// The weight of cross-shard vs workload imbalance in fitness calculation
+	alpha := 0.5
+
+	// The weight of cross-shard vs workload imbalance in score function
+	beta := 0.5
+
+	// The number of iterations of CLPA
+	tau := 100
+
+	// The transaction arrival rate
+	arrivalRate := "low"
+
+	// Set number of parallel runs to half the number of cores available
+	numberOfParallelRuns := max(int(runtime.NumCPU()/2), 1)
+
+	// END OF SETUP
+
+	// NOW FOR THE TESTS:
+
+	for i, numberOfShards := range shardsForTests {
+		test := i + 1
+
+		log.Printf("Started Test %d/%d - shards = %d", test, totalTests, numberOfShards)
+
+		runTest(test, runs, numberOfShards, arrivalRate, numberOfEpochs, numberOfParallelRuns, alpha, beta, tau, rho,
+			writerParallel, writerParallelCache, writerMyLpa, writerMyLpaCache, writerTimesParallel,
+			writerTimesMyLpa)
+	}
+
+	log.Println("*********** TEST SUITE 'Scanned vs Cached Neighbour Weights in Scoring' FINISHED ***********")
+}
+
+func runTest(test int, runs int, shards int, arrivalRate string, numberOfEpochs int, parallelRuns int,
+	alpha float64, beta float64, tau int, rho int, writerParallel *csv.Writer, writerParallelCache *csv.Writer,
+	writerMyLpa *csv.Writer, writerMyLpaCache *csv.Writer, writerTimesParallel *csv.Writer,
+	writerTimesMyLpa *csv.Writer) {
+
+	datasetDir := "shared/epochs/" + arrivalRate + "_arrival_rate/"
+
+	// The baseline scans the edges of each vertex, and the other variant uses the cache
+	baselineConfig := shared.AllocationConfig{NoNeighbourWeightCache: true}
+	cacheConfig := shared.AllocationConfig{}
+
+	// Counter to store the index of the next unused seed
+	nextSeedIndex := 0
+
+	for run := 1; run <= runs; run++ {
+
+		var graphParallel, graphParallelCache *shared.Graph
+		var graphMyLpa, graphMyLpaCache *shared.Graph
+
+		var parallelResults, parallelCacheResults [][]*shared.EpochResult
+		var myLpaResults, myLpaCacheResults [][]*shared.EpochResult
+
+		var timeParallel, timeParallelCache []float64
+		var timeMyLpa, timeMyLpaCache []float64
+
+		// Iterate over the epochs
+		for epoch := 1; epoch <= numberOfEpochs; epoch++ {
+
+			// Get the random seeds, which are the same for all variants
+			seeds, err := mylpa.GetSeeds("mylpa/seeds.csv", parallelRuns, nextSeedIndex)
+			if err != nil {
+				log.Fatalf("Failed to load seeds: %v", err)
+			}
+			nextSeedIndex += parallelRuns
+
+			// CLPA in parallel, scanning the edges and with the cache
+
+			seedsResults, graph, seconds := runEpoch(clpaparallel.ShardAllocationWithConfig, datasetDir, shards,
+				epoch, graphParallel, alpha, beta, tau, rho, seeds, baselineConfig)
+
+			// Check if results are nil, which can happen when epoch file is not found
+			if seedsResults == nil {
+				continue
+			}
+			graphParallel = graph
+			parallelResults = append(parallelResults, seedsResults)
+			timeParallel = append(timeParallel, seconds)
+
+			seedsResults, graph, seconds = runEpoch(clpaparallel.ShardAllocationWithConfig, datasetDir, shards,
+				epoch, graphParallelCache, alpha, beta, tau, rho, seeds, cacheConfig)
+			graphParallelCache = graph
+			parallelCacheResults = append(parallelCacheResults, seedsResults)
+			timeParallelCache = append(timeParallelCache, seconds)
+
+			// My LPA, scanning the edges and with the cache
+
+			seedsResults, graph, seconds = runEpoch(mylpa.ShardAllocationWithConfig, datasetDir, shards, epoch,
+				graphMyLpa, alpha, beta, tau, rho, seeds, baselineConfig)
+			graphMyLpa = graph
+			myLpaResults = append(myLpaResults, seedsResults)
+			timeMyLpa = append(timeMyLpa, seconds)
+
+			seedsResults, graph, seconds = runEpoch(mylpa.ShardAllocationWithConfig, datasetDir, shards, epoch,
+				graphMyLpaCache, alpha, beta, tau, rho, seeds, cacheConfig)
+			graphMyLpaCache = graph
+			myLpaCacheResults = append(myLpaCacheResults, seedsResults)
+			timeMyLpaCache = append(timeMyLpaCache, seconds)
+		}
+
+		tests.WriteResults(parallelResults, writerParallel, test, run)
+		tests.WriteResults(parallelCacheResults, writerParallelCache, test, run)
+		tests.WriteResults(myLpaResults, writerMyLpa, test, run)
+		tests.WriteResults(myLpaCacheResults, writerMyLpaCache, test, run)
+
+		tests.WriteTimes(writerTimesParallel, test, run, timeParallel, timeParallelCache)
+		tests.WriteTimes(writerTimesMyLpa, test, run, timeMyLpa, timeMyLpaCache)
+	}
+	log.Printf("Test finished")
+}
+
+// runEpoch runs a variant for a single epoch on the graph of the previous epoch
+// It returns the results of the seeds, the best graph with the inactive vertices added back, and the seconds it took
+func runEpoch(allocate tests.SeedsAllocation, datasetDir string, shards int, epoch int, graph *shared.Graph,
+	alpha float64, beta float64, tau int, rho int, seeds []int64,
+	config shared.AllocationConfig) ([]*shared.EpochResult, *shared.Graph, float64) {
+
+	start := time.Now()
+
+	seedsResults, graph := tests.RunSeedsEpoch(allocate, datasetDir, shards, epoch, graph, alpha, beta, tau, rho, seeds,
+		config)
+
+	return seedsResults, graph, time.Since(start).Seconds()
+}
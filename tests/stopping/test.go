@@ -0,0 +1,142 @@
+package stopping
+
+import (
+	"context"
+	"encoding/csv"
+	"log"
+	"runtime"
+
+	"example.com/shardinglpa/mylpa"
+	"example.com/shardinglpa/paperclpa"
+	"example.com/shardinglpa/shared"
+	"example.com/shardinglpa/tests"
+)
+
+func RunTestSuite(runs int) {
+
+	/* A test is run for each set of stopping rules: stopping only once no label changes, once fewer than 0.1% or 1%
+	of the vertices move, once the fitness has not improved by 0.1% over 5 iterations, and once the only vertices
+	that move go back to a label they had in the last 2 iterations
+	My LPA runs at least 5 iterations with every rule, as it does by default
+	The iteration and the rule that stopped each result are recorded in the results */
+	rulesForTests := []shared.StoppingRules{
+		shared.DefaultStoppingRules(),
+		{MovedFraction: 0.001},
+		{MovedFraction: 0.01},
+		{PlateauIterations: 5, PlateauTolerance: 0.001},
+		{OscillationWindow: 2},
+	}
+
+	totalTests := len(rulesForTests)
+
+	log.Printf("*********** TEST SUITE 'Stopping Rules of CLPA and My LPA' STARTED (%d Tests in total) ***********", totalTests)
+
+	writerPaper, filePaper := tests.CreateResultsWriter("stopping/CLPA")
+	defer writerPaper.Flush()
+	defer filePaper.Close()
+
+	writerMyLpa, fileMyLpa := tests.CreateResultsWriter("stopping/my_LPA")
+	defer writerMyLpa.Flush()
+	defer fileMyLpa.Close()
+
+	// The number of epochs to be run
+	numberOfEpochs := 30
+
+	// The number of times/threshold each vertex is allowed to update its label (rho)
+	rho := 50
+
+	// The weight of cross-shard vs workload imbalance in fitness calculation
+	alpha := 0.5
+
+	// The weight of cross-shard vs workload imbalance in score function
+	beta := 0.5
+
+	// The number of iterations of CLPA
+	tau := 100
+
+	// The number of shards
+	numberOfShards := 8
+
+	// The transaction arrival rate
+	arrivalRate := "low"
+
+	// Set number of parallel runs to half the number of cores available
+	numberOfParallelRuns := max(int(runtime.NumCPU()/2), 1)
+
+	// END OF SETUP
+
+	// NOW FOR THE TESTS:
+
+	for i, rules := range rulesForTests {
+		test := i + 1
+
+		log.Printf("Started Test %d/%d - stopping rules = %+v", test, totalTests, rules)
+
+		runTest(test, runs, numberOfShards, arrivalRate, numberOfEpochs, numberOfParallelRuns, alpha, beta, tau, rho,
+			rules, writerPaper, writerMyLpa)
+	}
+
+	log.Println("*********** TEST SUITE 'Stopping Rules of CLPA and My LPA' FINISHED ***********")
+}
+
+func runTest(test int, runs int, shards int, arrivalRate string, numberOfEpochs int, parallelRuns int,
+	alpha float64, beta float64, tau int, rho int, rules shared.StoppingRules, writerPaper *csv.Writer,
+	writerMyLpa *csv.Writer) {
+
+	datasetDir := "shared/epochs/" + arrivalRate + "_arrival_rate/"
+
+	// Counter to store the index of the next unused seed
+	// Every set of rules uses the same seeds, so that they are compared fairly
+	nextSeedIndex := 0
+
+	for run := 1; run <= runs; run++ {
+
+		var graphPaper *shared.Graph = nil
+		var graphMyLpa *shared.Graph = nil
+
+		var paperResults []*shared.EpochResult
+		var myLpaResults [][]*shared.EpochResult
+
+		// Iterate over the epochs
+		for epoch := 1; epoch <= numberOfEpochs; epoch++ {
+
+			// CLPA as in paper, stopping once a rule fires
+
+			epochResult := paperclpa.ShardAllocation(datasetDir, shards, epoch, graphPaper, alpha, beta, tau, rho,
+				paperclpa.ClpaIterationAsync, paperclpa.NewRunClpaConvergenceStop(rules),
+				paperclpa.CalculateScoresPaper)
+
+			// Check if result is nil, which can happen when epoch file is not found. If so, continue to next iteration
+			if epochResult == nil {
+				continue
+			}
+			graphPaper = epochResult.Graph
+			epochResult.Graph = nil
+			paperResults = append(paperResults, epochResult)
+
+			// My LPA, stopping once a rule fires
+
+			// Get the random seeds
+			seeds, err := mylpa.GetSeeds("mylpa/seeds.csv", parallelRuns, nextSeedIndex)
+			if err != nil {
+				log.Fatalf("Failed to load seeds: %v", err)
+			}
+			nextSeedIndex += parallelRuns
+
+			seedsResults, inactiveVertices := mylpa.ShardAllocationWithConfig(context.Background(), datasetDir,
+				shards, epoch, graphMyLpa, alpha, beta, tau, rho, seeds, shared.AllocationConfig{Stopping: &rules})
+			if seedsResults == nil {
+				continue
+			}
+
+			// Get the best graph of the parallel runs, with the inactive vertices added back for the next epoch
+			graphMyLpa = tests.BestGraph(seedsResults, inactiveVertices)
+
+			myLpaResults = append(myLpaResults, seedsResults)
+		}
+
+		tests.WriteSingleResults(paperResults, writerPaper, test, run)
+		tests.WriteResults(myLpaResults, writerMyLpa, test, run)
+	}
+	log.Printf("Test finished")
+}
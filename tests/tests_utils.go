@@ -1,24 +1,69 @@
 package tests
 
 import (
+	"context"
 	"encoding/csv"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"slices"
 	"strconv"
+	"strings"
 
 	"example.com/shardinglpa/shared"
 )
 
 // createResultsWriter creates a CSV file, writes the header, and returns the CSV writer
 func CreateResultsWriter(filename string) (*csv.Writer, *os.File) {
+	return OpenResultsWriter(filename, false)
+}
+
+// OpenResultsWriter is like CreateResultsWriter, but if resume is true, the results are appended to the CSV file
+// left by a test suite that was stopped, instead of the file being truncated
+func OpenResultsWriter(filename string, resume bool) (*csv.Writer, *os.File) {
 
 	// CSV header for recording epoch results
-	header := []string{"test", "run", "seed", "epoch", "fitness", "workloadImbalance", "crossShardWorkload", "convergenceIterations"}
+	header := []string{"test", "run", "seed", "epoch", "fitness", "workloadImbalance", "crossShardWorkload", "convergenceIterations",
+		"crossShardRatio", "workloadStdDev", "workloadCV", "maxMeanLoadRatio", "gini",
+		"shardIntraWorkloads", "shardCrossWorkloads", "initialFitness", "firstIterFitness",
+		"votePolicy", "stopReason"}
 	//"TimeRan" is removed
 
+	return openWriter(filename, header, resume)
+}
+
+// createTimesWriter creates a CSV file, writes the header, and returns the CSV writer
+func CreateTimesWriter(filename string) (*csv.Writer, *os.File) {
+	return OpenTimesWriter(filename, false)
+}
+
+// OpenTimesWriter is like CreateTimesWriter, but if resume is true, the times are appended to the CSV file
+// left by a test suite that was stopped, instead of the file being truncated
+func OpenTimesWriter(filename string, resume bool) (*csv.Writer, *os.File) {
+
+	// CSV header for recording test times
+	header := []string{"test", "run", "epoch", "timeBaseline", "timeNew1", "timeNew2"}
+
+	return openWriter(filename, header, resume)
+}
+
+// openWriter creates or appends to a CSV file, writes the header if the file is new, and returns the CSV writer
+// When appending, the header of the existing file must match, so that rows of different widths are never mixed
+func openWriter(filename string, header []string, resume bool) (*csv.Writer, *os.File) {
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resume {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+
 	filePath := fmt.Sprintf("tests/%s.csv", filename)
-	file, err := os.Create(filePath)
+	if resume {
+		checkHeader(filePath, header)
+	}
+
+	file, err := os.OpenFile(filePath, flags, 0666)
 	if err != nil {
 		log.Fatalf("Failed to create CSV file '%s': %v\n", filename, err)
 	}
@@ -26,19 +71,48 @@ func CreateResultsWriter(filename string) (*csv.Writer, *os.File) {
 	// Create the writer, so it can then be passed on
 	writer := csv.NewWriter(file)
 
-	// Write the header
-	if err := writer.Write(header); err != nil {
-		log.Fatalf("Error writing header to '%s': %v\n", filename, err)
+	// Write the header, unless results are being appended to an existing file
+	info, err := file.Stat()
+	if err != nil {
+		log.Fatalf("Failed to read CSV file '%s': %v\n", filename, err)
+	}
+	if info.Size() == 0 {
+		if err := writer.Write(header); err != nil {
+			log.Fatalf("Error writing header to '%s': %v\n", filename, err)
+		}
 	}
 
 	return writer, file
 }
 
-// createTimesWriter creates a CSV file, writes the header, and returns the CSV writer
-func CreateTimesWriter(filename string) (*csv.Writer, *os.File) {
+// checkHeader stops the test suite if the CSV file exists and its header is not the expected one, which happens when
+// a suite is resumed with results written by an older version with different columns
+func checkHeader(filePath string, header []string) {
 
-	// CSV header for recording test times
-	header := []string{"test", "run", "epoch", "timeBaseline", "timeNew1", "timeNew2"}
+	file, err := os.Open(filePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Fatalf("Failed to open CSV file '%s': %v\n", filePath, err)
+	}
+	defer file.Close()
+
+	existing, err := csv.NewReader(file).Read()
+	if err == io.EOF {
+		return
+	}
+	if err != nil || !slices.Equal(existing, header) {
+		log.Fatalf("Cannot resume '%s': its header %v does not match the columns %v written now (move the file "+
+			"away or delete the checkpoint to start again)\n", filePath, existing, header)
+	}
+}
+
+// createStabilityWriter creates a CSV file, writes the header, and returns the CSV writer
+func CreateStabilityWriter(filename string) (*csv.Writer, *os.File) {
+
+	// CSV header for recording how many vertices moved shard from one epoch to the next
+	header := []string{"test", "run", "epoch", "movedVertices", "comparedVertices", "movedFraction"}
 
 	filePath := fmt.Sprintf("tests/%s.csv", filename)
 	file, err := os.Create(filePath)
@@ -57,6 +131,27 @@ func CreateTimesWriter(filename string) (*csv.Writer, *os.File) {
 	return writer, file
 }
 
+// createPredictiveWriter creates a CSV file, writes the header, and returns the CSV writer
+func CreatePredictiveWriter(filename string) (*csv.Writer, *os.File) {
+
+	// CSV header for recording the in-sample and out-of-sample metrics of the allocation of each epoch
+	header := []string{"test", "run", "epoch", "policy", "newAccounts",
+		"inSampleFitness", "inSampleWorkloadImbalance", "inSampleCrossShardWorkload", "inSampleCrossShardRatio",
+		"outOfSampleFitness", "outOfSampleWorkloadImbalance", "outOfSampleCrossShardWorkload", "outOfSampleCrossShardRatio"}
+
+	return openWriter(filename, header, false)
+}
+
+// createGenerationsWriter creates a CSV file, writes the header, and returns the CSV writer
+func CreateGenerationsWriter(filename string) (*csv.Writer, *os.File) {
+
+	// CSV header for recording the best fitness of each generation of the memetic optimiser
+	// Generation 0 is the best seed, and the improvement is relative to it
+	header := []string{"test", "run", "epoch", "generation", "bestFitness", "improvement"}
+
+	return openWriter(filename, header, false)
+}
+
 // Wrapper function used to prepare the results in the right format for the WriteResults function
 func WriteSingleResults(results []*shared.EpochResult, writer *csv.Writer, test int, run int) {
 
@@ -89,6 +184,9 @@ func WriteResults(groupedResults [][]*shared.EpochResult, writer *csv.Writer, te
 				strconv.Itoa(result.CrossShardWorkload),
 				strconv.Itoa(result.ConvergenceIter),
 			}
+			record = append(record, metricsRecord(result.Metrics)...)
+			record = append(record, fmt.Sprintf("%.3f", result.InitialFitness),
+				fmt.Sprintf("%.3f", result.FirstIterFitness), result.VotePolicy, result.StopReason)
 
 			if err := writer.Write(record); err != nil {
 				log.Printf("Error writing record to CSV: %v", err)
@@ -103,6 +201,34 @@ func WriteResults(groupedResults [][]*shared.EpochResult, writer *csv.Writer, te
 
 }
 
+// Function to prepare the columns of the further metrics of a result
+// The columns are left empty if the result has no metrics
+func metricsRecord(metrics *shared.Metrics) []string {
+
+	if metrics == nil {
+		return make([]string, 7)
+	}
+
+	return []string{
+		fmt.Sprintf("%.6f", metrics.CrossShardRatio),
+		fmt.Sprintf("%.3f", metrics.WorkloadStdDev),
+		fmt.Sprintf("%.6f", metrics.WorkloadCV),
+		fmt.Sprintf("%.6f", metrics.MaxMeanLoadRatio),
+		fmt.Sprintf("%.6f", metrics.Gini),
+		joinInts(metrics.ShardIntraWorkloads),
+		joinInts(metrics.ShardCrossWorkloads),
+	}
+}
+
+// Function to join the values of each shard into one column, separated by semicolons
+func joinInts(values []int) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		parts[i] = strconv.Itoa(value)
+	}
+	return strings.Join(parts, ";")
+}
+
 func WriteTimes(writer *csv.Writer, test int, run int, timesBaseline []float64,
 	timesNew []float64) {
 
@@ -168,3 +294,164 @@ func WriteThreeTimes(writer *csv.Writer, test int, run int, timesBaseline []floa
 		log.Printf("Error flushing Time CSV writer: %v", err)
 	}
 }
+
+func WriteStability(writer *csv.Writer, test int, run int, moved []int, compared []int) {
+
+	// Ensure both slices have the same length to avoid index out-of-bounds errors
+	if len(moved) != len(compared) {
+		log.Printf("Mismatched slice lengths: moved=%d, compared=%d", len(moved), len(compared))
+		return
+	}
+
+	for i := 0; i < len(moved); i++ {
+
+		// The fraction of vertices that moved is left at 0 when no vertex could be compared (first epoch)
+		movedFraction := 0.0
+		if compared[i] > 0 {
+			movedFraction = float64(moved[i]) / float64(compared[i])
+		}
+
+		// Prepare row for writing to csv
+		record := []string{
+			strconv.Itoa(test),
+			strconv.Itoa(run),
+			strconv.Itoa(i + 1), // epoch index (1-based)
+			strconv.Itoa(moved[i]),
+			strconv.Itoa(compared[i]),
+			fmt.Sprintf("%.6f", movedFraction),
+		}
+
+		if err := writer.Write(record); err != nil {
+			log.Printf("Error writing row to Stability CSV: %v", err)
+		}
+	}
+
+	writer.Flush()
+
+	if err := writer.Error(); err != nil {
+		log.Printf("Error flushing Stability CSV writer: %v", err)
+	}
+}
+
+// Function to write the in-sample and out-of-sample metrics of the allocation of an epoch to csv
+func WritePredictive(writer *csv.Writer, test int, run int, epoch int, policy string, inSample *shared.Metrics,
+	outOfSample *shared.PredictiveResult) {
+
+	// Prepare row for writing to csv
+	record := []string{
+		strconv.Itoa(test),
+		strconv.Itoa(run),
+		strconv.Itoa(epoch),
+		policy,
+		strconv.Itoa(outOfSample.NewAccounts),
+		fmt.Sprintf("%.3f", inSample.Fitness),
+		fmt.Sprintf("%.3f", inSample.WorkloadImbalance),
+		strconv.Itoa(inSample.CrossShardWorkload),
+		fmt.Sprintf("%.6f", inSample.CrossShardRatio),
+		fmt.Sprintf("%.3f", outOfSample.Metrics.Fitness),
+		fmt.Sprintf("%.3f", outOfSample.Metrics.WorkloadImbalance),
+		strconv.Itoa(outOfSample.Metrics.CrossShardWorkload),
+		fmt.Sprintf("%.6f", outOfSample.Metrics.CrossShardRatio),
+	}
+
+	if err := writer.Write(record); err != nil {
+		log.Printf("Error writing row to Predictive CSV: %v", err)
+	}
+
+	writer.Flush()
+
+	if err := writer.Error(); err != nil {
+		log.Printf("Error flushing Predictive CSV writer: %v", err)
+	}
+}
+
+// Function to write the best fitness of each generation of the memetic optimiser for an epoch to csv
+func WriteGenerations(writer *csv.Writer, test int, run int, epoch int, bestFitness []float64) {
+
+	for generation, fitness := range bestFitness {
+
+		// The improvement is the fraction by which the fitness dropped below the fitness of the best seed
+		improvement := 0.0
+		if bestFitness[0] > 0 {
+			improvement = (bestFitness[0] - fitness) / bestFitness[0]
+		}
+
+		// Prepare row for writing to csv
+		record := []string{
+			strconv.Itoa(test),
+			strconv.Itoa(run),
+			strconv.Itoa(epoch),
+			strconv.Itoa(generation),
+			fmt.Sprintf("%.3f", fitness),
+			fmt.Sprintf("%.6f", improvement),
+		}
+
+		if err := writer.Write(record); err != nil {
+			log.Printf("Error writing row to Generations CSV: %v", err)
+		}
+	}
+
+	writer.Flush()
+
+	if err := writer.Error(); err != nil {
+		log.Printf("Error flushing Generations CSV writer: %v", err)
+	}
+}
+
+// SeedsAllocation is the allocation of an epoch with several seeds, as done by the ShardAllocationWithConfig function
+// of mylpa and clpaparallel, which returns the results of the seeds and the vertices left out as inactive
+type SeedsAllocation func(ctx context.Context, datasetDir string, shards int, epoch int, graph *shared.Graph,
+	alpha float64, beta float64, tau int, rho int, seeds []int64,
+	config shared.AllocationConfig) ([]*shared.EpochResult, map[string]*shared.Vertex)
+
+// BestGraph gets the best graph from all of the parallel runs of an epoch, and adds the inactive vertices back to it
+// for the next epoch
+// Only the best graph has the vertices added back to save resources
+func BestGraph(seedsResults []*shared.EpochResult, inactiveVertices map[string]*shared.Vertex) *shared.Graph {
+
+	graph := shared.GetBestGraph(seedsResults)
+	for id, vertex := range inactiveVertices {
+		graph.Vertices[id] = vertex
+	}
+
+	return graph
+}
+
+// RunSeedsEpoch runs an allocation with several seeds for a single epoch on the graph of the previous epoch
+// It returns the results of the seeds and the best graph with the inactive vertices added back, or no results and
+// the graph of the previous epoch if the epoch file was not found
+func RunSeedsEpoch(allocate SeedsAllocation, datasetDir string, shards int, epoch int, graph *shared.Graph,
+	alpha float64, beta float64, tau int, rho int, seeds []int64,
+	config shared.AllocationConfig) ([]*shared.EpochResult, *shared.Graph) {
+
+	seedsResults, inactiveVertices := allocate(context.Background(), datasetDir, shards, epoch, graph, alpha, beta,
+		tau, rho, seeds, config)
+	if seedsResults == nil {
+		return nil, graph
+	}
+
+	return seedsResults, BestGraph(seedsResults, inactiveVertices)
+}
+
+// RunSeedsEpochCountingMoves is like RunSeedsEpoch, and also returns how many vertices moved shard compared to the
+// previous epoch, and how many vertices were compared
+func RunSeedsEpochCountingMoves(allocate SeedsAllocation, datasetDir string, shards int, epoch int,
+	graph *shared.Graph, alpha float64, beta float64, tau int, rho int, seeds []int64,
+	config shared.AllocationConfig) ([]*shared.EpochResult, *shared.Graph, int, int) {
+
+	// Record the labels of the previous epoch, to count how many vertices move
+	var labelsBefore map[string]int
+	if graph != nil {
+		labelsBefore = shared.SnapshotLabels(graph)
+	}
+
+	seedsResults, bestGraph := RunSeedsEpoch(allocate, datasetDir, shards, epoch, graph, alpha, beta, tau, rho, seeds,
+		config)
+	if seedsResults == nil {
+		return nil, graph, 0, 0
+	}
+
+	moved, compared := shared.CountMovedVertices(labelsBefore, bestGraph)
+
+	return seedsResults, bestGraph, moved, compared
+}
@@ -182,14 +182,8 @@ func runTest(test int, runs int, shards int, arrivalRate string, numberOfEpochs
 			seedsResults, inactiveVertices := clpaparallel.ShardAllocation("shared/epochs/"+arrivalRate+"_arrival_rate/",
 				shards, epoch, graphParallel, alpha, beta, tau, rho, seeds)
 
-			// Get the best graph from all of the parallel runs
-			graphParallel = shared.GetBestGraph(seedsResults)
-
-			// Add inactive vertices back to graph for the next epoch
-			// Only the best graph has the vertices added back to save resources
-			for id, vertex := range inactiveVertices {
-				graphParallel.Vertices[id] = vertex
-			}
+			// Get the best graph of the parallel runs, with the inactive vertices added back for the next epoch
+			graphParallel = tests.BestGraph(seedsResults, inactiveVertices)
 
 			// Append the time and epoch results to the slices
 			timeParallel = append(timeParallel, time.Since(start).Seconds())
@@ -19,19 +19,27 @@ func RunTestSuite(runs int) {
 
 	log.Printf("*********** TEST SUITE 'CLPA vs Parallel CLPA vs My LPA' STARTED (%d Tests in total) ***********", totalTests)
 
-	writerPaper, filePaper := tests.CreateResultsWriter("threepart/paper_CLPA")
+	// Load the runs finished before the suite was last stopped, so that they are skipped
+	checkpoint := tests.OpenCheckpoint("threepart/checkpoint")
+	resume := checkpoint.Resuming()
+
+	writerPaper, filePaper := tests.OpenResultsWriter("threepart/paper_CLPA", resume)
+	checkpoint.Track(filePaper)
 	defer writerPaper.Flush()
 	defer filePaper.Close()
 
-	writerPaperParallel, filePaperParallel := tests.CreateResultsWriter("threepart/paper_CLPA_parallel")
+	writerPaperParallel, filePaperParallel := tests.OpenResultsWriter("threepart/paper_CLPA_parallel", resume)
+	checkpoint.Track(filePaperParallel)
 	defer writerPaperParallel.Flush()
 	defer filePaperParallel.Close()
 
-	writerFinal, fileFinal := tests.CreateResultsWriter("threepart/my_LPA")
+	writerFinal, fileFinal := tests.OpenResultsWriter("threepart/my_LPA", resume)
+	checkpoint.Track(fileFinal)
 	defer writerFinal.Flush()
 	defer fileFinal.Close()
 
-	writerTimes, fileTimes := tests.CreateTimesWriter("threepart/test_times")
+	writerTimes, fileTimes := tests.OpenTimesWriter("threepart/test_times", resume)
+	checkpoint.Track(fileTimes)
 	defer writerTimes.Flush()
 	defer fileTimes.Close()
 
@@ -71,21 +79,24 @@ func RunTestSuite(runs int) {
 
 	// 8 shards
 	test = runBatchTests(test, totalTests, runs, 8, "low", numberOfEpochsLow, betas, numberOfParallelRuns,
-		halfCores, alpha, tau, rho, runClpaIter, writerPaper, writerPaperParallel, writerFinal, writerTimes)
+		halfCores, alpha, tau, rho, runClpaIter, writerPaper, writerPaperParallel, writerFinal, writerTimes, checkpoint)
 	test = runBatchTests(test, totalTests, runs, 8, "high", numberOfEpochsHigh, betas, numberOfParallelRuns,
-		halfCores, alpha, tau, rho, runClpaIter, writerPaper, writerPaperParallel, writerFinal, writerTimes)
+		halfCores, alpha, tau, rho, runClpaIter, writerPaper, writerPaperParallel, writerFinal, writerTimes, checkpoint)
 
 	// 16 shards
 	test = runBatchTests(test, totalTests, runs, 16, "low", numberOfEpochsLow, betas, numberOfParallelRuns,
-		halfCores, alpha, tau, rho, runClpaIter, writerPaper, writerPaperParallel, writerFinal, writerTimes)
+		halfCores, alpha, tau, rho, runClpaIter, writerPaper, writerPaperParallel, writerFinal, writerTimes, checkpoint)
 	test = runBatchTests(test, totalTests, runs, 16, "high", numberOfEpochsHigh, betas, numberOfParallelRuns,
-		halfCores, alpha, tau, rho, runClpaIter, writerPaper, writerPaperParallel, writerFinal, writerTimes)
+		halfCores, alpha, tau, rho, runClpaIter, writerPaper, writerPaperParallel, writerFinal, writerTimes, checkpoint)
 
 	// 24 shards
 	test = runBatchTests(test, totalTests, runs, 24, "low", numberOfEpochsLow, betas, numberOfParallelRuns,
-		halfCores, alpha, tau, rho, runClpaIter, writerPaper, writerPaperParallel, writerFinal, writerTimes)
+		halfCores, alpha, tau, rho, runClpaIter, writerPaper, writerPaperParallel, writerFinal, writerTimes, checkpoint)
 	test = runBatchTests(test, totalTests, runs, 24, "high", numberOfEpochsHigh, betas, numberOfParallelRuns,
-		halfCores, alpha, tau, rho, runClpaIter, writerPaper, writerPaperParallel, writerFinal, writerTimes)
+		halfCores, alpha, tau, rho, runClpaIter, writerPaper, writerPaperParallel, writerFinal, writerTimes, checkpoint)
+
+	// The whole suite finished, so the next time it is run it starts from the beginning
+	checkpoint.Finish()
 
 	log.Println("*********** TEST SUITE 'CLPA vs Parallel CLPA vs My LPA' FINISHED ***********")
 }
@@ -95,7 +106,7 @@ func RunTestSuite(runs int) {
 // The function returns the updated test counter after all tests are completed.
 func runBatchTests(startTest int, totalTests int, runs int, shards int, arrival string, epochs int, betas []float64,
 	numberOfParallelRuns int, halfCores bool, alpha float64, tau int, rho int, runClpaIter paperclpa.ClpaIterationMode,
-	writerPaper, writerPaperParallel, writerFinal, writerTimes *csv.Writer) int {
+	writerPaper, writerPaperParallel, writerFinal, writerTimes *csv.Writer, checkpoint *tests.Checkpoint) int {
 
 	test := startTest
 
@@ -107,7 +118,7 @@ func runBatchTests(startTest int, totalTests int, runs int, shards int, arrival
 
 		// Run the actual test with the current configuration
 		runTest(test, runs, shards, arrival, epochs, numberOfParallelRuns, halfCores,
-			alpha, beta, tau, rho, runClpaIter, writerPaper, writerPaperParallel, writerFinal, writerTimes)
+			alpha, beta, tau, rho, runClpaIter, writerPaper, writerPaperParallel, writerFinal, writerTimes, checkpoint)
 
 		// Increment test counter for the next test
 		test++
@@ -119,13 +130,20 @@ func runBatchTests(startTest int, totalTests int, runs int, shards int, arrival
 
 func runTest(test int, runs int, shards int, arrivalRate string, numberOfEpochs int, parallelRuns int,
 	halfCores bool, alpha float64, beta float64, tau int, rho int, runClpaIter paperclpa.ClpaIterationMode,
-	writerPaper *csv.Writer, writerPaperParallel *csv.Writer, writerFinal *csv.Writer, writerTimes *csv.Writer) {
+	writerPaper *csv.Writer, writerPaperParallel *csv.Writer, writerFinal *csv.Writer, writerTimes *csv.Writer,
+	checkpoint *tests.Checkpoint) {
 
 	// Counter to store the index of the next unused seed
 	nextSeedIndex := 0
 
 	for run := 1; run <= runs; run++ {
 
+		// Skip the runs that finished before the suite was last stopped, carrying on from the seeds they used
+		if seedIndex, finished := checkpoint.Finished(test, run); finished {
+			nextSeedIndex = seedIndex
+			continue
+		}
+
 		var graphPaper *shared.Graph = nil
 		var graphParallel *shared.Graph = nil
 		var graphFinal *shared.Graph = nil
@@ -186,14 +204,8 @@ func runTest(test int, runs int, shards int, arrivalRate string, numberOfEpochs
 			seedsResultsParallel, inactiveVerticesParallel := clpaparallel.ShardAllocation("shared/epochs/"+arrivalRate+"_arrival_rate/",
 				shards, epoch, graphParallel, alpha, beta, tau, rho, seeds)
 
-			// Get the best graph from all of the parallel runs
-			graphParallel = shared.GetBestGraph(seedsResultsParallel)
-
-			// Add inactive vertices back to graph for the next epoch
-			// Only the best graph has the vertices added back to save resources
-			for id, vertex := range inactiveVerticesParallel {
-				graphParallel.Vertices[id] = vertex
-			}
+			// Get the best graph of the parallel runs, with the inactive vertices added back for the next epoch
+			graphParallel = tests.BestGraph(seedsResultsParallel, inactiveVerticesParallel)
 
 			// Append the time and epoch results to the slices
 			timeParallel = append(timeParallel, time.Since(start).Seconds())
@@ -208,14 +220,8 @@ func runTest(test int, runs int, shards int, arrivalRate string, numberOfEpochs
 			seedsResultsFinal, inactiveVerticesFinal := mylpa.ShardAllocation("shared/epochs/"+arrivalRate+"_arrival_rate/",
 				shards, epoch, graphFinal, alpha, beta, tau, rho, seeds)
 
-			// Get the best graph from all of the parallel runs
-			graphFinal = shared.GetBestGraph(seedsResultsFinal)
-
-			// Add inactive vertices back to graph for the next epoch
-			// Only the best graph has the vertices added back to save resources
-			for id, vertex := range inactiveVerticesFinal {
-				graphFinal.Vertices[id] = vertex
-			}
+			// Get the best graph of the parallel runs, with the inactive vertices added back for the next epoch
+			graphFinal = tests.BestGraph(seedsResultsFinal, inactiveVerticesFinal)
 
 			// Append the time and epoch results to the slices
 			timeFinal = append(timeFinal, time.Since(start).Seconds())
@@ -227,6 +233,9 @@ func runTest(test int, runs int, shards int, arrivalRate string, numberOfEpochs
 		tests.WriteResults(myLpaResults, writerFinal, test, run)
 
 		tests.WriteThreeTimes(writerTimes, test, run, timePaper, timeParallel, timeFinal)
+
+		// Record that the run finished, now that its results were written
+		checkpoint.Record(test, run, nextSeedIndex)
 	}
 	log.Printf("Test finished")
 }
@@ -2,6 +2,7 @@ package updatemode
 
 import (
 	"log"
+	"runtime"
 
 	"example.com/shardinglpa/paperclpa"
 	"example.com/shardinglpa/shared"
@@ -20,6 +21,10 @@ func RunTest(runs int) {
 	defer writerSync.Flush()
 	defer fileSync.Close()
 
+	writerSyncParallel, fileSyncParallel := tests.CreateResultsWriter("updatemode/paper_CLPA_sync_parallel")
+	defer writerSyncParallel.Flush()
+	defer fileSyncParallel.Close()
+
 	// The number of epochs to be run
 	numberOfEpochs := 30
 
@@ -47,6 +52,9 @@ func RunTest(runs int) {
 	// Set CLPA scoring penalty to be same as the one in the paper
 	var scoringPenalty paperclpa.ScoringPenalty = paperclpa.CalculateScoresPaper
 
+	// The number of goroutines used to score the vertices in the parallel sync update mode
+	numberOfWorkers := runtime.NumCPU()
+
 	// END OF SETUP
 
 	// NOW FOR THE TEST:
@@ -58,10 +66,12 @@ func RunTest(runs int) {
 		// Graph pointers initialized to nil; updated after each epoch for cumulative evolution
 		var graphAsync *shared.Graph = nil
 		var graphSync *shared.Graph = nil
+		var graphSyncParallel *shared.Graph = nil
 
 		// Stores results per mode across all epochs for the current run
 		var asyncResults []*shared.EpochResult
 		var syncResults []*shared.EpochResult
+		var syncParallelResults []*shared.EpochResult
 
 		// Iterate over the epochs
 		for epoch := 1; epoch <= numberOfEpochs; epoch++ {
@@ -94,9 +104,24 @@ func RunTest(runs int) {
 			// Append the result for the current epoch to the epochResults slice
 			syncResults = append(syncResults, epochResult)
 
+			// Sync Update Mode with parallel scoring
+
+			// Set CLPA iteration call to be made with update mode set to sync, scoring vertices in parallel
+			runClpaIter = paperclpa.NewClpaIterationSyncParallel(numberOfWorkers)
+
+			epochResult = paperclpa.ShardAllocation("shared/epochs/"+arrivalRate+"_arrival_rate/",
+				numberOfShards, epoch, graphSyncParallel, alpha, beta, tau, rho, runClpaIter, clpaCall, scoringPenalty)
+
+			// Carry the graph forward for the next epoch
+			graphSyncParallel = epochResult.Graph
+
+			// Append the result for the current epoch to the epochResults slice
+			syncParallelResults = append(syncParallelResults, epochResult)
+
 		}
 		tests.WriteSingleResults(asyncResults, writerAsync, test, run)
 		tests.WriteSingleResults(syncResults, writerSync, test, run)
+		tests.WriteSingleResults(syncParallelResults, writerSyncParallel, test, run)
 	}
 	log.Printf("Test finished")
 }
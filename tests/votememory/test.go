@@ -0,0 +1,151 @@
+package votememory
+
+import (
+	"encoding/csv"
+	"log"
+	"runtime"
+
+	"example.com/shardinglpa/mylpa"
+	"example.com/shardinglpa/shared"
+	"example.com/shardinglpa/tests"
+)
+
+func RunTestSuite(runs int) {
+
+	totalTests := 3
+
+	log.Printf("*********** TEST SUITE 'My LPA vs My LPA with Vote Memory' STARTED (%d Tests in total) ***********", totalTests)
+
+	writerBaseline, fileBaseline := tests.CreateResultsWriter("votememory/my_LPA")
+	defer writerBaseline.Flush()
+	defer fileBaseline.Close()
+
+	writerMemory, fileMemory := tests.CreateResultsWriter("votememory/my_LPA_vote_memory")
+	defer writerMemory.Flush()
+	defer fileMemory.Close()
+
+	writerStabilityBaseline, fileStabilityBaseline := tests.CreateStabilityWriter("votememory/my_LPA_stability")
+	defer writerStabilityBaseline.Flush()
+	defer fileStabilityBaseline.Close()
+
+	writerStabilityMemory, fileStabilityMemory := tests.CreateStabilityWriter("votememory/my_LPA_vote_memory_stability")
+	defer writerStabilityMemory.Flush()
+	defer fileStabilityMemory.Close()
+
+	// The number of epochs to be run
+	numberOfEpochs := 30
+
+	// The number of times/threshold each vertex is allowed to update its label (rho)
+	rho := 50
+
+	// The weight of cross-shard vs workload imbalance in fitness calculation
+	alpha := 0.5
+
+	// The weight of cross-shard vs workload imbalance in score function
+	beta := 0.5
+
+	// The number of iterations of CLPA
+	tau := 100
+
+	// The number of shards
+	numberOfShards := 8
+
+	// The transaction arrival rate
+	arrivalRate := "low"
+
+	// Set number of parallel runs to half the number of cores available
+	numberOfParallelRuns := int(runtime.NumCPU() / 2)
+
+	// END OF SETUP
+
+	// NOW FOR THE TESTS:
+
+	/* 3 tests are run in total, each with different settings for the vote memory:
+	a quick decay, a slow decay, and a slow decay with a tight cap on the votes carried over */
+	voteMemories := []*shared.VoteMemoryConfig{
+		{Decay: 0.5, MaxVotes: 0},
+		{Decay: 0.9, MaxVotes: 0},
+		{Decay: 0.9, MaxVotes: 5},
+	}
+
+	for i, voteMemory := range voteMemories {
+		test := i + 1
+
+		log.Printf("Started Test %d/%d - decay = %.1f, max votes = %.0f", test, totalTests,
+			voteMemory.Decay, voteMemory.MaxVotes)
+
+		runTest(test, runs, numberOfShards, arrivalRate, numberOfEpochs, numberOfParallelRuns, alpha, beta, tau, rho,
+			voteMemory, writerBaseline, writerMemory, writerStabilityBaseline, writerStabilityMemory)
+	}
+
+	log.Println("*********** TEST SUITE 'My LPA vs My LPA with Vote Memory' FINISHED ***********")
+}
+
+func runTest(test int, runs int, shards int, arrivalRate string, numberOfEpochs int, parallelRuns int,
+	alpha float64, beta float64, tau int, rho int, voteMemory *shared.VoteMemoryConfig,
+	writerBaseline *csv.Writer, writerMemory *csv.Writer, writerStabilityBaseline *csv.Writer,
+	writerStabilityMemory *csv.Writer) {
+
+	datasetDir := "shared/epochs/" + arrivalRate + "_arrival_rate/"
+
+	// Counter to store the index of the next unused seed
+	nextSeedIndex := 0
+
+	for run := 1; run <= runs; run++ {
+
+		var graphBaseline *shared.Graph = nil
+		var graphMemory *shared.Graph = nil
+
+		var baselineResults [][]*shared.EpochResult
+		var memoryResults [][]*shared.EpochResult
+
+		// The number of vertices that moved shard since the previous epoch, and the number compared
+		var movedBaseline, comparedBaseline []int
+		var movedMemory, comparedMemory []int
+
+		// Iterate over the epochs
+		for epoch := 1; epoch <= numberOfEpochs; epoch++ {
+
+			// Get the random seeds, which are the same for both variants
+			seeds, err := mylpa.GetSeeds("mylpa/seeds.csv", parallelRuns, nextSeedIndex)
+			if err != nil {
+				log.Fatalf("Failed to load seeds: %v", err)
+			}
+			nextSeedIndex += parallelRuns
+
+			// My LPA without vote memory
+
+			seedsResults, graph, moved, compared := tests.RunSeedsEpochCountingMoves(
+				mylpa.ShardAllocationWithConfig, datasetDir, shards, epoch, graphBaseline, alpha, beta, tau, rho, seeds,
+				shared.AllocationConfig{})
+
+			// Check if results are nil, which can happen when epoch file is not found
+			if seedsResults == nil {
+				continue
+			}
+
+			graphBaseline = graph
+			baselineResults = append(baselineResults, seedsResults)
+			movedBaseline = append(movedBaseline, moved)
+			comparedBaseline = append(comparedBaseline, compared)
+
+			// My LPA with vote memory
+
+			seedsResults, graph, moved, compared = tests.RunSeedsEpochCountingMoves(
+				mylpa.ShardAllocationWithConfig, datasetDir, shards, epoch, graphMemory, alpha, beta, tau, rho, seeds,
+				shared.AllocationConfig{VoteMemory: voteMemory})
+
+			graphMemory = graph
+			memoryResults = append(memoryResults, seedsResults)
+			movedMemory = append(movedMemory, moved)
+			comparedMemory = append(comparedMemory, compared)
+		}
+
+		tests.WriteResults(baselineResults, writerBaseline, test, run)
+		tests.WriteResults(memoryResults, writerMemory, test, run)
+
+		tests.WriteStability(writerStabilityBaseline, test, run, movedBaseline, comparedBaseline)
+		tests.WriteStability(writerStabilityMemory, test, run, movedMemory, comparedMemory)
+	}
+	log.Printf("Test finished")
+}
@@ -0,0 +1,116 @@
+package votepolicy
+
+import (
+	"context"
+	"encoding/csv"
+	"log"
+	"runtime"
+
+	"example.com/shardinglpa/mylpa"
+	"example.com/shardinglpa/shared"
+	"example.com/shardinglpa/tests"
+)
+
+func RunTestSuite(runs int) {
+
+	/* A test is run for each vote policy: the margin of the original My LPA, a larger margin, votes over a window
+	of the last iterations, decaying votes, and a majority of the votes instead of a margin
+	The vote policy of each result is recorded in the results */
+	votePolicies := []shared.VotePolicy{
+		shared.DefaultVotePolicy(),
+		{Margin: 2},
+		{Margin: 1, Window: 5},
+		{Margin: 1, Decay: 0.8},
+		{MajorityFraction: 0.6},
+	}
+
+	totalTests := len(votePolicies)
+
+	log.Printf("*********** TEST SUITE 'Vote Policies of My LPA' STARTED (%d Tests in total) ***********", totalTests)
+
+	writer, file := tests.CreateResultsWriter("votepolicy/my_LPA")
+	defer writer.Flush()
+	defer file.Close()
+
+	// The number of epochs to be run
+	numberOfEpochs := 30
+
+	// The number of times/threshold each vertex is allowed to update its label (rho)
+	rho := 50
+
+	// The weight of cross-shard vs workload imbalance in fitness calculation
+	alpha := 0.5
+
+	// The weight of cross-shard vs workload imbalance in score function
+	beta := 0.5
+
+	// The number of iterations of CLPA
+	tau := 100
+
+	// The number of shards
+	numberOfShards := 8
+
+	// The transaction arrival rate
+	arrivalRate := "low"
+
+	// Set number of parallel runs to half the number of cores available
+	numberOfParallelRuns := max(int(runtime.NumCPU()/2), 1)
+
+	// END OF SETUP
+
+	// NOW FOR THE TESTS:
+
+	for i := range votePolicies {
+		test := i + 1
+		votePolicy := &votePolicies[i]
+
+		log.Printf("Started Test %d/%d - vote policy = %s", test, totalTests, votePolicy)
+
+		runTest(test, runs, numberOfShards, arrivalRate, numberOfEpochs, numberOfParallelRuns, alpha, beta, tau, rho,
+			votePolicy, writer)
+	}
+
+	log.Println("*********** TEST SUITE 'Vote Policies of My LPA' FINISHED ***********")
+}
+
+func runTest(test int, runs int, shards int, arrivalRate string, numberOfEpochs int, parallelRuns int,
+	alpha float64, beta float64, tau int, rho int, votePolicy *shared.VotePolicy, writer *csv.Writer) {
+
+	// Counter to store the index of the next unused seed
+	// Every vote policy uses the same seeds, so that they are compared fairly
+	nextSeedIndex := 0
+
+	for run := 1; run <= runs; run++ {
+
+		var graph *shared.Graph = nil
+		var myLpaResults [][]*shared.EpochResult
+
+		// Iterate over the epochs
+		for epoch := 1; epoch <= numberOfEpochs; epoch++ {
+
+			// Get the random seeds
+			seeds, err := mylpa.GetSeeds("mylpa/seeds.csv", parallelRuns, nextSeedIndex)
+			if err != nil {
+				log.Fatalf("Failed to load seeds: %v", err)
+			}
+			nextSeedIndex += parallelRuns
+
+			seedsResults, inactiveVertices := mylpa.ShardAllocationWithConfig(context.Background(),
+				"shared/epochs/"+arrivalRate+"_arrival_rate/", shards, epoch, graph, alpha, beta, tau, rho, seeds,
+				shared.AllocationConfig{VotePolicy: votePolicy})
+
+			// Check if results are nil, which can happen when epoch file is not found
+			if seedsResults == nil {
+				continue
+			}
+
+			// Get the best graph of the parallel runs, with the inactive vertices added back for the next epoch
+			graph = tests.BestGraph(seedsResults, inactiveVertices)
+
+			myLpaResults = append(myLpaResults, seedsResults)
+		}
+
+		tests.WriteResults(myLpaResults, writer, test, run)
+	}
+	log.Printf("Test finished")
+}